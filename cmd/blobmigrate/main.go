@@ -0,0 +1,106 @@
+// Command blobmigrate copies every blob of uploaded files from one blob
+// store backend to another, e.g. from the upload directory to an S3
+// bucket before switching BLOB_BACKEND. Both stores are configured from
+// the same environment as the server. Keys stay the same, so the file
+// metadata needs no change.
+//
+// Usage:
+//
+//	blobmigrate -from local -to s3 [-delete-source]
+//
+// Blobs the destination already holds with the same size are skipped, so
+// an interrupted run can simply be repeated.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+
+	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/storage"
+)
+
+func main() {
+	from := flag.String("from", storage.BackendLocal, "backend to copy blobs from (local or s3)")
+	to := flag.String("to", storage.BackendS3, "backend to copy blobs to (local or s3)")
+	deleteSource := flag.Bool("delete-source", false, "delete blobs from the source once all were copied")
+	flag.Parse()
+
+	if *from == *to {
+		log.Fatalf("-from and -to are both %q", *from)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	cfg := config.Load()
+	src, err := storage.Open(ctx, cfg, *from)
+	if err != nil {
+		log.Fatalf("Opening %s blob store failed: %v", *from, err)
+	}
+	dst, err := storage.Open(ctx, cfg, *to)
+	if err != nil {
+		log.Fatalf("Opening %s blob store failed: %v", *to, err)
+	}
+
+	if err := migrate(ctx, dst, src, *deleteSource); err != nil {
+		log.Fatalf("Migrating blobs from %s to %s failed: %v", *from, *to, err)
+	}
+}
+
+// migrate copies every blob from src to dst and, with deleteSource, then
+// deletes the blobs dst holds with the same size from src.
+func migrate(ctx context.Context, dst, src storage.BlobStore, deleteSource bool) error {
+	failed := 0
+	copied, skipped, err := storage.Copy(ctx, dst, src, func(key string, err error) {
+		if err != nil {
+			failed++
+			log.Printf("[BLOBS] %s: %v", key, err)
+			return
+		}
+		log.Printf("[BLOBS] copied %s", key)
+	})
+	if err != nil {
+		return fmt.Errorf("listing source: %w", err)
+	}
+	log.Printf("[BLOBS] %d copied, %d already present, %d failed", copied, skipped, failed)
+
+	if failed > 0 {
+		return fmt.Errorf("%d blobs could not be copied", failed)
+	}
+	if !deleteSource {
+		return nil
+	}
+
+	// collect first: deleting while listing confuses some backends
+	var keys []string
+	if err := src.List(ctx, func(key string) error {
+		keys = append(keys, key)
+		return nil
+	}); err != nil {
+		return fmt.Errorf("listing source: %w", err)
+	}
+	deleted := 0
+	for _, key := range keys {
+		// blobs uploaded since the copy stay where they are
+		have, err := dst.Stat(ctx, key)
+		if err != nil {
+			log.Printf("[BLOBS] keeping %s: %v", key, err)
+			continue
+		}
+		if info, err := src.Stat(ctx, key); err != nil || info.Size != have.Size {
+			log.Printf("[BLOBS] keeping %s: not copied yet", key)
+			continue
+		}
+		if err := src.Delete(ctx, key); err != nil {
+			return fmt.Errorf("deleting %s: %w", key, err)
+		}
+		deleted++
+	}
+	log.Printf("[BLOBS] deleted %d blobs from the source", deleted)
+	return nil
+}
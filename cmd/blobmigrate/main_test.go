@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tmsankram/gonotes/internal/storage"
+)
+
+func newStore(t *testing.T, blobs map[string]string) *storage.Local {
+	t.Helper()
+	s, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, content := range blobs {
+		if _, err := s.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return s
+}
+
+func contents(t *testing.T, s storage.BlobStore) map[string]string {
+	t.Helper()
+	ctx := context.Background()
+	blobs := map[string]string{}
+	err := s.List(ctx, func(key string) error {
+		body, err := s.Get(ctx, key)
+		if err != nil {
+			return err
+		}
+		defer body.Close()
+		b, err := io.ReadAll(body)
+		blobs[key] = string(b)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return blobs
+}
+
+func keys(blobs map[string]string) []string {
+	var keys []string
+	for k := range blobs {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// lateStore receives an upload between the copy and the deletion.
+type lateStore struct {
+	*storage.Local
+	lists int
+}
+
+func (s *lateStore) List(ctx context.Context, fn func(key string) error) error {
+	if s.lists++; s.lists == 2 {
+		if _, err := s.Put(ctx, "sha256/cc/late", strings.NewReader("late"), 4, ""); err != nil {
+			return err
+		}
+	}
+	return s.Local.List(ctx, fn)
+}
+
+// failingStore cannot store one key.
+type failingStore struct {
+	*storage.Local
+	key string
+}
+
+func (s *failingStore) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (int64, error) {
+	if key == s.key {
+		return 0, errors.New("disk full")
+	}
+	return s.Local.Put(ctx, key, r, size, contentType)
+}
+
+var blobs = map[string]string{
+	"sha256/aa/aaa":            "first",
+	"sha256/bb/bbb":            "second",
+	"0b5e0c9e-1b8a_report.pdf": "from before deduplication",
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	src, dst := newStore(t, blobs), newStore(t, nil)
+
+	if err := migrate(ctx, dst, src, false); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(t, dst); !slices.Equal(keys(got), keys(blobs)) || got["sha256/bb/bbb"] != "second" {
+		t.Fatalf("dst has %v", got)
+	}
+	if got := contents(t, src); len(got) != len(blobs) {
+		t.Fatalf("src lost blobs: %v", got)
+	}
+
+	// a repeated run with -delete-source keeps what was not copied
+	late := &lateStore{Local: src}
+	if err := migrate(ctx, dst, late, true); err != nil {
+		t.Fatal(err)
+	}
+	if got := contents(t, src); !slices.Equal(keys(got), []string{"sha256/cc/late"}) {
+		t.Fatalf("src has %v", got)
+	}
+	if got := contents(t, dst); len(got) != len(blobs) {
+		t.Fatalf("dst has %v", got)
+	}
+}
+
+func TestMigrateFailure(t *testing.T) {
+	ctx := context.Background()
+	src := newStore(t, blobs)
+	dst := &failingStore{Local: newStore(t, nil), key: "sha256/bb/bbb"}
+
+	if err := migrate(ctx, dst, src, true); err == nil {
+		t.Fatal("expected an error")
+	}
+	// nothing is deleted when a blob could not be copied
+	if got := contents(t, src); len(got) != len(blobs) {
+		t.Fatalf("src has %v", got)
+	}
+	if got := contents(t, dst); !slices.Equal(keys(got), []string{"0b5e0c9e-1b8a_report.pdf", "sha256/aa/aaa"}) {
+		t.Fatalf("dst has %v", got)
+	}
+}
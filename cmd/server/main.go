@@ -11,9 +11,12 @@ import (
 
 	"github.com/tmsankram/gonotes/internal/config"
 	"github.com/tmsankram/gonotes/internal/db"
+	"github.com/tmsankram/gonotes/internal/files"
 	"github.com/tmsankram/gonotes/internal/notes"
 	"github.com/tmsankram/gonotes/internal/router"
+	"github.com/tmsankram/gonotes/internal/storage"
 	"github.com/tmsankram/gonotes/internal/users"
+	"github.com/tmsankram/gonotes/internal/webhooks"
 )
 
 // @title GoNotes API
@@ -38,11 +41,50 @@ func main() {
 	db := db.Connect(cfg) // connect to the database
 
 	// AutoMigrate models
-	if err := db.AutoMigrate(&users.User{}, &notes.Note{}); err != nil {
+	if err := db.AutoMigrate(&users.User{}, &notes.Note{}, &notes.Revision{}, &notes.Tag{}, &notes.Notebook{}, &notes.Share{}, &notes.Comment{}, &notes.PublicLink{}, &notes.WikiLink{}, &webhooks.Webhook{}, &webhooks.Delivery{}, &files.File{}, &files.Blob{}, &files.Upload{}, &files.UploadPart{}, &files.Quota{}); err != nil {
 		log.Fatalf("AutoMigrate failed: %v", err)
 	}
+	if err := notes.Migrate(db); err != nil {
+		log.Fatalf("notes migration failed: %v", err)
+	}
+	if err := files.Migrate(db, cfg.UploadDir); err != nil {
+		log.Fatalf("files migration failed: %v", err)
+	}
+
+	bgCtx, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	r := router.New(bgCtx, db)
+
+	// permanently remove notes that stayed in the trash past the retention window
+	go notes.NewService(db, cfg, nil).RunPurger(bgCtx, time.Hour, cfg.TrashRetention)
+
+	// match the blob store with the file metadata
+	go func() {
+		blobs, err := storage.Open(bgCtx, cfg, cfg.BlobBackend)
+		if err != nil {
+			log.Printf("[FILES] opening blob store failed: %v", err)
+			return
+		}
+		svc := files.NewService(db, cfg, blobs, nil)
+		report, err := svc.Reconcile(bgCtx, cfg.OrphanFilesOwner)
+		if err != nil {
+			log.Printf("[FILES] reconciling uploads failed: %v", err)
+			return
+		}
+		log.Printf("[FILES] reconciled uploads: %d untracked, %d imported, %d missing",
+			len(report.Untracked), len(report.Imported), len(report.Missing))
 
-	r := router.New(db)
+		// resumable uploads the server stopped while turning into files
+		finished, err := svc.FinishUploads(bgCtx)
+		if err != nil {
+			log.Printf("[FILES] finishing resumable uploads failed: %v", err)
+			return
+		}
+		if finished > 0 {
+			log.Printf("[FILES] finished %d resumable uploads", finished)
+		}
+	}()
 
 	srv := &http.Server{
 		Addr:    ":" + strconv.Itoa(cfg.Port),
@@ -65,5 +107,6 @@ func main() {
 	defer cancel()
 
 	log.Println("Shutting down...")
+	stopBackground()
 	srv.Shutdown(ctx)
 }
@@ -29,6 +29,22 @@ func AuthRequired() gin.HandlerFunc {
 	}
 }
 
+// AdminRequired lets only the given users through. It goes after
+// AuthRequired.
+func AdminRequired(admins []uint) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+		for _, id := range admins {
+			if id == userID {
+				c.Next()
+				return
+			}
+		}
+		response.Forbidden(c, Err("admin only"))
+		c.Abort()
+	}
+}
+
 func Err(msg string) error {
 	return &AuthError{msg}
 }
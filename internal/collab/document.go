@@ -0,0 +1,147 @@
+package collab
+
+import (
+	"errors"
+
+	"github.com/tmsankram/gonotes/internal/notes"
+)
+
+// maxHistory is how many applied ops a document keeps for clients that
+// reconnect or send ops based on an older revision.
+const maxHistory = 1000
+
+// ErrStaleRev is returned for ops based on a revision the document no
+// longer has the history for. The client has to start over from "init".
+var ErrStaleRev = errors.New("revision is too old, resync required")
+
+// entry is an op in the history of a document.
+type entry struct {
+	op     Op
+	client string // "" for changes merged in from outside the session
+	seq    int
+}
+
+type ack struct {
+	seq int
+	rev int
+}
+
+// document is the server side state of a note being edited. Revision n
+// is the text after the n-th op since the note was loaded. It is not safe
+// for concurrent use; sessions guard it with their mutex.
+type document struct {
+	noteID int64
+	title  string
+	text   string
+	rev    int
+
+	// history[i] turned revision base+i into base+i+1
+	history []entry
+	base    int
+	// last op applied per client id, to drop ops resent after a reconnect
+	acks map[string]ack
+
+	// savedText is the note content as stored under version; unsaved
+	// turns it into text.
+	version    int64
+	savedText  string
+	unsaved    []Op
+	lastEditor uint
+}
+
+func newDocument(n notes.Note) *document {
+	return &document{
+		noteID:    n.ID,
+		title:     n.Title,
+		text:      n.Content,
+		acks:      map[string]ack{},
+		version:   n.Version,
+		savedText: n.Content,
+	}
+}
+
+func (d *document) dirty() bool {
+	return len(d.unsaved) > 0
+}
+
+// saved records that the current text was stored as note n.
+func (d *document) saved(n notes.Note) {
+	d.version = n.Version
+	d.savedText = d.text
+	d.unsaved = nil
+}
+
+// submit applies a client op made against revision rev. It returns the op
+// as applied to the current text. Ops the client already sent before are
+// recognised by seq and reported as dup without being applied again.
+func (d *document) submit(client string, seq, rev int, op Op) (applied Op, newRev int, dup bool, err error) {
+	if last, ok := d.acks[client]; ok && seq <= last.seq {
+		return Op{}, last.rev, true, nil
+	}
+	if rev < d.base || rev > d.rev {
+		return Op{}, 0, false, ErrStaleRev
+	}
+
+	for _, e := range d.history[rev-d.base:] {
+		if op, _, err = Transform(op, e.op); err != nil {
+			return Op{}, 0, false, err
+		}
+	}
+
+	text, err := op.Apply(d.text)
+	if err != nil {
+		return Op{}, 0, false, err
+	}
+
+	d.push(entry{op: op, client: client, seq: seq}, text)
+	d.unsaved = append(d.unsaved, op)
+	d.acks[client] = ack{seq: seq, rev: d.rev}
+	return op, d.rev, false, nil
+}
+
+// since returns the ops applied after revision rev.
+func (d *document) since(rev int) ([]entry, bool) {
+	if rev < d.base || rev > d.rev {
+		return nil, false
+	}
+	return d.history[rev-d.base:], true
+}
+
+// merge folds a version of the note saved outside the session into the
+// document. The outside change is computed against the text last saved
+// and rebased over the ops not saved yet, which in turn are rebased onto
+// the outside version so that a later merge starts from it.
+func (d *document) merge(n notes.Note) (Op, error) {
+	op := Diff(d.savedText, n.Content)
+
+	unsaved := make([]Op, len(d.unsaved))
+	for i, u := range d.unsaved {
+		var err error
+		if op, unsaved[i], err = Transform(op, u); err != nil {
+			return Op{}, err
+		}
+	}
+
+	text, err := op.Apply(d.text)
+	if err != nil {
+		return Op{}, err
+	}
+
+	d.push(entry{op: op}, text)
+	d.title = n.Title
+	d.version = n.Version
+	d.savedText = n.Content
+	d.unsaved = unsaved
+	return op, nil
+}
+
+func (d *document) push(e entry, text string) {
+	d.text = text
+	d.rev++
+	d.history = append(d.history, e)
+
+	if drop := len(d.history) - maxHistory; drop > 0 {
+		d.history = d.history[drop:]
+		d.base += drop
+	}
+}
@@ -0,0 +1,144 @@
+package collab
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/tmsankram/gonotes/internal/notes"
+)
+
+func TestSubmit(t *testing.T) {
+	d := newDocument(notes.Note{ID: 1, Content: "hello", Version: 1})
+
+	// two clients edit revision 0 concurrently
+	if _, rev, dup, err := d.submit("a", 1, 0, op(t, `[5, " world"]`)); err != nil || dup || rev != 1 {
+		t.Fatalf("a: rev %d, dup %v, %v", rev, dup, err)
+	}
+	applied, rev, dup, err := d.submit("b", 1, 0, op(t, `["oh ", 5]`))
+	if err != nil || dup || rev != 2 {
+		t.Fatalf("b: rev %d, dup %v, %v", rev, dup, err)
+	}
+	if got := wire(t, applied); got != `["oh ",11]` {
+		t.Fatalf("b applied as %s", got)
+	}
+	if d.text != "oh hello world" {
+		t.Fatalf("text %q", d.text)
+	}
+
+	t.Run("duplicate seq", func(t *testing.T) {
+		_, rev, dup, err := d.submit("a", 1, 0, op(t, `[5, " world"]`))
+		if err != nil || !dup || rev != 1 {
+			t.Fatalf("rev %d, dup %v, %v", rev, dup, err)
+		}
+		if d.text != "oh hello world" || d.rev != 2 {
+			t.Fatalf("resent op was applied: %q at %d", d.text, d.rev)
+		}
+	})
+
+	t.Run("stale rev", func(t *testing.T) {
+		for _, rev := range []int{-1, 3} {
+			if _, _, _, err := d.submit("a", 2, rev, op(t, `[14, "!"]`)); !errors.Is(err, ErrStaleRev) {
+				t.Fatalf("rev %d: got %v", rev, err)
+			}
+		}
+	})
+
+	t.Run("bad op", func(t *testing.T) {
+		if _, _, _, err := d.submit("a", 3, 2, op(t, `[99, "!"]`)); !errors.Is(err, ErrBadOp) {
+			t.Fatalf("got %v", err)
+		}
+		if d.rev != 2 {
+			t.Fatalf("rev moved to %d", d.rev)
+		}
+	})
+
+	t.Run("history limit", func(t *testing.T) {
+		d := newDocument(notes.Note{ID: 1})
+		for i := 1; i <= maxHistory+10; i++ {
+			if _, _, _, err := d.submit("a", i, d.rev, *new(Op).Insert("x").Retain(i - 1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(d.history) != maxHistory || d.base != 10 {
+			t.Fatalf("history %d from %d", len(d.history), d.base)
+		}
+		if _, ok := d.since(5); ok {
+			t.Fatal("since a dropped revision")
+		}
+		if _, _, _, err := d.submit("b", 1, 5, *new(Op).Insert("y").Retain(d.rev)); !errors.Is(err, ErrStaleRev) {
+			t.Fatalf("got %v", err)
+		}
+	})
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name    string
+		saved   string
+		edits   []string // unsaved session ops, each against the previous text
+		outside string
+		want    string
+	}{
+		{"no session edits", "hello world", nil, "hello there world", "hello there world"},
+		{"edits apart", "hello world", []string{`["oh ", 11]`}, "hello world!", "oh hello world!"},
+		{"same spot puts outside first", "ab", []string{`[1, "S", 1]`}, "aOb", "aOSb"},
+		{"outside deletes around an edit", "hello big world", []string{`[9, "wide ", 6]`}, "hello", "hellowide "},
+		{"both delete", "abcdef", []string{`[1, -3, 2]`}, "af", "af"},
+		{"several edits", "one", []string{`[3, " two"]`, `[7, " three"]`}, "zero one", "zero one two three"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := newDocument(notes.Note{ID: 1, Content: tt.saved, Version: 1})
+			for i, e := range tt.edits {
+				if _, _, _, err := d.submit("a", i+1, d.rev, op(t, e)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before := d.text
+
+			m, err := d.merge(notes.Note{ID: 1, Content: tt.outside, Version: 2})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if d.text != tt.want {
+				t.Fatalf("got %q, want %q", d.text, tt.want)
+			}
+			// clients apply the broadcast op to the text they had
+			if got, err := m.Apply(before); err != nil || got != d.text {
+				t.Fatalf("merge op gives %q, %v", got, err)
+			}
+			if d.version != 2 || d.savedText != tt.outside {
+				t.Fatalf("saved state %d %q", d.version, d.savedText)
+			}
+			// the rebased unsaved ops turn the outside version into the text
+			text := d.savedText
+			for _, u := range d.unsaved {
+				if text, err = u.Apply(text); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if text != d.text {
+				t.Fatalf("unsaved ops give %q", text)
+			}
+			if d.dirty() != (len(tt.edits) > 0) {
+				t.Fatalf("dirty %v", d.dirty())
+			}
+		})
+	}
+
+	t.Run("merged twice", func(t *testing.T) {
+		d := newDocument(notes.Note{ID: 1, Content: "abc", Version: 1})
+		if _, _, _, err := d.submit("a", 1, 0, op(t, `[3, "d"]`)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.merge(notes.Note{Content: "Xabc", Version: 2}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := d.merge(notes.Note{Content: "Xabc!", Version: 3}); err != nil {
+			t.Fatal(err)
+		}
+		if d.text != "Xabc!d" {
+			t.Fatalf("got %q", d.text)
+		}
+	})
+}
@@ -0,0 +1,137 @@
+package collab
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/tmsankram/gonotes/internal/notes"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+const (
+	writeWait      = 10 * time.Second
+	pongWait       = 60 * time.Second
+	pingPeriod     = pongWait * 9 / 10
+	maxMessageSize = 1 << 20
+)
+
+var errInvalidRev = errors.New("invalid rev")
+
+// Handler serves editing sessions over WebSockets.
+type Handler struct {
+	hub      *Hub
+	upgrader websocket.Upgrader
+}
+
+func NewHandler(hub *Hub) *Handler {
+	// The default origin check only lets pages from this host connect,
+	// which matters because browsers authenticate with the session cookie.
+	return &Handler{hub: hub}
+}
+
+// Connect godoc
+// @Summary Collaborative editing session
+// @Description Upgrade to a WebSocket that syncs edits of a note between everyone who has it open. Pass client and rev to resume after a reconnect.
+// @Tags collaboration
+// @Param id path int true "Note ID"
+// @Param client query string false "Client id from a previous connection"
+// @Param rev query int false "Last revision the client saw"
+// @Success 101
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/ws [get]
+func (h *Handler) Connect(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	rev := -1
+	if v := c.Query("rev"); v != "" {
+		if rev, err = strconv.Atoi(v); err != nil || rev < 0 {
+			response.BadRequest(c, errInvalidRev)
+			return
+		}
+	}
+
+	client, err := h.hub.Join(c.GetUint("userID"), id, c.Query("client"), rev)
+	if errors.Is(err, notes.ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+
+	conn, err := h.upgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// the upgrader already wrote the error response
+		h.hub.Leave(client)
+		return
+	}
+
+	go h.write(conn, client)
+	h.read(conn, client)
+}
+
+// read feeds messages from the connection to the hub until it closes.
+func (h *Handler) read(conn *websocket.Conn, client *Client) {
+	defer func() {
+		h.hub.Leave(client)
+		conn.Close()
+	}()
+
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var m Message
+		if err := conn.ReadJSON(&m); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				log.Printf("collab: client %s: %v", client.ID, err)
+			}
+			return
+		}
+		h.hub.Handle(client, m)
+	}
+}
+
+// write sends the client's messages and keeps the connection alive. It
+// closes the connection once the hub is done with the client.
+func (h *Handler) write(conn *websocket.Conn, client *Client) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case m, ok := <-client.Messages():
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+			if err := conn.WriteJSON(m); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
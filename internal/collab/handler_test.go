@@ -0,0 +1,428 @@
+package collab
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+
+	"github.com/tmsankram/gonotes/internal/notes"
+)
+
+const (
+	owner  uint = 1
+	editor uint = 2
+	viewer uint = 3
+)
+
+// memStore keeps one note in memory. Owner and editor may edit it, the
+// viewer may only read it.
+type memStore struct {
+	mu   sync.Mutex
+	note notes.Note
+}
+
+func (s *memStore) GetByID(userID uint, id int64) (notes.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id != s.note.ID || userID > viewer {
+		return notes.Note{}, notes.ErrNotFound
+	}
+	return s.note, nil
+}
+
+func (s *memStore) CanEdit(userID uint, id int64) (bool, error) {
+	if _, err := s.GetByID(userID, id); err != nil {
+		return false, err
+	}
+	return userID != viewer, nil
+}
+
+func (s *memStore) Update(userID uint, id int64, data notes.Note, tags []string) (notes.Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if data.Version > 0 && data.Version != s.note.Version {
+		return notes.Note{}, notes.ErrVersionConflict
+	}
+	s.note.Title, s.note.Content = data.Title, data.Content
+	s.note.Version++
+	return s.note, nil
+}
+
+func (s *memStore) content() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.note.Content
+}
+
+// newTestServer serves the hub over WebSockets. The user comes from the
+// X-User header in place of a token.
+func newTestServer(t *testing.T, content string) (*httptest.Server, *memStore, *Hub) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	store := &memStore{note: notes.Note{ID: 7, UserID: owner, Title: "Agenda", Content: content, Version: 1}}
+	hub := NewHub(store, nil)
+	// saves only happen when the last client leaves
+	hub.SaveDelay = time.Hour
+
+	r := gin.New()
+	r.GET("/notes/:id/ws", func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-User"), 10, 64)
+		c.Set("userID", uint(id))
+	}, NewHandler(hub).Connect)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv, store, hub
+}
+
+// wsClient is an editor on the other end of a WebSocket. Like an ot.js
+// client it has at most one op in flight and transforms incoming ops
+// against it.
+type wsClient struct {
+	t    *testing.T
+	conn *websocket.Conn
+
+	id      string
+	text    string
+	rev     int
+	seq     int
+	pending *Op
+}
+
+func dial(t *testing.T, srv *httptest.Server, userID uint, query string) *wsClient {
+	t.Helper()
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/notes/7/ws" + query
+	conn, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User": {strconv.Itoa(int(userID))}})
+	if err != nil {
+		status := 0
+		if resp != nil {
+			status = resp.StatusCode
+		}
+		t.Fatalf("dial %s: %v (%d)", query, err, status)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return &wsClient{t: t, conn: conn}
+}
+
+// join dials as a new client and reads its init.
+func join(t *testing.T, srv *httptest.Server, userID uint) *wsClient {
+	t.Helper()
+	c := dial(t, srv, userID, "")
+	m := c.expect("init")
+	c.id, c.text, c.rev = m.Self, *m.Text, m.Rev
+	return c
+}
+
+func (c *wsClient) read() Message {
+	c.t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var m Message
+	if err := c.conn.ReadJSON(&m); err != nil {
+		c.t.Fatalf("client %s: read: %v", c.id, err)
+	}
+	return m
+}
+
+// expect reads up to the next message of the given type; presence
+// updates in between are skipped.
+func (c *wsClient) expect(typ string) Message {
+	c.t.Helper()
+	for {
+		m := c.read()
+		if m.Type == typ {
+			return m
+		}
+		if m.Type != "presence" {
+			c.t.Fatalf("client %s: got %+v, want %s", c.id, m, typ)
+		}
+	}
+}
+
+func (c *wsClient) send(m Message) {
+	c.t.Helper()
+	if err := c.conn.WriteJSON(m); err != nil {
+		c.t.Fatalf("client %s: write: %v", c.id, err)
+	}
+}
+
+// edit applies op locally and sends it.
+func (c *wsClient) edit(op Op) {
+	c.t.Helper()
+	text, err := op.Apply(c.text)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.text = text
+	c.seq++
+	c.pending = &op
+	c.send(Message{Type: "op", Rev: c.rev, Seq: c.seq, Op: &op})
+}
+
+// receive handles one message from the server.
+func (c *wsClient) receive(m Message) {
+	c.t.Helper()
+	switch m.Type {
+	case "ack":
+		c.pending = nil
+		c.rev = m.Rev
+	case "op":
+		op := *m.Op
+		if c.pending != nil {
+			// the server applied op first, so ours goes on top of it
+			pending, remote, err := Transform(*c.pending, op)
+			if err != nil {
+				c.t.Fatal(err)
+			}
+			c.pending, op = &pending, remote
+		}
+		text, err := op.Apply(c.text)
+		if err != nil {
+			c.t.Fatalf("client %s: applying %+v to %q: %v", c.id, m, c.text, err)
+		}
+		c.text, c.rev = text, m.Rev
+	case "error":
+		c.t.Fatalf("client %s: %s", c.id, m.Error)
+	}
+}
+
+// mark is the single rune editor i inserts with its jth edit.
+func mark(i, j int) string { return string(rune(0x4e00 + i*100 + j)) }
+
+// randomEdit inserts word at a random spot and sometimes deletes a few
+// lowercase ASCII letters after it, so that no inserted mark is lost.
+func randomEdit(rng *rand.Rand, text, word string) Op {
+	runes := []rune(text)
+	n := len(runes)
+	pos := rng.Intn(n + 1)
+	var op Op
+	op.Retain(pos).Insert(word)
+	del := 0
+	if rng.Intn(3) == 0 {
+		for del < 3 && pos+del < n && 'a' <= runes[pos+del] && runes[pos+del] <= 'z' {
+			del++
+		}
+	}
+	op.Delete(del).Retain(n - pos - del)
+	return op
+}
+
+func TestConcurrentEditsConverge(t *testing.T) {
+	srv, store, hub := newTestServer(t, "The quick brown fox jumps over the lazy dog")
+
+	const editors, edits = 4, 25
+	clients := make([]*wsClient, editors)
+	for i := range clients {
+		clients[i] = join(t, srv, []uint{owner, editor}[i%2])
+	}
+	start := clients[editors-1].rev
+	final := start + editors*edits
+
+	var wg sync.WaitGroup
+	for i, c := range clients {
+		wg.Add(1)
+		go func(i int, c *wsClient) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(i)))
+			sent := 0
+			for sent < edits || c.pending != nil || c.rev < final {
+				if c.pending == nil && sent < edits {
+					c.edit(randomEdit(rng, c.text, mark(i, sent)))
+					sent++
+				}
+				c.receive(c.read())
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	want := clients[0].text
+	for _, c := range clients {
+		if c.text != want || c.rev != final {
+			t.Fatalf("client %s at rev %d has %q, want %q at %d", c.id, c.rev, c.text, want, final)
+		}
+	}
+	for i := range editors {
+		for j := range edits {
+			if n := strings.Count(want, mark(i, j)); n != 1 {
+				t.Fatalf("edit %d.%d is in %q %d times", i, j, want, n)
+			}
+		}
+	}
+
+	// leaving saves what everyone converged on
+	for _, c := range clients {
+		c.conn.Close()
+	}
+	waitFor(t, func() bool { return store.content() == want })
+	waitFor(t, func() bool {
+		hub.mu.Lock()
+		defer hub.mu.Unlock()
+		return len(hub.sessions) == 0
+	})
+}
+
+func TestReconnectResumes(t *testing.T) {
+	srv, store, _ := newTestServer(t, "hello")
+
+	a := join(t, srv, owner)
+	b := join(t, srv, editor)
+	a.expect("presence") // b joined
+
+	a.edit(op(t, `[5, " world"]`))
+	a.receive(a.expect("ack"))
+	b.receive(b.expect("op"))
+
+	// a drops off while b keeps typing
+	a.conn.Close()
+	b.expect("presence")
+	b.edit(op(t, `[11, "!"]`))
+	b.receive(b.expect("ack"))
+	b.edit(op(t, `["oh ", 12]`))
+	b.receive(b.expect("ack"))
+
+	// reconnecting with the old id and rev replays what a missed
+	c := dial(t, srv, owner, fmt.Sprintf("?client=%s&rev=%d", a.id, a.rev))
+	c.id, c.text, c.rev = a.id, a.text, a.rev
+	a = c
+	for range 2 {
+		m := a.expect("op")
+		if m.Rev != a.rev+1 || m.Client != b.id {
+			t.Fatalf("got %+v after rev %d", m, a.rev)
+		}
+		a.receive(m)
+	}
+	if a.text != "oh hello world!" {
+		t.Fatalf("got %q", a.text)
+	}
+
+	// a resends its first op as if the ack had been lost; it is acked
+	// with its original rev and not applied again
+	a.send(Message{Type: "op", Rev: 0, Seq: 1, Op: ptr(op(t, `[5, " world"]`))})
+	if m := a.expect("ack"); m.Seq != 1 || m.Rev != 1 {
+		t.Fatalf("got %+v", m)
+	}
+	b.edit(op(t, `[15, "?"]`))
+	b.receive(b.expect("ack"))
+	a.receive(a.expect("op"))
+	if a.text != "oh hello world!?" || b.text != a.text {
+		t.Fatalf("a has %q, b has %q", a.text, b.text)
+	}
+
+	// a rev the session does not know gets a fresh init
+	c = dial(t, srv, editor, "?client="+b.id+"&rev=999")
+	m := c.expect("init")
+	if m.Self != b.id || *m.Text != "oh hello world!?" || m.Rev != 4 {
+		t.Fatalf("got %+v", m)
+	}
+
+	a.conn.Close()
+	c.conn.Close()
+	waitFor(t, func() bool { return store.content() == "oh hello world!?" })
+}
+
+func TestClientIDNotTakenOver(t *testing.T) {
+	srv, _, _ := newTestServer(t, "hello")
+
+	a := join(t, srv, owner)
+	a.edit(op(t, `[5, "!"]`))
+	a.receive(a.expect("ack"))
+
+	// the viewer learns a's id from the peer list and connects with it
+	v := dial(t, srv, viewer, fmt.Sprintf("?client=%s&rev=0", a.id))
+	m := v.expect("init")
+	if m.Self == a.id || m.Self == "" || *m.Text != "hello!" {
+		t.Fatalf("got %+v", m)
+	}
+	v.id = m.Self
+
+	// a keeps its connection
+	if m := a.expect("presence"); len(m.Peers) != 2 {
+		t.Fatalf("got %+v", m)
+	}
+	a.edit(op(t, `[6, "?"]`))
+	a.receive(a.expect("ack"))
+	if m := v.expect("op"); m.Client != a.id {
+		t.Fatalf("got %+v", m)
+	}
+
+	// nor can the id be had once a is gone
+	a.conn.Close()
+	v.expect("presence")
+	e := dial(t, srv, editor, "?client="+a.id+"&rev=1")
+	if m := e.expect("init"); m.Self == a.id {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestStaleRevResyncs(t *testing.T) {
+	srv, _, _ := newTestServer(t, "hello")
+
+	a := join(t, srv, owner)
+	a.edit(op(t, `[5, "!"]`))
+	a.receive(a.expect("ack"))
+
+	// an op from a revision the session never had
+	a.seq++
+	a.send(Message{Type: "op", Rev: 42, Seq: a.seq, Op: ptr(op(t, `[6, "?"]`))})
+	m := a.expect("error")
+	if m.Error != ErrStaleRev.Error() || m.Seq != a.seq {
+		t.Fatalf("got %+v", m)
+	}
+	m = a.expect("init")
+	if *m.Text != "hello!" || m.Rev != 1 || m.Self != a.id {
+		t.Fatalf("got %+v", m)
+	}
+
+	// after the resync the client carries on from the new state
+	a.text, a.rev = *m.Text, m.Rev
+	a.edit(op(t, `[6, "?"]`))
+	if m := a.expect("ack"); m.Rev != 2 {
+		t.Fatalf("got %+v", m)
+	}
+}
+
+func TestViewerCannotEdit(t *testing.T) {
+	srv, _, _ := newTestServer(t, "hello")
+
+	v := dial(t, srv, viewer, "")
+	if m := v.expect("init"); m.CanEdit {
+		t.Fatalf("got %+v", m)
+	}
+	v.send(Message{Type: "op", Rev: 0, Seq: 1, Op: ptr(op(t, `[5, "!"]`))})
+	if m := v.expect("error"); m.Error != ErrReadOnly.Error() {
+		t.Fatalf("got %+v", m)
+	}
+
+	// strangers are turned away before the upgrade
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/notes/7/ws"
+	_, resp, err := websocket.DefaultDialer.Dial(url, http.Header{"X-User": {"99"}})
+	if err == nil || resp == nil || resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("stranger: %v %v", resp, err)
+	}
+}
+
+func ptr[T any](v T) *T { return &v }
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
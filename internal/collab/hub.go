@@ -0,0 +1,469 @@
+package collab
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/tmsankram/gonotes/internal/notes"
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+// ErrReadOnly is returned for edits from users who may only read the note.
+var ErrReadOnly = errors.New("you can only view this note")
+
+// Presence states a client can report.
+const (
+	StateViewing = "viewing"
+	StateTyping  = "typing"
+)
+
+// saveAttempts bounds how often a save is retried after merging in a
+// version of the note that was saved outside the session.
+const saveAttempts = 3
+
+// sendBuffer is how many messages may queue up for a client before it is
+// considered too slow and dropped.
+const sendBuffer = 64
+
+// Store is what the hub needs from the notes service.
+type Store interface {
+	GetByID(userID uint, id int64) (notes.Note, error)
+	CanEdit(userID uint, id int64) (bool, error)
+	Update(userID uint, id int64, data notes.Note, tags []string) (notes.Note, error)
+}
+
+// Users looks up the names shown in presence lists.
+type Users interface {
+	GetByID(id uint) (users.User, error)
+}
+
+// Message is sent in both directions. Clients send "op" and "presence";
+// the server sends "init", "op", "ack", "presence", "saved" and "error".
+type Message struct {
+	Type string `json:"type"`
+	Rev  int    `json:"rev"`
+
+	// op
+	Op     *Op    `json:"op,omitempty"`
+	Seq    int    `json:"seq,omitempty"`
+	Client string `json:"client,omitempty"`
+
+	// init
+	Title   string  `json:"title,omitempty"`
+	Text    *string `json:"text,omitempty"`
+	CanEdit bool    `json:"can_edit,omitempty"`
+	Self    string  `json:"self,omitempty"`
+
+	// presence
+	State  string `json:"state,omitempty"`
+	Cursor *int   `json:"cursor,omitempty"`
+	Peers  []Peer `json:"peers,omitempty"`
+
+	// saved
+	Version int64 `json:"version,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
+
+// Peer is one connection in a presence list.
+type Peer struct {
+	Client string `json:"client"`
+	UserID uint   `json:"user_id"`
+	Name   string `json:"name"`
+	State  string `json:"state"`
+	Cursor int    `json:"cursor"`
+}
+
+// Client is one connection to a note's editing session. Messages for it
+// arrive on Messages, which is closed once the client left or was dropped.
+type Client struct {
+	ID     string
+	UserID uint
+
+	name    string
+	canEdit bool
+	state   string
+	cursor  int
+
+	send    chan Message
+	session *session
+	gone    bool
+}
+
+// Messages returns the channel the hub delivers messages to the client on.
+func (c *Client) Messages() <-chan Message {
+	return c.send
+}
+
+// CanEdit reports whether the client's ops are accepted.
+func (c *Client) CanEdit() bool {
+	return c.canEdit
+}
+
+// Hub keeps one editing session per note that has clients connected.
+// Edits are saved through the Store SaveDelay after the last change and
+// when the last client leaves.
+type Hub struct {
+	store     Store
+	users     Users
+	SaveDelay time.Duration
+
+	mu       sync.Mutex
+	sessions map[int64]*session
+}
+
+func NewHub(store Store, usersSvc Users) *Hub {
+	return &Hub{
+		store:     store,
+		users:     usersSvc,
+		SaveDelay: 2 * time.Second,
+		sessions:  map[int64]*session{},
+	}
+}
+
+type session struct {
+	hub *Hub
+
+	mu      sync.Mutex
+	doc     *document
+	clients []*Client
+	// owners maps the client ids used in the session to their user.
+	owners map[string]uint
+	timer  *time.Timer
+	closed bool
+}
+
+// Join connects a user to the session of a note, starting the session if
+// needed. A client that reconnects passes its previous id and the last
+// revision it saw; it is sent the ops it missed, or a fresh "init" if the
+// session no longer has them. New clients pass an empty id and rev -1.
+func (h *Hub) Join(userID uint, noteID int64, clientID string, rev int) (*Client, error) {
+	n, err := h.store.GetByID(userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+	canEdit, err := h.store.CanEdit(userID, noteID)
+	if err != nil {
+		return nil, err
+	}
+
+	if clientID == "" {
+		if clientID, err = newClientID(); err != nil {
+			return nil, err
+		}
+	}
+
+	c := &Client{
+		ID:      clientID,
+		UserID:  userID,
+		name:    h.name(userID),
+		canEdit: canEdit,
+		state:   StateViewing,
+		send:    make(chan Message, sendBuffer),
+	}
+
+	for {
+		s := h.session(n)
+
+		s.mu.Lock()
+		if !s.closed {
+			err := s.join(c, rev)
+			s.mu.Unlock()
+			if err != nil {
+				return nil, err
+			}
+			return c, nil
+		}
+
+		// The last client left while we were joining. Its edits are saved
+		// by now, so start a new session from the stored note.
+		h.mu.Lock()
+		if h.sessions[noteID] == s {
+			delete(h.sessions, noteID)
+		}
+		h.mu.Unlock()
+		s.mu.Unlock()
+
+		if n, err = h.store.GetByID(userID, noteID); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Handle processes a message from a client.
+func (h *Hub) Handle(c *Client, m Message) {
+	s := c.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if c.gone {
+		return
+	}
+
+	switch m.Type {
+	case "op":
+		s.op(c, m)
+	case "presence":
+		if m.State == StateViewing || m.State == StateTyping {
+			c.state = m.State
+		}
+		if m.Cursor != nil {
+			c.cursor = min(max(*m.Cursor, 0), len([]rune(s.doc.text)))
+		}
+		s.broadcastPresence()
+	default:
+		s.sendTo(c, Message{Type: "error", Error: "unknown message type " + m.Type})
+	}
+}
+
+// Leave disconnects a client. When it was the last one, pending edits are
+// saved and the session ends.
+func (h *Hub) Leave(c *Client) {
+	s := c.session
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !c.gone {
+		s.remove(c)
+		s.broadcastPresence()
+	}
+	if len(s.clients) > 0 || s.closed {
+		return
+	}
+
+	s.closed = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.save()
+
+	h.mu.Lock()
+	if h.sessions[s.doc.noteID] == s {
+		delete(h.sessions, s.doc.noteID)
+	}
+	h.mu.Unlock()
+}
+
+func (h *Hub) session(n notes.Note) *session {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s, ok := h.sessions[n.ID]
+	if !ok {
+		s = &session{hub: h, doc: newDocument(n), owners: map[string]uint{}}
+		h.sessions[n.ID] = s
+	}
+	return s
+}
+
+func (h *Hub) name(userID uint) string {
+	if h.users == nil {
+		return ""
+	}
+	u, err := h.users.GetByID(userID)
+	if err != nil {
+		return ""
+	}
+	if u.Name != "" {
+		return u.Name
+	}
+	return u.Email
+}
+
+func newClientID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// join adds c to the session and catches it up. An older connection with
+// the same client id is dropped first. Client ids are no secret, so a
+// client whose id another user has had in the session gets a new one
+// rather than taking over that user's connection and ops.
+func (s *session) join(c *Client, rev int) error {
+	if userID, ok := s.owners[c.ID]; ok && userID != c.UserID {
+		id, err := newClientID()
+		if err != nil {
+			return err
+		}
+		c.ID, rev = id, -1
+	}
+	s.owners[c.ID] = c.UserID
+
+	for _, old := range s.clients {
+		if old.ID == c.ID {
+			s.remove(old)
+			break
+		}
+	}
+	c.session = s
+	s.clients = append(s.clients, c)
+
+	// a long replay would overflow the send buffer; start over instead
+	missed, ok := s.doc.since(rev)
+	if rev < 0 || !ok || len(missed) > sendBuffer/2 {
+		s.sendInit(c)
+	} else {
+		for i, e := range missed {
+			op := e.op
+			s.sendTo(c, Message{Type: "op", Rev: rev + i + 1, Op: &op, Client: e.client, Seq: e.seq})
+		}
+	}
+	s.broadcastPresence()
+	return nil
+}
+
+func (s *session) sendInit(c *Client) {
+	text := s.doc.text
+	s.sendTo(c, Message{
+		Type:    "init",
+		Rev:     s.doc.rev,
+		Title:   s.doc.title,
+		Text:    &text,
+		CanEdit: c.canEdit,
+		Self:    c.ID,
+		Peers:   s.peers(),
+	})
+}
+
+func (s *session) op(c *Client, m Message) {
+	if !c.canEdit {
+		s.sendTo(c, Message{Type: "error", Seq: m.Seq, Error: ErrReadOnly.Error()})
+		return
+	}
+	if m.Op == nil {
+		s.sendTo(c, Message{Type: "error", Seq: m.Seq, Error: ErrBadOp.Error()})
+		return
+	}
+
+	op, rev, dup, err := s.doc.submit(c.ID, m.Seq, m.Rev, *m.Op)
+	if errors.Is(err, ErrStaleRev) {
+		s.sendTo(c, Message{Type: "error", Seq: m.Seq, Error: err.Error()})
+		s.sendInit(c)
+		return
+	}
+	if err != nil {
+		s.sendTo(c, Message{Type: "error", Seq: m.Seq, Error: err.Error()})
+		return
+	}
+	if dup {
+		s.sendTo(c, Message{Type: "ack", Rev: rev, Seq: m.Seq})
+		return
+	}
+
+	s.doc.lastEditor = c.UserID
+	s.shiftCursors(op, c)
+	s.sendTo(c, Message{Type: "ack", Rev: rev, Seq: m.Seq})
+	s.broadcast(Message{Type: "op", Rev: rev, Op: &op, Client: c.ID, Seq: m.Seq}, c)
+	s.scheduleSave()
+}
+
+// shiftCursors moves the cursors of everyone but the author along with
+// an op.
+func (s *session) shiftCursors(op Op, author *Client) {
+	for _, c := range s.clients {
+		if c != author {
+			c.cursor = op.TransformIndex(c.cursor)
+		}
+	}
+}
+
+func (s *session) scheduleSave() {
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.timer = time.AfterFunc(s.hub.SaveDelay, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if !s.closed {
+			s.save()
+		}
+	})
+}
+
+// save stores the document through the Store. If the note was changed
+// outside the session in the meantime, that change is merged in and sent
+// to the clients before trying again.
+func (s *session) save() {
+	d := s.doc
+	for i := 0; i < saveAttempts && d.dirty(); i++ {
+		n, err := s.hub.store.Update(d.lastEditor, d.noteID, notes.Note{
+			Title:   d.title,
+			Content: d.text,
+			Version: d.version,
+		}, nil)
+		if err == nil {
+			d.saved(n)
+			s.broadcast(Message{Type: "saved", Rev: d.rev, Version: n.Version}, nil)
+			return
+		}
+		if !errors.Is(err, notes.ErrVersionConflict) {
+			log.Printf("collab: saving note %d: %v", d.noteID, err)
+			return
+		}
+
+		cur, err := s.hub.store.GetByID(d.lastEditor, d.noteID)
+		if err != nil {
+			log.Printf("collab: reloading note %d: %v", d.noteID, err)
+			return
+		}
+		op, err := d.merge(cur)
+		if err != nil {
+			log.Printf("collab: merging note %d: %v", d.noteID, err)
+			return
+		}
+		s.shiftCursors(op, nil)
+		s.broadcast(Message{Type: "op", Rev: d.rev, Op: &op}, nil)
+	}
+}
+
+func (s *session) peers() []Peer {
+	peers := make([]Peer, len(s.clients))
+	for i, c := range s.clients {
+		peers[i] = Peer{Client: c.ID, UserID: c.UserID, Name: c.name, State: c.state, Cursor: c.cursor}
+	}
+	return peers
+}
+
+func (s *session) broadcastPresence() {
+	s.broadcast(Message{Type: "presence", Rev: s.doc.rev, Peers: s.peers()}, nil)
+}
+
+// broadcast sends m to every client but skip.
+func (s *session) broadcast(m Message, skip *Client) {
+	for _, c := range append([]*Client(nil), s.clients...) {
+		if c != skip {
+			s.sendTo(c, m)
+		}
+	}
+}
+
+// sendTo queues m for c without blocking. Clients that fall too far
+// behind are dropped; they can reconnect and resync.
+func (s *session) sendTo(c *Client, m Message) {
+	if c.gone {
+		return
+	}
+	select {
+	case c.send <- m:
+	default:
+		s.remove(c)
+	}
+}
+
+func (s *session) remove(c *Client) {
+	for i, other := range s.clients {
+		if other == c {
+			s.clients = append(s.clients[:i], s.clients[i+1:]...)
+			break
+		}
+	}
+	c.gone = true
+	close(c.send)
+}
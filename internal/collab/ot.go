@@ -0,0 +1,281 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+// ErrBadOp is returned for operations that do not fit the document.
+var ErrBadOp = errors.New("operation does not match the document")
+
+type compKind int
+
+const (
+	retain compKind = iota
+	insert
+	del
+)
+
+type component struct {
+	kind compKind
+	n    int    // retain and del, in runes
+	s    string // insert
+}
+
+func (c component) len() int {
+	if c.kind == insert {
+		return utf8.RuneCountInString(c.s)
+	}
+	return c.n
+}
+
+// Op is a text operation in the style of ot.js: a sequence of retains,
+// inserts and deletes that walks over the whole document. Lengths count
+// Unicode code points.
+//
+// On the wire an Op is a JSON array where a positive number retains, a
+// negative number deletes and a string inserts, e.g. [5, "hi", -2, 10].
+type Op struct {
+	comps     []component
+	baseLen   int
+	targetLen int
+}
+
+// Retain skips n runes.
+func (o *Op) Retain(n int) *Op {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	o.targetLen += n
+	if last := len(o.comps) - 1; last >= 0 && o.comps[last].kind == retain {
+		o.comps[last].n += n
+		return o
+	}
+	o.comps = append(o.comps, component{kind: retain, n: n})
+	return o
+}
+
+// Insert inserts s at the current position.
+func (o *Op) Insert(s string) *Op {
+	if s == "" {
+		return o
+	}
+	o.targetLen += utf8.RuneCountInString(s)
+
+	last := len(o.comps) - 1
+	switch {
+	case last >= 0 && o.comps[last].kind == insert:
+		o.comps[last].s += s
+	case last >= 0 && o.comps[last].kind == del:
+		// keep inserts before deletes so equal ops have one form
+		if last > 0 && o.comps[last-1].kind == insert {
+			o.comps[last-1].s += s
+		} else {
+			o.comps = append(o.comps, o.comps[last])
+			o.comps[last] = component{kind: insert, s: s}
+		}
+	default:
+		o.comps = append(o.comps, component{kind: insert, s: s})
+	}
+	return o
+}
+
+// Delete removes n runes.
+func (o *Op) Delete(n int) *Op {
+	if n <= 0 {
+		return o
+	}
+	o.baseLen += n
+	if last := len(o.comps) - 1; last >= 0 && o.comps[last].kind == del {
+		o.comps[last].n += n
+		return o
+	}
+	o.comps = append(o.comps, component{kind: del, n: n})
+	return o
+}
+
+// BaseLen is the length of the documents the op applies to.
+func (o Op) BaseLen() int { return o.baseLen }
+
+// TargetLen is the length of the document after applying the op.
+func (o Op) TargetLen() int { return o.targetLen }
+
+// IsNoop reports whether applying the op leaves every document unchanged.
+func (o Op) IsNoop() bool {
+	return len(o.comps) == 0 || (len(o.comps) == 1 && o.comps[0].kind == retain)
+}
+
+// Apply runs the op over doc.
+func (o Op) Apply(doc string) (string, error) {
+	runes := []rune(doc)
+	if len(runes) != o.baseLen {
+		return "", ErrBadOp
+	}
+
+	out := make([]rune, 0, o.targetLen)
+	pos := 0
+	for _, c := range o.comps {
+		switch c.kind {
+		case retain:
+			out = append(out, runes[pos:pos+c.n]...)
+			pos += c.n
+		case insert:
+			out = append(out, []rune(c.s)...)
+		case del:
+			pos += c.n
+		}
+	}
+	return string(out), nil
+}
+
+// TransformIndex moves a cursor position in the base document to the
+// matching position after the op.
+func (o Op) TransformIndex(idx int) int {
+	pos, out := 0, idx
+	for _, c := range o.comps {
+		if pos > idx {
+			break
+		}
+		switch c.kind {
+		case retain:
+			pos += c.n
+		case insert:
+			out += c.len()
+		case del:
+			out -= min(c.n, idx-pos)
+			pos += c.n
+		}
+	}
+	return out
+}
+
+// Transform takes two ops a and b made concurrently on the same document
+// and returns a' and b' such that applying a then b' gives the same text
+// as applying b then a'. When both insert at the same spot, a's insert
+// ends up first.
+func Transform(a, b Op) (Op, Op, error) {
+	var ap, bp Op
+	if a.baseLen != b.baseLen {
+		return ap, bp, ErrBadOp
+	}
+
+	ai, bi := 0, 0
+	var ca, cb *component
+	next := func(comps []component, i *int) *component {
+		if *i >= len(comps) {
+			return nil
+		}
+		c := comps[*i]
+		*i++
+		return &c
+	}
+	ca, cb = next(a.comps, &ai), next(b.comps, &bi)
+
+	for ca != nil || cb != nil {
+		if ca != nil && ca.kind == insert {
+			ap.Insert(ca.s)
+			bp.Retain(ca.len())
+			ca = next(a.comps, &ai)
+			continue
+		}
+		if cb != nil && cb.kind == insert {
+			ap.Retain(cb.len())
+			bp.Insert(cb.s)
+			cb = next(b.comps, &bi)
+			continue
+		}
+		if ca == nil || cb == nil {
+			return Op{}, Op{}, ErrBadOp
+		}
+
+		n := min(ca.n, cb.n)
+		switch {
+		case ca.kind == retain && cb.kind == retain:
+			ap.Retain(n)
+			bp.Retain(n)
+		case ca.kind == del && cb.kind == del:
+			// both removed the same text
+		case ca.kind == del && cb.kind == retain:
+			ap.Delete(n)
+		case ca.kind == retain && cb.kind == del:
+			bp.Delete(n)
+		}
+
+		ca.n -= n
+		cb.n -= n
+		if ca.n == 0 {
+			ca = next(a.comps, &ai)
+		}
+		if cb.n == 0 {
+			cb = next(b.comps, &bi)
+		}
+	}
+	return ap, bp, nil
+}
+
+// Diff returns an op that turns from into to. It keeps the common prefix
+// and suffix and replaces what is in between, which is all an external
+// save needs to be merged into a live document.
+func Diff(from, to string) Op {
+	a, b := []rune(from), []rune(to)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var op Op
+	op.Retain(prefix)
+	op.Insert(string(b[prefix : len(b)-suffix]))
+	op.Delete(len(a) - prefix - suffix)
+	op.Retain(suffix)
+	return op
+}
+
+func (o Op) MarshalJSON() ([]byte, error) {
+	out := make([]any, len(o.comps))
+	for i, c := range o.comps {
+		switch c.kind {
+		case retain:
+			out[i] = c.n
+		case insert:
+			out[i] = c.s
+		case del:
+			out[i] = -c.n
+		}
+	}
+	return json.Marshal(out)
+}
+
+func (o *Op) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*o = Op{}
+	for _, r := range raw {
+		var s string
+		if err := json.Unmarshal(r, &s); err == nil {
+			o.Insert(s)
+			continue
+		}
+		var n int
+		if err := json.Unmarshal(r, &n); err != nil || n == 0 {
+			return fmt.Errorf("invalid op component %s", r)
+		}
+		if n > 0 {
+			o.Retain(n)
+		} else {
+			o.Delete(-n)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+package collab
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// op builds an Op from its wire form.
+func op(t *testing.T, wire string) Op {
+	t.Helper()
+	var o Op
+	if err := json.Unmarshal([]byte(wire), &o); err != nil {
+		t.Fatalf("op %s: %v", wire, err)
+	}
+	return o
+}
+
+func wire(t *testing.T, o Op) string {
+	t.Helper()
+	b, err := json.Marshal(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestOpJSON(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`[5, "hi", -2, 10]`, `[5,"hi",-2,10]`},
+		{`[]`, `[]`},
+		// adjacent components of one kind are joined, inserts go before deletes
+		{`[1, 2, "a", "b", -1, -1]`, `[3,"ab",-2]`},
+		{`[-2, "x"]`, `["x",-2]`},
+	}
+	for _, tt := range tests {
+		if got := wire(t, op(t, tt.in)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+
+	for _, bad := range []string{`[0]`, `[true]`, `{}`, `[1.5]`} {
+		var o Op
+		if err := json.Unmarshal([]byte(bad), &o); err == nil {
+			t.Errorf("%s: expected an error", bad)
+		}
+	}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		doc, op, want string
+		err           error
+	}{
+		{"hello", `[5, " world"]`, "hello world", nil},
+		{"hello world", `[5, -6]`, "hello", nil},
+		{"hello", `["oh ", 5]`, "oh hello", nil},
+		{"héllo", `[1, "e", -1, 3]`, "hello", nil},
+		{"hello", `[4]`, "", ErrBadOp},
+		{"hello", `[6]`, "", ErrBadOp},
+	}
+	for _, tt := range tests {
+		got, err := op(t, tt.op).Apply(tt.doc)
+		if !errors.Is(err, tt.err) || got != tt.want {
+			t.Errorf("%q %s: got %q, %v; want %q, %v", tt.doc, tt.op, got, err, tt.want, tt.err)
+		}
+	}
+}
+
+func TestTransform(t *testing.T) {
+	tests := []struct {
+		name, doc, a, b string
+		want            string
+	}{
+		{"inserts apart", "hello world", `["A", 11]`, `[11, "B"]`, "Ahello worldB"},
+		{"same spot puts a first", "ab", `[1, "X", 1]`, `[1, "Y", 1]`, "aXYb"},
+		{"insert inside delete", "hello world", `[5, -6]`, `[8, "!", 3]`, "hello!"},
+		{"overlapping deletes", "abcdef", `[1, -3, 2]`, `[2, -3, 1]`, "af"},
+		{"same delete", "abc", `[1, -1, 1]`, `[1, -1, 1]`, "ac"},
+		{"delete and insert at end", "abc", `[-3]`, `[3, "d"]`, "d"},
+		{"noop", "abc", `[3]`, `[1, "x", 2]`, "axbc"},
+		{"unicode", "日本語", `[1, "x", 2]`, `[2, -1]`, "日x本"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := op(t, tt.a), op(t, tt.b)
+			ap, bp, err := Transform(a, b)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a then b' and b then a' must meet
+			viaA, err := a.Apply(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if viaA, err = bp.Apply(viaA); err != nil {
+				t.Fatal(err)
+			}
+			viaB, err := b.Apply(tt.doc)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if viaB, err = ap.Apply(viaB); err != nil {
+				t.Fatal(err)
+			}
+
+			if viaA != viaB {
+				t.Fatalf("diverged: %q vs %q", viaA, viaB)
+			}
+			if viaA != tt.want {
+				t.Fatalf("got %q, want %q", viaA, tt.want)
+			}
+		})
+	}
+
+	if _, _, err := Transform(op(t, `[3]`), op(t, `[4]`)); !errors.Is(err, ErrBadOp) {
+		t.Fatalf("different base lengths: got %v", err)
+	}
+}
+
+func TestTransformIndex(t *testing.T) {
+	tests := []struct {
+		op        string
+		idx, want int
+	}{
+		{`["ab", 5]`, 0, 2},
+		{`["ab", 5]`, 3, 5},
+		{`[3, "ab", 2]`, 2, 2},
+		{`[3, "ab", 2]`, 4, 6},
+		{`[1, -3, 1]`, 2, 1},
+		{`[1, -3, 1]`, 5, 2},
+	}
+	for _, tt := range tests {
+		if got := op(t, tt.op).TransformIndex(tt.idx); got != tt.want {
+			t.Errorf("%s at %d: got %d, want %d", tt.op, tt.idx, got, tt.want)
+		}
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		from, to, want string
+	}{
+		{"hello", "hello", `[5]`},
+		{"", "hello", `["hello"]`},
+		{"hello", "", `[-5]`},
+		{"hello world", "hello there world", `[6,"there ",5]`},
+		{"hello world", "hello", `[5,-6]`},
+		{"abcdef", "abXYef", `[2,"XY",-2,2]`},
+		{"aaa", "aaaa", `[3,"a"]`},
+		{"héllo", "hällo", `[1,"ä",-1,3]`},
+	}
+	for _, tt := range tests {
+		d := Diff(tt.from, tt.to)
+		if got := wire(t, d); got != tt.want {
+			t.Errorf("Diff(%q, %q) = %s, want %s", tt.from, tt.to, got, tt.want)
+		}
+		if got, err := d.Apply(tt.from); err != nil || got != tt.to {
+			t.Errorf("Diff(%q, %q) applies to %q, %v", tt.from, tt.to, got, err)
+		}
+	}
+}
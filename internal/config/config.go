@@ -4,6 +4,8 @@ import (
 	"log"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -24,6 +26,44 @@ type Config struct {
 	GithubClientID     string
 	GithubClientSecret string
 	GithubRedirectURL  string
+
+	// NoteRevisionRetention is how many revisions are kept per note (0 keeps all).
+	NoteRevisionRetention int
+
+	// TrashRetention is how long deleted notes stay in the trash before they are purged.
+	TrashRetention time.Duration
+
+	// UploadDir is where uploaded files are stored.
+	UploadDir string
+	// OrphanFilesOwner adopts files found in UploadDir without metadata at
+	// startup; 0 only reports them.
+	OrphanFilesOwner uint
+
+	// BlobBackend picks where file content is stored: "local" keeps it in
+	// UploadDir, "s3" in the S3-compatible bucket configured below.
+	BlobBackend string
+	S3Endpoint  string
+	S3Bucket    string
+	S3AccessKey string
+	S3SecretKey string
+	S3Region    string
+	S3UseSSL    bool
+	// PresignExpiry is how long presigned download URLs stay valid.
+	PresignExpiry time.Duration
+
+	// StorageQuota is how many bytes of files each user may keep and
+	// MaxFileSize how large a single file may be, unless an admin set
+	// other limits for the user. 0 means unlimited.
+	StorageQuota int64
+	MaxFileSize  int64
+
+	// AdminUsers are the ids of the users who may manage other users'
+	// quotas.
+	AdminUsers []uint
+
+	// WebhookAllowPrivate lets webhooks deliver to loopback, link-local
+	// and private addresses, for receivers on the same network.
+	WebhookAllowPrivate bool
 }
 
 func Load() *Config {
@@ -41,6 +81,66 @@ func Load() *Config {
 		log.Fatalf("Invalid DB_PORT: %v", err)
 	}
 
+	revisionsStr := getEnv("NOTE_REVISION_RETENTION", "50")
+	revisions, err := strconv.Atoi(revisionsStr)
+	if err != nil {
+		log.Fatalf("Invalid NOTE_REVISION_RETENTION: %v", err)
+	}
+
+	trashDaysStr := getEnv("TRASH_RETENTION_DAYS", "30")
+	trashDays, err := strconv.Atoi(trashDaysStr)
+	if err != nil {
+		log.Fatalf("Invalid TRASH_RETENTION_DAYS: %v", err)
+	}
+
+	orphanOwnerStr := getEnv("ORPHAN_FILES_OWNER", "0")
+	orphanOwner, err := strconv.ParseUint(orphanOwnerStr, 10, 0)
+	if err != nil {
+		log.Fatalf("Invalid ORPHAN_FILES_OWNER: %v", err)
+	}
+
+	s3SSLStr := getEnv("S3_USE_SSL", "true")
+	s3SSL, err := strconv.ParseBool(s3SSLStr)
+	if err != nil {
+		log.Fatalf("Invalid S3_USE_SSL: %v", err)
+	}
+
+	presignStr := getEnv("PRESIGN_EXPIRY", "15m")
+	presign, err := time.ParseDuration(presignStr)
+	if err != nil {
+		log.Fatalf("Invalid PRESIGN_EXPIRY: %v", err)
+	}
+
+	quotaStr := getEnv("STORAGE_QUOTA_BYTES", "1073741824")
+	quota, err := strconv.ParseInt(quotaStr, 10, 64)
+	if err != nil || quota < 0 {
+		log.Fatalf("Invalid STORAGE_QUOTA_BYTES: %q", quotaStr)
+	}
+
+	maxFileStr := getEnv("MAX_FILE_SIZE_BYTES", "104857600")
+	maxFile, err := strconv.ParseInt(maxFileStr, 10, 64)
+	if err != nil || maxFile < 0 {
+		log.Fatalf("Invalid MAX_FILE_SIZE_BYTES: %q", maxFileStr)
+	}
+
+	webhookPrivateStr := getEnv("WEBHOOK_ALLOW_PRIVATE", "false")
+	webhookPrivate, err := strconv.ParseBool(webhookPrivateStr)
+	if err != nil {
+		log.Fatalf("Invalid WEBHOOK_ALLOW_PRIVATE: %v", err)
+	}
+
+	var admins []uint
+	for _, idStr := range strings.Split(getEnv("ADMIN_USERS", ""), ",") {
+		if idStr = strings.TrimSpace(idStr); idStr == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(idStr, 10, 0)
+		if err != nil {
+			log.Fatalf("Invalid ADMIN_USERS: %v", err)
+		}
+		admins = append(admins, uint(id))
+	}
+
 	return &Config{
 		Port: port,
 
@@ -57,6 +157,27 @@ func Load() *Config {
 		GithubClientID:     getEnv("GITHUB_CLIENT_ID", ""),
 		GithubClientSecret: getEnv("GITHUB_CLIENT_SECRET", ""),
 		GithubRedirectURL:  getEnv("GITHUB_REDIRECT_URL", ""),
+
+		NoteRevisionRetention: revisions,
+		TrashRetention:        time.Duration(trashDays) * 24 * time.Hour,
+
+		UploadDir:        getEnv("UPLOAD_DIR", "uploads"),
+		OrphanFilesOwner: uint(orphanOwner),
+
+		BlobBackend:   getEnv("BLOB_BACKEND", "local"),
+		S3Endpoint:    getEnv("S3_ENDPOINT", ""),
+		S3Bucket:      getEnv("S3_BUCKET", ""),
+		S3AccessKey:   getEnv("S3_ACCESS_KEY", ""),
+		S3SecretKey:   getEnv("S3_SECRET_KEY", ""),
+		S3Region:      getEnv("S3_REGION", ""),
+		S3UseSSL:      s3SSL,
+		PresignExpiry: presign,
+
+		StorageQuota: quota,
+		MaxFileSize:  maxFile,
+		AdminUsers:   admins,
+
+		WebhookAllowPrivate: webhookPrivate,
 	}
 }
 
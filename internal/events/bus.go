@@ -0,0 +1,162 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event types published by the services.
+const (
+	NoteCreated = "note.created"
+	NoteUpdated = "note.updated"
+	NoteDeleted = "note.deleted"
+	FileCreated = "file.created"
+	FileDeleted = "file.deleted"
+)
+
+// subscriberBuffer is how many events may queue up for a subscriber
+// before it is considered too slow and dropped.
+const subscriberBuffer = 64
+
+// Event is something that changed. Users lists who may see it; nil means
+// every user.
+type Event struct {
+	ID    uint64    `json:"id"`
+	Type  string    `json:"type"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data"`
+	Users []uint    `json:"-"`
+}
+
+// For reports whether userID may see the event.
+func (e Event) For(userID uint) bool {
+	if e.Users == nil {
+		return true
+	}
+	for _, id := range e.Users {
+		if id == userID {
+			return true
+		}
+	}
+	return false
+}
+
+// Bus fans events out to subscribers and keeps the most recent ones so
+// that subscribers can catch up after reconnecting. A nil *Bus drops
+// everything, which keeps publishing optional for the services.
+type Bus struct {
+	mu     sync.Mutex
+	next   uint64
+	buffer []Event
+	size   int
+	subs   map[*Subscription]struct{}
+}
+
+// NewBus returns a bus that remembers the last size events. Event ids
+// start from the current time so that ids handed out before a restart
+// are always older than the new ones.
+func NewBus(size int) *Bus {
+	return &Bus{
+		next: uint64(time.Now().UnixNano()),
+		size: size,
+		subs: map[*Subscription]struct{}{},
+	}
+}
+
+// Subscription receives the events for one user on C, which is closed
+// when the subscriber is dropped for falling behind or unsubscribed.
+type Subscription struct {
+	C <-chan Event
+	// Replay holds the buffered events after the id passed to Subscribe.
+	Replay []Event
+	// Missed is set when events after that id are no longer buffered, so
+	// the subscriber has to reload instead of relying on Replay.
+	Missed bool
+
+	c      chan Event
+	userID uint
+	all    bool
+}
+
+// Publish assigns e an id and delivers it.
+func (b *Bus) Publish(e Event) {
+	if b == nil {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	e.ID = b.next
+	b.next++
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.buffer = append(b.buffer, e)
+	if drop := len(b.buffer) - b.size; drop > 0 {
+		b.buffer = append(b.buffer[:0:0], b.buffer[drop:]...)
+	}
+
+	for s := range b.subs {
+		if !s.all && !e.For(s.userID) {
+			continue
+		}
+		select {
+		case s.c <- e:
+		default:
+			b.drop(s)
+		}
+	}
+}
+
+// Subscribe starts delivering userID's events. With resume set, the
+// buffered events after lastID are returned in Replay.
+func (b *Bus) Subscribe(userID uint, lastID uint64, resume bool) *Subscription {
+	return b.subscribe(&Subscription{userID: userID}, lastID, resume)
+}
+
+// SubscribeAll is Subscribe for consumers inside the server that see the
+// events of every user, such as webhook delivery.
+func (b *Bus) SubscribeAll(lastID uint64, resume bool) *Subscription {
+	return b.subscribe(&Subscription{all: true}, lastID, resume)
+}
+
+func (b *Bus) subscribe(s *Subscription, lastID uint64, resume bool) *Subscription {
+	s.c = make(chan Event, subscriberBuffer)
+	s.C = s.c
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if resume {
+		oldest := b.next
+		if len(b.buffer) > 0 {
+			oldest = b.buffer[0].ID
+		}
+		s.Missed = lastID+1 < oldest || lastID >= b.next
+
+		for _, e := range b.buffer {
+			if e.ID > lastID && (s.all || e.For(s.userID)) {
+				s.Replay = append(s.Replay, e)
+			}
+		}
+	}
+
+	b.subs[s] = struct{}{}
+	return s
+}
+
+// Unsubscribe stops delivering events to s.
+func (b *Bus) Unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[s]; ok {
+		b.drop(s)
+	}
+}
+
+func (b *Bus) drop(s *Subscription) {
+	delete(b.subs, s)
+	close(s.c)
+}
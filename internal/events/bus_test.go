@@ -0,0 +1,158 @@
+package events
+
+import (
+	"slices"
+	"testing"
+)
+
+const (
+	alice uint = 1
+	bob   uint = 2
+)
+
+func TestEventFor(t *testing.T) {
+	tests := []struct {
+		name  string
+		users []uint
+		want  bool
+	}{
+		{"everyone", nil, true},
+		{"listed", []uint{bob, alice}, true},
+		{"not listed", []uint{bob}, false},
+		{"nobody", []uint{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := (Event{Users: tt.users}).For(alice); got != tt.want {
+				t.Fatalf("got %v", got)
+			}
+		})
+	}
+}
+
+// received takes the events waiting on s without blocking.
+func received(s *Subscription) []Event {
+	var got []Event
+	for {
+		select {
+		case e, ok := <-s.C:
+			if !ok {
+				return got
+			}
+			got = append(got, e)
+		default:
+			return got
+		}
+	}
+}
+
+func types(events []Event) []string {
+	var got []string
+	for _, e := range events {
+		got = append(got, e.Type)
+	}
+	return got
+}
+
+func TestBusDeliversToUsers(t *testing.T) {
+	b := NewBus(10)
+	a, o, all := b.Subscribe(alice, 0, false), b.Subscribe(bob, 0, false), b.SubscribeAll(0, false)
+
+	b.Publish(Event{Type: NoteUpdated, Users: []uint{alice}})
+	b.Publish(Event{Type: FileCreated})
+	b.Publish(Event{Type: NoteDeleted, Users: []uint{bob}})
+
+	if got := types(received(a)); !slices.Equal(got, []string{NoteUpdated, FileCreated}) {
+		t.Fatalf("alice got %v", got)
+	}
+	if got := types(received(o)); !slices.Equal(got, []string{FileCreated, NoteDeleted}) {
+		t.Fatalf("bob got %v", got)
+	}
+	events := received(all)
+	if got := types(events); !slices.Equal(got, []string{NoteUpdated, FileCreated, NoteDeleted}) {
+		t.Fatalf("all got %v", got)
+	}
+	for i, e := range events {
+		if e.Time.IsZero() || i > 0 && e.ID != events[i-1].ID+1 {
+			t.Fatalf("event %d: %+v", i, e)
+		}
+	}
+
+	b.Unsubscribe(a)
+	b.Publish(Event{Type: NoteCreated, Users: []uint{alice}})
+	if _, ok := <-a.C; ok {
+		t.Fatal("delivered after unsubscribing")
+	}
+}
+
+func TestBusReplay(t *testing.T) {
+	b := NewBus(3)
+	all := b.SubscribeAll(0, false)
+	for _, users := range [][]uint{{alice}, {alice}, {bob}, {alice}, {alice}} {
+		b.Publish(Event{Type: NoteUpdated, Users: users})
+	}
+	ids := []uint64{}
+	for _, e := range received(all) {
+		ids = append(ids, e.ID)
+	}
+
+	tests := []struct {
+		name   string
+		lastID uint64
+		replay []uint64
+		missed bool
+	}{
+		// bob's event in between is not replayed to alice
+		{"buffered", ids[1], []uint64{ids[3], ids[4]}, false},
+		{"up to date", ids[4], nil, false},
+		// ids[1] fell out of the buffer
+		{"gone", ids[0], []uint64{ids[3], ids[4]}, true},
+		{"from the future", ids[4] + 10, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := b.Subscribe(alice, tt.lastID, true)
+			defer b.Unsubscribe(s)
+			var got []uint64
+			for _, e := range s.Replay {
+				got = append(got, e.ID)
+			}
+			if !slices.Equal(got, tt.replay) || s.Missed != tt.missed {
+				t.Fatalf("replay %v, missed %v", got, s.Missed)
+			}
+		})
+	}
+
+	if s := b.Subscribe(alice, ids[0], false); s.Replay != nil || s.Missed {
+		t.Fatalf("without resume: %+v", s)
+	}
+}
+
+func TestBusDropsSlowSubscriber(t *testing.T) {
+	b := NewBus(10)
+	slow, fast := b.Subscribe(alice, 0, false), b.Subscribe(alice, 0, false)
+
+	for range subscriberBuffer {
+		b.Publish(Event{Type: NoteUpdated})
+	}
+	received(fast)
+	b.Publish(Event{Type: NoteUpdated})
+
+	// the buffered events are still delivered, then the channel closes
+	if got := received(slow); len(got) != subscriberBuffer {
+		t.Fatalf("got %d events", len(got))
+	}
+	if _, ok := <-slow.C; ok {
+		t.Fatal("slow subscriber not dropped")
+	}
+	if got := received(fast); len(got) != 1 {
+		t.Fatalf("fast subscriber got %d events", len(got))
+	}
+	// unsubscribing after the drop is harmless
+	b.Unsubscribe(slow)
+}
+
+func TestNilBus(t *testing.T) {
+	var b *Bus
+	b.Publish(Event{Type: NoteCreated})
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// heartbeat keeps idle streams from being closed by proxies.
+const heartbeat = 25 * time.Second
+
+// Handler streams events to clients as Server-Sent Events.
+type Handler struct {
+	bus *Bus
+}
+
+func NewHandler(bus *Bus) *Handler {
+	return &Handler{bus: bus}
+}
+
+// Stream godoc
+// @Summary Event stream
+// @Description Server-Sent Events for changes to the caller's notes and to files. Reconnects with Last-Event-ID get the events they missed; if those are gone a "resync" event is sent first.
+// @Tags events
+// @Produce text/event-stream
+// @Param Last-Event-ID header string false "Id of the last event received"
+// @Success 200
+// @Failure 401 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /events [get]
+func (h *Handler) Stream(c *gin.Context) {
+	lastID, resume := lastEventID(c)
+	sub := h.bus.Subscribe(c.GetUint("userID"), lastID, resume)
+	defer h.bus.Unsubscribe(sub)
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("X-Accel-Buffering", "no")
+
+	w := c.Writer
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if sub.Missed {
+		fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+	}
+	for _, e := range sub.Replay {
+		if err := writeEvent(w, e); err != nil {
+			return
+		}
+	}
+	w.Flush()
+
+	ticker := time.NewTicker(heartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case e, ok := <-sub.C:
+			if !ok {
+				// dropped for falling behind; the client reconnects and
+				// catches up from the buffer
+				return
+			}
+			if err := writeEvent(w, e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		}
+		w.Flush()
+	}
+}
+
+// lastEventID reads the id browsers send when they reconnect. The
+// last_event_id query parameter does the same for clients that cannot set
+// headers.
+func lastEventID(c *gin.Context) (uint64, bool) {
+	v := c.GetHeader("Last-Event-ID")
+	if v == "" {
+		v = c.Query("last_event_id")
+	}
+	if v == "" {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(v, 10, 64)
+	if err != nil {
+		// unknown id, so everything may have been missed
+		return 0, true
+	}
+	return id, true
+}
+
+func writeEvent(w io.Writer, e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
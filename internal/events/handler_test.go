@@ -0,0 +1,146 @@
+package events
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestServer streams bus over SSE. The user comes from the X-User
+// header in place of a token.
+func newTestServer(t *testing.T, bus *Bus) *httptest.Server {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/events", func(c *gin.Context) {
+		id, _ := strconv.ParseUint(c.GetHeader("X-User"), 10, 64)
+		c.Set("userID", uint(id))
+	}, NewHandler(bus).Stream)
+
+	srv := httptest.NewServer(r)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// sseEvent is one event as read off the stream.
+type sseEvent struct {
+	id, typ string
+	data    Event
+}
+
+type stream struct {
+	t      *testing.T
+	resp   *http.Response
+	events chan sseEvent
+}
+
+// connect opens the stream and waits until it is subscribed.
+func connect(t *testing.T, srv *httptest.Server, userID uint, lastID string) *stream {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/events", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("X-User", strconv.Itoa(int(userID)))
+	if lastID != "" {
+		req.Header.Set("Last-Event-ID", lastID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("got %d, %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	s := &stream{t: t, resp: resp, events: make(chan sseEvent, 16)}
+	sc := bufio.NewScanner(resp.Body)
+	if !sc.Scan() || sc.Text() != "retry: 3000" {
+		t.Fatalf("got %q", sc.Text())
+	}
+	go func() {
+		defer close(s.events)
+		var e sseEvent
+		for sc.Scan() {
+			line := sc.Text()
+			switch {
+			case line == "":
+				if e.typ != "" {
+					s.events <- e
+				}
+				e = sseEvent{}
+			case strings.HasPrefix(line, "id: "):
+				e.id = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				e.typ = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &e.data)
+			}
+		}
+	}()
+	return s
+}
+
+func (s *stream) next() sseEvent {
+	s.t.Helper()
+	select {
+	case e, ok := <-s.events:
+		if !ok {
+			s.t.Fatal("stream ended")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		s.t.Fatal("timed out")
+	}
+	return sseEvent{}
+}
+
+func TestStream(t *testing.T) {
+	bus := NewBus(10)
+	srv := newTestServer(t, bus)
+	a, b := connect(t, srv, alice, ""), connect(t, srv, bob, "")
+
+	bus.Publish(Event{Type: NoteUpdated, Data: map[string]any{"id": 1}, Users: []uint{alice}})
+	bus.Publish(Event{Type: NoteUpdated, Data: map[string]any{"id": 2}, Users: []uint{bob}})
+	bus.Publish(Event{Type: FileCreated, Users: []uint{alice}})
+
+	// bob never sees alice's note
+	got := b.next()
+	if got.typ != NoteUpdated || got.data.Data.(map[string]any)["id"] != float64(2) {
+		t.Fatalf("bob got %+v", got)
+	}
+	first := a.next()
+	if first.typ != NoteUpdated || first.data.Data.(map[string]any)["id"] != float64(1) || first.id != strconv.FormatUint(first.data.ID, 10) {
+		t.Fatalf("alice got %+v", first)
+	}
+	if got := a.next(); got.typ != FileCreated {
+		t.Fatalf("alice got %+v", got)
+	}
+
+	// reconnecting after the first event replays the rest of alice's
+	a = connect(t, srv, alice, first.id)
+	if got := a.next(); got.typ != FileCreated {
+		t.Fatalf("replay got %+v", got)
+	}
+
+	// when the events are gone the client is told to reload
+	for range 10 {
+		bus.Publish(Event{Type: NoteCreated, Users: []uint{bob}})
+	}
+	a = connect(t, srv, alice, first.id)
+	if got := a.next(); got.typ != "resync" {
+		t.Fatalf("got %+v", got)
+	}
+	a = connect(t, srv, alice, "garbage")
+	if got := a.next(); got.typ != "resync" {
+		t.Fatalf("got %+v", got)
+	}
+}
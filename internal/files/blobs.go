@@ -0,0 +1,86 @@
+package files
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/tmsankram/gonotes/internal/storage"
+)
+
+// incomingPrefix holds uploads whose digest is not known yet.
+const incomingPrefix = "incoming/"
+
+// blobKey is where content with the hex SHA-256 digest is stored when
+// the upload gen brings it in first. Every blob has a key of its own, so
+// that content stored again after its blob was released never shares a
+// key with the old blob, whose object is only deleted after the release
+// committed.
+func blobKey(digest, gen string) string {
+	return "sha256/" + digest[:2] + "/" + digest + "-" + gen
+}
+
+func incomingKey(id string) string {
+	return incomingPrefix + id
+}
+
+// claimBlob records one more reference to stored content with b's digest
+// and returns its blob. Without one, b itself is recorded; its content
+// has to be at b.Key by then. The blob row stays locked until tx ends, so
+// a concurrent release of the last reference cannot remove it meanwhile.
+func claimBlob(tx *gorm.DB, b Blob) (Blob, error) {
+	var stored Blob
+	res := tx.Model(&stored).
+		Clauses(clause.Returning{}).
+		Where("key = (?)", tx.Model(&Blob{}).Select("key").Where("digest = ? AND refs > 0", b.Digest).Order("key").Limit(1)).
+		Update("refs", gorm.Expr("refs + 1"))
+	if res.Error != nil {
+		return Blob{}, res.Error
+	}
+	if res.RowsAffected > 0 {
+		return stored, nil
+	}
+
+	b.Refs = 1
+	err := tx.Create(&b).Error
+	return b, err
+}
+
+// releaseBlob drops a reference to the blob at key. Once none are left
+// its row goes and the key is returned: the caller deletes the content
+// after tx committed, as it is not needed any more either way.
+func releaseBlob(tx *gorm.DB, key string) (string, error) {
+	var b Blob
+	res := tx.Model(&b).
+		Clauses(clause.Returning{}).
+		Where("key = ?", key).
+		Update("refs", gorm.Expr("refs - 1"))
+	if res.Error != nil {
+		return "", res.Error
+	}
+	if res.RowsAffected > 0 && b.Refs > 0 {
+		return "", nil
+	}
+
+	if err := tx.Where("key = ?", key).Delete(&Blob{}).Error; err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// adopt makes sure the content of a file that shares the blob at key is
+// there, using the copy of it at own. It is called after the file was
+// committed; own is not referred to and is removed.
+func (s *Service) adopt(ctx context.Context, key, own string) error {
+	_, err := s.blobs.Stat(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		// the stored copy went missing
+		return s.blobs.Move(ctx, own, key)
+	}
+	if err != nil {
+		return err
+	}
+	return s.blobs.Delete(ctx, own)
+}
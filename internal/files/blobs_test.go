@@ -0,0 +1,186 @@
+package files
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/config"
+)
+
+var errInjected = errors.New("injected")
+
+// failOn makes statements of op on table fail until the test ends.
+func failOn(t *testing.T, db *gorm.DB, op, table string) {
+	t.Helper()
+	fail := func(tx *gorm.DB) {
+		if tx.Statement.Table == table {
+			tx.AddError(errInjected)
+		}
+	}
+	var err error
+	name := "test:fail_" + table
+	switch op {
+	case "create":
+		err = db.Callback().Create().Before("gorm:create").Register(name, fail)
+		t.Cleanup(func() { db.Callback().Create().Remove(name) })
+	case "delete":
+		err = db.Callback().Delete().Before("gorm:delete").Register(name, fail)
+		t.Cleanup(func() { db.Callback().Delete().Remove(name) })
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func blobRows(t *testing.T, db *gorm.DB) []Blob {
+	t.Helper()
+	var blobs []Blob
+	if err := db.Order("key").Find(&blobs).Error; err != nil {
+		t.Fatal(err)
+	}
+	return blobs
+}
+
+func content(t *testing.T, svc *Service, f File) string {
+	t.Helper()
+	r := svc.Open(context.Background(), f)
+	defer r.Close()
+	b, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestSharedBlobs(t *testing.T) {
+	store := newTestStore(t)
+	svc := newTestService(t, &config.Config{}, store)
+	ctx := context.Background()
+
+	a, err := svc.Save(ctx, 1, "a.txt", "text/plain", strings.NewReader("same content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := svc.Save(ctx, 2, "b.txt", "text/plain", strings.NewReader("same content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Path != b.Path || a.Checksum != b.Checksum {
+		t.Fatalf("not shared: %s and %s", a.Path, b.Path)
+	}
+	if blobs := blobRows(t, svc.db); len(blobs) != 1 || blobs[0].Refs != 2 {
+		t.Fatalf("blobs %+v", blobs)
+	}
+	if keys := store.keys(t); !slices.Equal(keys, []string{a.Path}) {
+		t.Fatalf("store has %v", keys)
+	}
+
+	if err := svc.Delete(ctx, 1, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(t, svc, b); got != "same content" {
+		t.Fatalf("got %q", got)
+	}
+	if err := svc.Delete(ctx, 2, b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if blobs, keys := blobRows(t, svc.db), store.keys(t); len(blobs) != 0 || len(keys) != 0 {
+		t.Fatalf("left %+v and %v", blobs, keys)
+	}
+
+	// stored again after the release, the content gets a key of its own
+	c, err := svc.Save(ctx, 1, "c.txt", "text/plain", strings.NewReader("same content"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Path == a.Path {
+		t.Fatalf("reused %s", c.Path)
+	}
+}
+
+func TestSharedBlobGoneMissing(t *testing.T) {
+	store := newTestStore(t)
+	svc := newTestService(t, &config.Config{}, store)
+	ctx := context.Background()
+
+	a, err := svc.Save(ctx, 1, "a.txt", "text/plain", strings.NewReader("precious"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Delete(ctx, a.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	// the next upload of the content brings it back
+	if _, err := svc.Save(ctx, 1, "b.txt", "text/plain", strings.NewReader("precious")); err != nil {
+		t.Fatal(err)
+	}
+	if got := content(t, svc, a); got != "precious" {
+		t.Fatalf("got %q", got)
+	}
+	if keys := store.keys(t); !slices.Equal(keys, []string{a.Path}) {
+		t.Fatalf("store has %v", keys)
+	}
+}
+
+func TestCreateRollback(t *testing.T) {
+	store := newTestStore(t)
+	svc := newTestService(t, &config.Config{}, store)
+	ctx := context.Background()
+
+	kept, err := svc.Save(ctx, 1, "kept.txt", "text/plain", strings.NewReader("shared"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failOn(t, svc.db, "create", "files")
+	for _, body := range []string{"new content", "shared"} {
+		if _, err := svc.Save(ctx, 1, "lost.txt", "text/plain", strings.NewReader(body)); !errors.Is(err, errInjected) {
+			t.Fatalf("%s: got %v", body, err)
+		}
+	}
+
+	// neither upload left content or references behind
+	if keys := store.keys(t); !slices.Equal(keys, []string{kept.Path}) {
+		t.Fatalf("store has %v", keys)
+	}
+	if blobs := blobRows(t, svc.db); len(blobs) != 1 || blobs[0].Refs != 1 {
+		t.Fatalf("blobs %+v", blobs)
+	}
+	if got := content(t, svc, kept); got != "shared" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestDeleteRollback(t *testing.T) {
+	store := newTestStore(t)
+	svc := newTestService(t, &config.Config{}, store)
+	ctx := context.Background()
+
+	f, err := svc.Save(ctx, 1, "a.txt", "text/plain", strings.NewReader("still here"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the last reference goes, but the transaction does not commit
+	failOn(t, svc.db, "delete", "blobs")
+	if err := svc.Delete(ctx, 1, f.ID); !errors.Is(err, errInjected) {
+		t.Fatalf("got %v", err)
+	}
+
+	if _, err := svc.Get(f.ID); err != nil {
+		t.Fatal(err)
+	}
+	if blobs := blobRows(t, svc.db); len(blobs) != 1 || blobs[0].Refs != 1 {
+		t.Fatalf("blobs %+v", blobs)
+	}
+	if got := content(t, svc, f); got != "still here" {
+		t.Fatalf("got %q", got)
+	}
+}
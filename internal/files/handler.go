@@ -2,85 +2,330 @@ package files
 
 import (
 	"errors"
+	"mime/multipart"
 	"net/http"
-	"os"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/pagination"
 	"github.com/tmsankram/gonotes/internal/response"
+	"github.com/tmsankram/gonotes/internal/storage"
 )
 
 type Handler struct {
-	svc *Service
+	svc    *Service
+	admins []uint
 }
 
-func NewHandler(svc *Service) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc *Service, cfg *config.Config) *Handler {
+	return &Handler{svc: svc, admins: cfg.AdminUsers}
 }
 
 func (h *Handler) RegisterRoutes(r *gin.Engine) {
 	g := r.Group("/files")
 	{
-		g.POST("/upload", h.upload)
-		g.GET("/", h.list)
+		g.POST("/upload", auth.AuthRequired(), h.upload)
+		g.GET("/", auth.AuthRequired(), h.list)
+		g.GET("/usage", auth.AuthRequired(), h.usage)
+		// download links are embedded in notes, which may be shared or
+		// public, so the unguessable id is all it takes
 		g.GET("/:id/download", h.download)
+		g.GET("/:id/url", h.url)
+		g.DELETE("/:id", auth.AuthRequired(), h.delete)
+		h.registerTusRoutes(g)
+
+		quotas := g.Group("/quotas", auth.AuthRequired(), auth.AdminRequired(h.admins))
+		quotas.GET("/:user", h.getQuota)
+		quotas.PUT("/:user", h.setQuota)
+		quotas.DELETE("/:user", h.resetQuota)
 	}
 }
 
+// PresignedURL is a direct download link into the blob store.
+type PresignedURL struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
 // UploadFile godoc
 // @Summary Upload file
-// @Description Upload a file
+// @Description Upload a file. It is streamed in and cut off with 413 once it exceeds the caller's maximum file size or storage quota.
 // @Tags files
 // @Accept multipart/form-data
 // @Produce json
 // @Param file formData file true "file to upload"
 // @Success 201 {object} files.File
 // @Failure 400 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
 // @Security ApiKeyAuth
 // @Router /files/upload [post]
 func (h *Handler) upload(c *gin.Context) {
-	fileHeader, err := c.FormFile("file")
+	// read the form part by part rather than with c.FormFile, which
+	// spools the whole body before the limits could be checked
+	form, err := c.Request.MultipartReader()
 	if err != nil {
-		response.BadRequest(c, errors.New("file required"))
+		response.BadRequest(c, errors.New("multipart form required"))
 		return
 	}
-	f, err := fileHeader.Open()
+	var part *multipart.Part
+	for {
+		part, err = form.NextPart()
+		if err != nil {
+			response.BadRequest(c, errors.New("file required"))
+			return
+		}
+		if part.FormName() == "file" && part.FileName() != "" {
+			break
+		}
+		part.Close()
+	}
+	defer part.Close()
 
-	if err != nil {
-		response.BadRequest(c, errors.New("cannot read file"))
+	result, err := h.svc.Save(c.Request.Context(), c.GetUint("userID"), part.FileName(), part.Header.Get("Content-Type"), part)
+	if errors.Is(err, ErrFileTooLarge) || errors.Is(err, ErrQuotaExceeded) {
+		// the rest of the body is not worth reading
+		c.Header("Connection", "close")
+		response.RequestEntityTooLarge(c, err)
 		return
 	}
-
-	defer f.Close()
-
-	result, err := h.svc.Save(fileHeader, f)
 	if err != nil {
-		response.Internal(c, errors.New(err.Error()))
+		response.Internal(c, err)
 		return
 	}
 
 	response.Created(c, "file uploaded successfully", result)
 }
 
+// ListFiles godoc
+// @Summary List files
+// @Description List the caller's files, or one page of them when after or before is given
+// @Tags files
+// @Produce json
+// @Param after query string false "Cursor from next_cursor; empty for the first page"
+// @Param before query string false "Cursor from prev_cursor"
+// @Param limit query int false "Limit"
+// @Success 200 {object} response.ListResponse
+// @Security ApiKeyAuth
+// @Router /files [get]
 func (h *Handler) list(c *gin.Context) {
-	response.Success(c, "files fetched successfully", h.svc.List())
+	userID := c.GetUint("userID")
+	if !pagination.CursorRequested(c.Request.URL.Query()) {
+		files, err := h.svc.List(userID)
+		if err != nil {
+			response.Internal(c, err)
+			return
+		}
+		response.Success(c, "files fetched successfully", files)
+		return
+	}
+
+	var ks pagination.Keyset
+	if err := c.ShouldBindQuery(&ks); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	ks.Normalize()
+
+	after, before, err := ks.Decode()
+	if err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	page, err := h.svc.Keyset(userID, after, before, ks.Limit)
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.CursorList(c, page.Items, ks.Limit, page.Next.String(), page.Prev.String())
 }
 
 func (h *Handler) download(c *gin.Context) {
 	id := c.Param("id")
 	f, err := h.svc.Get(id)
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
 	if err != nil {
-		response.NotFound(c, errors.New("file not found"))
+		response.Internal(c, err)
 		return
 	}
 
 	c.Header("Content-Disposition", "attachment; filename="+f.Name)
 	c.Header("Content-Type", f.MimeType)
+	if f.Checksum != "" {
+		c.Header("ETag", `"`+f.Checksum+`"`)
+	}
+
+	content := h.svc.Open(c.Request.Context(), f)
+	defer content.Close()
+	http.ServeContent(c.Writer, c.Request, f.Name, f.CreatedAt, content)
+}
+
+// FileURL godoc
+// @Summary Presigned file URL
+// @Description Get a time-limited URL that downloads the file straight from the blob store, where the backend supports it
+// @Tags files
+// @Produce json
+// @Param id path string true "File ID"
+// @Success 200 {object} files.PresignedURL
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 501 {object} response.ErrorResponse
+// @Router /files/{id}/url [get]
+func (h *Handler) url(c *gin.Context) {
+	f, err := h.svc.Get(c.Param("id"))
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
 
-	fp, err := os.Open(f.Path)
+	u, expires, err := h.svc.URL(c.Request.Context(), f)
+	if errors.Is(err, storage.ErrPresignUnsupported) {
+		response.NotImplemented(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "file url created successfully", PresignedURL{URL: u.String(), ExpiresAt: expires})
+}
+
+// DeleteFile godoc
+// @Summary Delete file
+// @Description Delete one of the caller's files. Its content is removed once no other file shares it.
+// @Tags files
+// @Param id path string true "File ID"
+// @Success 204
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /files/{id} [delete]
+func (h *Handler) delete(c *gin.Context) {
+	err := h.svc.Delete(c.Request.Context(), c.GetUint("userID"), c.Param("id"))
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
 	if err != nil {
-		response.Internal(c, errors.New("cannot read file"))
+		response.Internal(c, err)
+		return
+	}
+	response.NoContent(c)
+}
+
+// StorageUsage godoc
+// @Summary Storage usage
+// @Description Get how many bytes the caller's files take up and how many are left; null limits mean unlimited
+// @Tags files
+// @Produce json
+// @Success 200 {object} files.Usage
+// @Security ApiKeyAuth
+// @Router /files/usage [get]
+func (h *Handler) usage(c *gin.Context) {
+	usage, err := h.svc.Usage(c.GetUint("userID"))
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "usage fetched successfully", usage)
+}
+
+// QuotaRequest overrides a user's limits. Omitted or null limits fall
+// back to the defaults; 0 means unlimited.
+type QuotaRequest struct {
+	Quota       *int64 `json:"quota" binding:"omitempty,min=0"`
+	MaxFileSize *int64 `json:"max_file_size" binding:"omitempty,min=0"`
+}
+
+func quotaUser(c *gin.Context) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param("user"), 10, 0)
+	if err != nil {
+		response.BadRequest(c, errors.New("invalid user id"))
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// GetQuota godoc
+// @Summary User storage usage (admin)
+// @Description Get a user's storage usage and limits
+// @Tags files
+// @Produce json
+// @Param user path int true "User ID"
+// @Success 200 {object} files.Usage
+// @Failure 403 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /files/quotas/{user} [get]
+func (h *Handler) getQuota(c *gin.Context) {
+	userID, ok := quotaUser(c)
+	if !ok {
+		return
+	}
+	usage, err := h.svc.Usage(userID)
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "usage fetched successfully", usage)
+}
+
+// SetQuota godoc
+// @Summary Override user limits (admin)
+// @Description Set a user's storage quota and maximum file size in place of the defaults
+// @Tags files
+// @Accept json
+// @Produce json
+// @Param user path int true "User ID"
+// @Param quota body files.QuotaRequest true "Limits in bytes"
+// @Success 200 {object} files.Usage
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /files/quotas/{user} [put]
+func (h *Handler) setQuota(c *gin.Context) {
+	userID, ok := quotaUser(c)
+	if !ok {
+		return
+	}
+	var req QuotaRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	usage, err := h.svc.SetQuota(Quota{UserID: userID, Quota: req.Quota, MaxFileSize: req.MaxFileSize})
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "quota updated successfully", usage)
+}
+
+// ResetQuota godoc
+// @Summary Reset user limits (admin)
+// @Description Drop a user's overridden limits so the defaults apply again
+// @Tags files
+// @Param user path int true "User ID"
+// @Success 204
+// @Failure 403 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /files/quotas/{user} [delete]
+func (h *Handler) resetQuota(c *gin.Context) {
+	userID, ok := quotaUser(c)
+	if !ok {
+		return
+	}
+	if err := h.svc.ResetQuota(userID); err != nil {
+		response.Internal(c, err)
 		return
 	}
-	defer fp.Close()
-	http.ServeContent(c.Writer, c.Request, f.Name, os.FileInfo.ModTime(nil), fp)
+	response.NoContent(c)
 }
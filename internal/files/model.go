@@ -1,9 +1,64 @@
 package files
 
+import (
+	"path/filepath"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// File is the metadata of an uploaded file. The content is the blob at
+// Path in the blob store, which files with the same content share.
 type File struct {
-	ID       string `json:"id"`
-	Name     string `json:"name"`
-	Path     string `json:"-"`
-	Size     int64  `json:"size"`
+	ID     string `gorm:"primaryKey;size:36" json:"id"`
+	UserID uint   `gorm:"not null;index" json:"user_id"`
+	// Name is the file name as uploaded.
+	Name     string `gorm:"not null" json:"name"`
+	Path     string `gorm:"not null;index:idx_files_blob" json:"-"`
+	Size     int64  `gorm:"not null" json:"size"`
 	MimeType string `json:"mime_type"`
+	// Checksum is the hex SHA-256 of the content; downloads carry it as
+	// their ETag.
+	Checksum string `gorm:"size:64" json:"checksum"`
+	// CreatedAt orders files for cursor pagination.
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// Blob is a blob in the store with the number of files referring to it.
+// Uploads are stored by digest, so identical content is kept once.
+type Blob struct {
+	Key    string `gorm:"primaryKey"`
+	Digest string `gorm:"size:64;not null;index"`
+	Size   int64  `gorm:"not null"`
+	Refs   int64  `gorm:"not null"`
+
+	CreatedAt time.Time
+}
+
+// Migrate turns the paths of files stored before the blob store was
+// introduced, which were on-disk paths below uploadDir, into blob keys,
+// and counts the references to blobs stored before deduplication.
+func Migrate(db *gorm.DB, uploadDir string) error {
+	prefix := filepath.ToSlash(filepath.Clean(uploadDir)) + "/"
+	err := db.Model(&File{}).
+		Where("substr(path, 1, ?) = ?", len(prefix), prefix).
+		Update("path", gorm.Expr("substr(path, ?)", len(prefix)+1)).Error
+	if err != nil {
+		return err
+	}
+
+	stmts := []string{
+		// paths were unique until files could share a blob
+		`DROP INDEX IF EXISTS idx_files_path`,
+		`INSERT INTO blobs (key, digest, size, refs, created_at)
+			SELECT path, max(checksum), max(size), count(*), min(created_at) FROM files
+			WHERE path NOT IN (SELECT key FROM blobs)
+			GROUP BY path`,
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,227 @@
+package files
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrFileTooLarge is returned for files over the user's size limit.
+	ErrFileTooLarge = errors.New("file exceeds the maximum file size")
+	// ErrQuotaExceeded is returned for files that do not fit into what
+	// is left of the user's quota.
+	ErrQuotaExceeded = errors.New("storage quota exceeded")
+)
+
+// Quota holds the limits an admin set for a user in place of the
+// configured defaults. A nil limit keeps the default; 0 means unlimited.
+type Quota struct {
+	UserID      uint   `gorm:"primaryKey" json:"user_id"`
+	Quota       *int64 `json:"quota"`
+	MaxFileSize *int64 `json:"max_file_size"`
+
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Usage is how much storage a user takes up. Limits are nil when there
+// are none.
+type Usage struct {
+	UserID uint `json:"user_id"`
+	// Used counts the size of every file of the user, also when its
+	// content is shared with other files.
+	Used int64 `json:"used"`
+	// Reserved is what resumable uploads in progress will add.
+	Reserved    int64  `json:"reserved"`
+	Quota       *int64 `json:"quota"`
+	Available   *int64 `json:"available"`
+	MaxFileSize *int64 `json:"max_file_size"`
+	// Overridden tells whether an admin set the user's limits.
+	Overridden bool `json:"overridden"`
+}
+
+// limits are the effective limits of a user; 0 means unlimited.
+type limits struct {
+	quota, maxFileSize int64
+	overridden         bool
+}
+
+func (s *Service) limits(db *gorm.DB, userID uint) (limits, error) {
+	l := limits{quota: s.quota, maxFileSize: s.maxFileSize}
+
+	var q Quota
+	err := db.Where("user_id = ?", userID).First(&q).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return l, nil
+	}
+	if err != nil {
+		return l, err
+	}
+	l.overridden = true
+	if q.Quota != nil {
+		l.quota = *q.Quota
+	}
+	if q.MaxFileSize != nil {
+		l.maxFileSize = *q.MaxFileSize
+	}
+	return l, nil
+}
+
+// used sums the sizes of the user's files.
+func used(db *gorm.DB, userID uint) (int64, error) {
+	var n int64
+	err := db.Model(&File{}).Where("user_id = ?", userID).Select("COALESCE(SUM(size), 0)").Scan(&n).Error
+	return n, err
+}
+
+// reserved sums what the user's unfinished resumable uploads still add.
+func reserved(db *gorm.DB, userID uint) (int64, error) {
+	var n int64
+	err := db.Model(&Upload{}).Where("user_id = ? AND file_id IS NULL", userID).
+		Select("COALESCE(SUM(upload_length), 0)").Scan(&n).Error
+	return n, err
+}
+
+// Usage reports the user's storage use and limits.
+func (s *Service) Usage(userID uint) (Usage, error) {
+	u := Usage{UserID: userID}
+
+	l, err := s.limits(s.db, userID)
+	if err != nil {
+		return u, err
+	}
+	if u.Used, err = used(s.db, userID); err != nil {
+		return u, err
+	}
+	if u.Reserved, err = reserved(s.db, userID); err != nil {
+		return u, err
+	}
+
+	u.Overridden = l.overridden
+	if l.quota > 0 {
+		available := max(l.quota-u.Used-u.Reserved, 0)
+		u.Quota, u.Available = &l.quota, &available
+	}
+	if l.maxFileSize > 0 {
+		u.MaxFileSize = &l.maxFileSize
+	}
+	return u, nil
+}
+
+// uploadLimit is the most a new file of a user may hold and the error to
+// give when it is exceeded; there is no limit when exceeded is nil.
+type uploadLimit struct {
+	bytes    int64
+	exceeded error
+}
+
+func (s *Service) uploadLimit(userID uint) (uploadLimit, error) {
+	usage, err := s.Usage(userID)
+	if err != nil {
+		return uploadLimit{}, err
+	}
+	switch {
+	case usage.Available != nil && (usage.MaxFileSize == nil || *usage.Available < *usage.MaxFileSize):
+		return uploadLimit{*usage.Available, ErrQuotaExceeded}, nil
+	case usage.MaxFileSize != nil:
+		return uploadLimit{*usage.MaxFileSize, ErrFileTooLarge}, nil
+	}
+	return uploadLimit{}, nil
+}
+
+// checkUpload tells whether a file of size bytes fits the user's limits.
+func (s *Service) checkUpload(userID uint, size int64) error {
+	limit, err := s.uploadLimit(userID)
+	if err != nil {
+		return err
+	}
+	if limit.exceeded != nil && size > limit.bytes {
+		return limit.exceeded
+	}
+	return nil
+}
+
+// limitUpload wraps r to stop at the user's limits.
+func (s *Service) limitUpload(userID uint, r io.Reader) (io.Reader, error) {
+	limit, err := s.uploadLimit(userID)
+	if err != nil || limit.exceeded == nil {
+		return r, err
+	}
+	return &limitReader{r: r, n: limit.bytes, err: limit.exceeded}, nil
+}
+
+// limitReader fails with err as soon as more than n bytes were read,
+// so that an upload over the limit is cut off while it streams in.
+type limitReader struct {
+	r   io.Reader
+	n   int64
+	err error
+}
+
+func (l *limitReader) Read(p []byte) (int, error) {
+	// read one byte more than allowed to tell a file that fits exactly
+	// from one that is too large
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.n {
+		l.n = -1
+		return 0, l.err
+	}
+	l.n -= int64(n)
+	return n, err
+}
+
+// checkQuota fails when the user's files, with size more bytes, would
+// take up more than their quota. It runs inside the transaction adding
+// the file, before anything is claimed. Uploads of the same user may
+// finish together, so it holds a lock on the user until the transaction
+// ends; the next upload then counts the file this one adds.
+func (s *Service) checkQuota(tx *gorm.DB, userID uint, size int64) error {
+	if err := lockUser(tx, userID); err != nil {
+		return err
+	}
+	l, err := s.limits(tx, userID)
+	if err != nil || l.quota == 0 {
+		return err
+	}
+	n, err := used(tx, userID)
+	if err != nil {
+		return err
+	}
+	if n+size > l.quota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+// lockUser takes a PostgreSQL advisory lock on the user's storage, held
+// until tx ends. The SQLite databases of the tests need none, as their
+// transactions take the write lock when they begin.
+func lockUser(tx *gorm.DB, userID uint) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", int64(userID)).Error
+}
+
+// SetQuota overrides the limits of a user; nil fields keep the default.
+func (s *Service) SetQuota(q Quota) (Usage, error) {
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"quota", "max_file_size", "updated_at"}),
+	}).Create(&q).Error
+	if err != nil {
+		return Usage{}, err
+	}
+	return s.Usage(q.UserID)
+}
+
+// ResetQuota drops the limits an admin set for a user.
+func (s *Service) ResetQuota(userID uint) error {
+	return s.db.Where("user_id = ?", userID).Delete(&Quota{}).Error
+}
@@ -0,0 +1,207 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tmsankram/gonotes/internal/config"
+)
+
+func int64p(n int64) *int64 { return &n }
+
+// upload posts content as a multipart form.
+func (c *tusClient) upload(content string) int {
+	c.t.Helper()
+	var buf bytes.Buffer
+	w := multipart.NewWriter(&buf)
+	fw, err := w.CreateFormFile("file", "f.txt")
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	fw.Write([]byte(content))
+	w.Close()
+	rec := c.do(http.MethodPost, "/files/upload", &buf, int64(buf.Len()), map[string]string{"Content-Type": w.FormDataContentType()})
+	return rec.Code
+}
+
+// blobKeys leaves out the chunks of unfinished uploads.
+func blobKeys(t *testing.T, store *testStore) []string {
+	t.Helper()
+	var keys []string
+	for _, key := range store.keys(t) {
+		if strings.HasPrefix(key, "sha256/") {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func TestUploadTooLarge(t *testing.T) {
+	store := newTestStore(t)
+	cfg := &config.Config{StorageQuota: 15, MaxFileSize: 10}
+	svc := newTestService(t, cfg, store)
+	c := newTusClient(t, svc, cfg, 1)
+
+	if code := c.upload("0123456789"); code != http.StatusCreated {
+		t.Fatalf("got %d", code)
+	}
+	for _, body := range []string{
+		// over the file size limit
+		"0123456789a",
+		// within it, but over what is left of the quota
+		"abcdefghij",
+	} {
+		if code := c.upload(body); code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: got %d", body, code)
+		}
+	}
+	for _, length := range []string{"11", "6"} {
+		rec := c.do(http.MethodPost, "/files/tus/", nil, 0, map[string]string{"Upload-Length": length})
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("tus %s: got %d: %s", length, rec.Code, rec.Body)
+		}
+	}
+
+	usage, err := svc.Usage(1)
+	if err != nil || usage.Used != 10 {
+		t.Fatalf("usage %+v, %v", usage, err)
+	}
+	if keys := store.keys(t); len(keys) != 1 {
+		t.Fatalf("store has %v", keys)
+	}
+}
+
+func TestQuotaExceeded(t *testing.T) {
+	store := newTestStore(t)
+	cfg := &config.Config{}
+	svc := newTestService(t, cfg, store)
+	c := newTusClient(t, svc, cfg, 1)
+
+	shared := newTusClient(t, svc, cfg, 2)
+	if code := shared.upload("shared"); code != http.StatusCreated {
+		t.Fatalf("got %d", code)
+	}
+	kept := blobKeys(t, store)
+
+	// the quota shrinks while the uploads are under way, so the check
+	// when they finish is the one that refuses them
+	var urls []string
+	for _, length := range []int{len("shared"), len("new content")} {
+		urls = append(urls, c.create(length))
+	}
+	if _, err := svc.SetQuota(Quota{UserID: 1, Quota: int64p(5)}); err != nil {
+		t.Fatal(err)
+	}
+	for i, body := range []string{"shared", "new content"} {
+		rec := c.patch(urls[i], 0, body, int64(len(body)))
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("%s: got %d: %s", body, rec.Code, rec.Body)
+		}
+		// a refused upload is gone rather than left to fail again
+		if rec := c.do(http.MethodHead, urls[i], nil, 0, nil); rec.Code != http.StatusNotFound {
+			t.Fatalf("%s: head got %d", body, rec.Code)
+		}
+	}
+
+	// neither upload claimed a blob or left one behind, chunks included
+	if keys := store.keys(t); !slices.Equal(keys, kept) {
+		t.Fatalf("store has %v", keys)
+	}
+	checkNoUploads(t, svc)
+	if blobs := blobRows(t, svc.db); len(blobs) != 1 || blobs[0].Refs != 1 {
+		t.Fatalf("blobs %+v", blobs)
+	}
+	if usage, err := svc.Usage(1); err != nil || usage.Used != 0 {
+		t.Fatalf("usage %+v, %v", usage, err)
+	}
+}
+
+func checkNoUploads(t *testing.T, svc *Service) {
+	t.Helper()
+	var uploads, parts int64
+	svc.db.Model(&Upload{}).Where("file_id IS NULL").Count(&uploads)
+	svc.db.Model(&UploadPart{}).Count(&parts)
+	if uploads != 0 || parts != 0 {
+		t.Fatalf("%d uploads and %d parts left", uploads, parts)
+	}
+}
+
+func TestFinishUploadsDropsRefused(t *testing.T) {
+	store := newTestStore(t)
+	svc := newTestService(t, &config.Config{}, store)
+	ctx := context.Background()
+
+	// all the content arrived, but the upload was not finished before a
+	// restart, and by then the quota no longer has room for it
+	u, err := svc.CreateUpload(ctx, 1, int64(len("content")), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.writePart(ctx, u, strings.NewReader("content"), u.Length, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetQuota(Quota{UserID: 1, Quota: int64p(5)}); err != nil {
+		t.Fatal(err)
+	}
+
+	for range 2 {
+		if n, err := svc.FinishUploads(ctx); err != nil || n != 0 {
+			t.Fatalf("finished %d, %v", n, err)
+		}
+		checkNoUploads(t, svc)
+		if keys := store.keys(t); len(keys) != 0 {
+			t.Fatalf("store has %v", keys)
+		}
+	}
+}
+
+// TestQuotaConcurrentUploads needs TEST_DATABASE_URL to exercise the lock;
+// SQLite runs the transactions one after the other anyway.
+func TestQuotaConcurrentUploads(t *testing.T) {
+	store := newTestStore(t)
+	svc := newTestService(t, &config.Config{StorageQuota: 10}, store)
+	ctx := context.Background()
+
+	// each fits the quota alone, no two of them together
+	const uploads = 8
+	errs := make(chan error, uploads)
+	var wg sync.WaitGroup
+	for i := range uploads {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := svc.Save(ctx, 1, "f.txt", "text/plain", strings.NewReader(fmt.Sprintf("upload %d", i)))
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	saved := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			saved++
+		case !errors.Is(err, ErrQuotaExceeded):
+			t.Fatal(err)
+		}
+	}
+	usage, err := svc.Usage(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved != 1 || usage.Used != 8 {
+		t.Fatalf("saved %d files of %d bytes", saved, usage.Used)
+	}
+	if keys := store.keys(t); len(keys) != 1 {
+		t.Fatalf("store has %v", keys)
+	}
+}
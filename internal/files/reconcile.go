@@ -0,0 +1,208 @@
+package files
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/storage"
+)
+
+// Report is the outcome of Reconcile.
+type Report struct {
+	// Untracked are blobs in the store without metadata.
+	Untracked []string
+	// Imported are the untracked blobs that were given metadata.
+	Imported []File
+	// Missing are files whose content is gone from the store.
+	Missing []File
+}
+
+// reconcileGrace is how old an untracked blob has to be before Reconcile
+// reports it. Younger ones may belong to uploads that are being stored.
+const reconcileGrace = 10 * time.Minute
+
+// Reconcile compares the blob store with the file metadata, as both can
+// drift apart when files were stored before the metadata was kept in the
+// database or were removed by hand. Untracked blobs are imported as
+// owner's when owner is not 0; otherwise, like missing ones, they are
+// only reported.
+func (s *Service) Reconcile(ctx context.Context, owner uint) (Report, error) {
+	var report Report
+	start := time.Now()
+
+	var keys []string
+	if err := s.db.Model(&Blob{}).Pluck("key", &keys).Error; err != nil {
+		return report, err
+	}
+	known := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		known[k] = true
+	}
+
+	var candidates []string
+	err := s.blobs.List(ctx, func(key string) error {
+		// uploads in progress, or left behind by a crash
+		if known[key] || strings.HasPrefix(key, incomingPrefix) || strings.HasPrefix(key, tusPrefix) {
+			return nil
+		}
+		candidates = append(candidates, key)
+		return nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	// uploads that finished while listing stored their blob after the
+	// first look at the metadata, so it is looked at again
+	untracked, err := s.untracked(ctx, candidates, start.Add(-reconcileGrace))
+	if err != nil {
+		return report, err
+	}
+	for _, key := range untracked {
+		report.Untracked = append(report.Untracked, key)
+		log.Printf("[FILES] %s has no metadata", key)
+
+		if owner == 0 {
+			continue
+		}
+		f, err := s.importFile(ctx, owner, key)
+		if err != nil {
+			log.Printf("[FILES] importing %s: %v", key, err)
+			continue
+		}
+		report.Imported = append(report.Imported, f)
+	}
+
+	// files share blobs, so each is looked up once
+	missing := map[string]bool{}
+	var batch []File
+	err = s.db.Order("created_at").FindInBatches(&batch, 500, func(tx *gorm.DB, _ int) error {
+		for _, f := range batch {
+			gone, seen := missing[f.Path]
+			if !seen {
+				_, err := s.blobs.Stat(ctx, f.Path)
+				gone = errors.Is(err, storage.ErrNotFound)
+				missing[f.Path] = gone
+			}
+			if gone {
+				report.Missing = append(report.Missing, f)
+				log.Printf("[FILES] content of file %s (%s) is missing", f.ID, f.Path)
+			}
+		}
+		return nil
+	}).Error
+	return report, err
+}
+
+// untracked returns the keys that still have no metadata and whose blobs
+// were last written before cutoff.
+func (s *Service) untracked(ctx context.Context, keys []string, cutoff time.Time) ([]string, error) {
+	var untracked []string
+	for len(keys) > 0 {
+		batch := keys[:min(len(keys), 500)]
+		keys = keys[len(batch):]
+
+		var tracked []string
+		if err := s.db.Model(&Blob{}).Where("key IN ?", batch).Pluck("key", &tracked).Error; err != nil {
+			return nil, err
+		}
+		known := make(map[string]bool, len(tracked))
+		for _, k := range tracked {
+			known[k] = true
+		}
+
+		for _, key := range batch {
+			if known[key] {
+				continue
+			}
+			info, err := s.blobs.Stat(ctx, key)
+			if errors.Is(err, storage.ErrNotFound) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			if info.ModTime.After(cutoff) {
+				continue
+			}
+			untracked = append(untracked, key)
+		}
+	}
+	return untracked, nil
+}
+
+// importFile records metadata for a blob already in the store. Keys in
+// the <id>_<name> form uploads had before deduplication keep their id.
+func (s *Service) importFile(ctx context.Context, owner uint, key string) (File, error) {
+	base := path.Base(key)
+	id, name := uuid.New().String(), base
+	if len(base) > 37 && base[36] == '_' {
+		if u, err := uuid.Parse(base[:36]); err == nil {
+			var n int64
+			if err := s.db.Model(&File{}).Where("id = ?", u.String()).Count(&n).Error; err != nil {
+				return File{}, err
+			}
+			if n == 0 {
+				id = u.String()
+			}
+			name = base[37:]
+		}
+	}
+
+	info, err := s.blobs.Stat(ctx, key)
+	if err != nil {
+		return File{}, err
+	}
+	in, err := s.blobs.Get(ctx, key)
+	if err != nil {
+		return File{}, err
+	}
+	defer in.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(in, head)
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return File{}, err
+	}
+	mimeType := mime.TypeByExtension(path.Ext(name))
+	if mimeType == "" {
+		mimeType = http.DetectContentType(head[:n])
+	}
+
+	hash := sha256.New()
+	hash.Write(head[:n])
+	if _, err := io.Copy(hash, in); err != nil {
+		return File{}, err
+	}
+
+	f := File{
+		ID:        id,
+		UserID:    owner,
+		Name:      name,
+		Path:      key,
+		Size:      info.Size,
+		MimeType:  mimeType,
+		Checksum:  hex.EncodeToString(hash.Sum(nil)),
+		CreatedAt: info.ModTime,
+	}
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		b := Blob{Key: key, Digest: f.Checksum, Size: f.Size, Refs: 1, CreatedAt: f.CreatedAt}
+		if err := tx.Create(&b).Error; err != nil {
+			return err
+		}
+		return tx.Create(&f).Error
+	})
+	return f, err
+}
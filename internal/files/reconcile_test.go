@@ -0,0 +1,79 @@
+package files
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmsankram/gonotes/internal/config"
+)
+
+// racingStore finishes an upload of key while the store is listed: the
+// blob is already there, its metadata is committed after the listing.
+type racingStore struct {
+	*testStore
+	svc *Service
+	key string
+}
+
+func (s *racingStore) List(ctx context.Context, fn func(key string) error) error {
+	if err := s.testStore.List(ctx, fn); err != nil || s.key == "" {
+		return err
+	}
+	key := s.key
+	s.key = ""
+	return s.svc.db.Create(&Blob{Key: key, Digest: "racing", Size: 4, Refs: 1}).Error
+}
+
+func TestReconcile(t *testing.T) {
+	store := newTestStore(t)
+	racing := &racingStore{testStore: store, key: "sha256/ra/racing"}
+	svc := newTestService(t, &config.Config{}, racing)
+	racing.svc = svc
+	ctx := context.Background()
+
+	tracked, err := svc.Save(ctx, 1, "tracked.txt", "text/plain", strings.NewReader("tracked"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.put(t, "old/orphan.txt", "orphan", time.Hour)
+	store.put(t, "new/orphan.txt", "still being stored", time.Minute)
+	store.put(t, racing.key, "race", time.Hour)
+	store.put(t, incomingKey("upload"), "partial", time.Hour)
+
+	gone := File{ID: "7f6c3b5e-4e1a-4c42-9d6e-0a4f1b2c3d4e", UserID: 1, Name: "gone.txt", Path: "sha256/go/gone", Size: 4}
+	if err := svc.db.Create(&gone).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := svc.Reconcile(ctx, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(report.Untracked, []string{"old/orphan.txt"}) {
+		t.Fatalf("untracked %v", report.Untracked)
+	}
+	if len(report.Imported) != 0 {
+		t.Fatalf("imported %+v", report.Imported)
+	}
+	if len(report.Missing) != 1 || report.Missing[0].ID != gone.ID {
+		t.Fatalf("missing %+v", report.Missing)
+	}
+
+	// with an owner the untracked blob is adopted
+	report, err = svc.Reconcile(ctx, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Imported) != 1 || report.Imported[0].Path != "old/orphan.txt" || report.Imported[0].UserID != 2 {
+		t.Fatalf("imported %+v", report.Imported)
+	}
+	if _, err := svc.Get(tracked.ID); err != nil {
+		t.Fatal(err)
+	}
+	if report, err = svc.Reconcile(ctx, 2); err != nil || len(report.Untracked) != 0 {
+		t.Fatalf("after import: %+v, %v", report, err)
+	}
+}
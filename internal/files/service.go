@@ -1,83 +1,238 @@
 package files
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"io"
-	"mime/multipart"
-	"os"
+	"log"
+	"net/url"
 	"path/filepath"
-	"sync"
+	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/events"
+	"github.com/tmsankram/gonotes/internal/pagination"
+	"github.com/tmsankram/gonotes/internal/storage"
 )
 
+// ErrNotFound is returned when a file does not exist.
+var ErrNotFound = errors.New("file not found")
+
 type Service struct {
-	mu    sync.RWMutex
-	store map[string]File
+	db    *gorm.DB
+	blobs storage.BlobStore
+
+	presignExpiry time.Duration
+
+	// default limits; see config.Config
+	quota       int64
+	maxFileSize int64
+
+	events *events.Bus
 }
 
-func NewService() *Service {
+func NewService(db *gorm.DB, cfg *config.Config, blobs storage.BlobStore, bus *events.Bus) *Service {
 	return &Service{
-		store: make(map[string]File),
+		db:            db,
+		blobs:         blobs,
+		presignExpiry: cfg.PresignExpiry,
+		quota:         cfg.StorageQuota,
+		maxFileSize:   cfg.MaxFileSize,
+		events:        bus,
 	}
 }
 
-func (s *Service) Save(header *multipart.FileHeader, file multipart.File) (File, error) {
-	id := uuid.New().String()
+// Save streams an upload of the user into the blob store and records its
+// metadata. Content that is stored already is not kept twice: the new
+// file shares the existing blob. Uploads over the user's limits fail with
+// ErrFileTooLarge or ErrQuotaExceeded as soon as they cross them.
+func (s *Service) Save(ctx context.Context, userID uint, name, mimeType string, content io.Reader) (File, error) {
+	f := File{
+		ID:     uuid.New().String(),
+		UserID: userID,
+		// secure name
+		Name:     filepath.Base(name),
+		MimeType: mimeType,
+	}
 
-	dstDir := "uploads"
-	if err := os.MkdirAll(dstDir, 0755); err != nil {
+	content, err := s.limitUpload(userID, content)
+	if err != nil {
 		return File{}, err
 	}
 
-	// secure name
-	name := filepath.Base(header.Filename)
-	dstPath := filepath.Join(dstDir, id+"_"+name)
+	// the digest is only known once the whole upload went through
+	tmp := incomingKey(f.ID)
+	defer s.blobs.Delete(context.WithoutCancel(ctx), tmp)
 
-	out, err := os.Create(dstPath)
+	hash := sha256.New()
+	size, err := s.blobs.Put(ctx, tmp, io.TeeReader(content, hash), -1, f.MimeType)
 	if err != nil {
 		return File{}, err
 	}
-	defer out.Close()
+	f.Size = size
+	f.Checksum = hex.EncodeToString(hash.Sum(nil))
 
-	if _, err := io.Copy(out, file); err != nil {
+	return s.create(ctx, f, tmp)
+}
+
+// create records f, whose content was uploaded to the blob at tmp and
+// has been hashed into f.Checksum. The content is moved to a key of its
+// own before the transaction and removed again when the transaction
+// fails or the content turns out to be stored already.
+func (s *Service) create(ctx context.Context, f File, tmp string) (File, error) {
+	own := blobKey(f.Checksum, f.ID)
+	if err := s.blobs.Move(ctx, tmp, own); err != nil {
 		return File{}, err
 	}
 
-	f := File{
-		ID:       id,
-		Name:     name,
-		Path:     dstPath,
-		Size:     header.Size,
-		MimeType: header.Header.Get("Content-Type"),
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := s.checkQuota(tx, f.UserID, f.Size); err != nil {
+			return err
+		}
+		b, err := claimBlob(tx, Blob{Key: own, Digest: f.Checksum, Size: f.Size})
+		if err != nil {
+			return err
+		}
+		f.Path = b.Key
+		return tx.Create(&f).Error
+	})
+	cleanup := context.WithoutCancel(ctx)
+	if err != nil {
+		s.blobs.Delete(cleanup, own)
+		return File{}, err
+	}
+	if f.Path != own {
+		if err := s.adopt(cleanup, f.Path, own); err != nil {
+			log.Printf("[FILES] storing %s for file %s: %v", f.Path, f.ID, err)
+		}
 	}
 
-	s.mu.Lock()
-	s.store[id] = f
-	s.mu.Unlock()
-
+	s.events.Publish(events.Event{Type: events.FileCreated, Data: f, Users: []uint{f.UserID}})
 	return f, nil
 }
 
-func (s *Service) Get(id string) (File, error) {
-	s.mu.RUnlock()
-	defer s.mu.RUnlock()
+// Delete removes one of the user's files. Its blob goes with the last
+// file referring to it, once the file is gone from the database.
+func (s *Service) Delete(ctx context.Context, userID uint, id string) error {
+	var f File
+	var gone string
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Where("id = ? AND user_id = ?", id, userID).First(&f).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if err := tx.Delete(&f).Error; err != nil {
+			return err
+		}
+		gone, err = releaseBlob(tx, f.Path)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if gone != "" {
+		if err := s.blobs.Delete(context.WithoutCancel(ctx), gone); err != nil {
+			log.Printf("[FILES] deleting blob %s: %v", gone, err)
+		}
+	}
+
+	s.events.Publish(events.Event{Type: events.FileDeleted, Data: f, Users: []uint{userID}})
+	return nil
+}
 
-	f, ok := s.store[id]
-	if !ok {
-		return File{}, errors.New("file not found")
+// Get fetches a file by id, whoever uploaded it.
+func (s *Service) Get(id string) (File, error) {
+	var f File
+	err := s.db.Where("id = ?", id).First(&f).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return File{}, ErrNotFound
 	}
-	return f, nil
+	return f, err
+}
+
+// Open returns the content of f, read lazily so that only the requested
+// ranges are fetched from the blob store.
+func (s *Service) Open(ctx context.Context, f File) *storage.ReadSeeker {
+	return storage.NewReadSeeker(ctx, s.blobs, f.Path, f.Size)
+}
+
+// URL returns a time-limited URL that downloads f straight from the blob
+// store, or storage.ErrPresignUnsupported when the store has none.
+func (s *Service) URL(ctx context.Context, f File) (*url.URL, time.Time, error) {
+	u, err := s.blobs.PresignGet(ctx, f.Path, s.presignExpiry, f.Name)
+	return u, time.Now().Add(s.presignExpiry), err
+}
+
+// List returns the user's files, newest first.
+func (s *Service) List(userID uint) ([]File, error) {
+	files := []File{}
+	err := s.db.Where("user_id = ?", userID).Order("created_at DESC, id DESC").Find(&files).Error
+	return files, err
 }
 
-func (s *Service) List() []File {
-	s.mu.RLock()
-	defer s.mu.RUnlock()
+// Keyset lists the user's files newest first, starting right after (or,
+// with before, right before) the given cursor.
+func (s *Service) Keyset(userID uint, after, before *pagination.Cursor, limit int) (pagination.Page[File], error) {
+	var page pagination.Page[File]
+
+	q := s.db.Where("user_id = ?", userID)
+	if after != nil {
+		q = q.Where("(created_at, id) < (?, ?)", after.Time, after.ID)
+	} else if before != nil {
+		q = q.Where("(created_at, id) > (?, ?)", before.Time, before.ID)
+	}
+
+	order := "created_at DESC, id DESC"
+	if before != nil {
+		order = "created_at ASC, id ASC"
+	}
+
+	// one extra row tells whether there is more beyond this page
+	var files []File
+	if err := q.Order(order).Limit(limit + 1).Find(&files).Error; err != nil {
+		return page, err
+	}
+
+	more := len(files) > limit
+	if more {
+		files = files[:limit]
+	}
+	if before != nil {
+		for i, j := 0, len(files)-1; i < j; i, j = i+1, j-1 {
+			files[i], files[j] = files[j], files[i]
+		}
+	}
 
-	out := make([]File, 0, len(s.store))
+	page.Items = files
+	if len(files) == 0 {
+		return page, nil
+	}
 
-	for _, f := range s.store {
-		out = append(out, f)
+	first, last := files[0], files[len(files)-1]
+	if before != nil {
+		page.Next = fileCursor(last)
+		if more {
+			page.Prev = fileCursor(first)
+		}
+	} else {
+		if more {
+			page.Next = fileCursor(last)
+		}
+		if after != nil {
+			page.Prev = fileCursor(first)
+		}
 	}
-	return out
+	return page, nil
+}
+
+func fileCursor(f File) *pagination.Cursor {
+	return &pagination.Cursor{Time: f.CreatedAt, ID: f.ID}
 }
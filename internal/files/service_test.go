@@ -0,0 +1,62 @@
+package files
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/storage"
+	"github.com/tmsankram/gonotes/internal/testdb"
+)
+
+// testStore is a local blob store whose blobs can be aged.
+type testStore struct {
+	*storage.Local
+	root string
+}
+
+func newTestStore(t *testing.T) *testStore {
+	t.Helper()
+	root := t.TempDir()
+	local, err := storage.NewLocal(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testStore{Local: local, root: root}
+}
+
+// put stores content at key, last written age ago.
+func (s *testStore) put(t *testing.T, key, content string, age time.Duration) {
+	t.Helper()
+	if _, err := s.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), ""); err != nil {
+		t.Fatal(err)
+	}
+	mtime := time.Now().Add(-age)
+	if err := os.Chtimes(filepath.Join(s.root, filepath.FromSlash(key)), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// keys lists the blobs in the store.
+func (s *testStore) keys(t *testing.T) []string {
+	t.Helper()
+	var keys []string
+	err := s.List(context.Background(), func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return keys
+}
+
+func newTestService(t *testing.T, cfg *config.Config, blobs storage.BlobStore) *Service {
+	t.Helper()
+	db := testdb.Open(t, &File{}, &Blob{}, &Upload{}, &UploadPart{}, &Quota{})
+	return NewService(db, cfg, blobs, nil)
+}
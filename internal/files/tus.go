@@ -0,0 +1,468 @@
+package files
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/storage"
+)
+
+// tusPrefix holds the chunks of resumable uploads.
+const tusPrefix = "tus/"
+
+// ChecksumAlgorithms are the Upload-Checksum algorithms WriteUpload
+// verifies.
+var ChecksumAlgorithms = []string{"md5", "sha1", "sha256"}
+
+var (
+	// ErrOffsetMismatch is returned when a chunk does not start where the
+	// upload stands.
+	ErrOffsetMismatch = errors.New("upload offset does not match")
+	// ErrUploadTooLarge is returned for chunks reaching past the length
+	// of the upload.
+	ErrUploadTooLarge = errors.New("chunk exceeds the upload length")
+	// ErrChecksumMismatch is returned when a chunk does not match the
+	// checksum it was sent with.
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	// ErrChecksumAlgorithm is returned for checksums of unsupported
+	// algorithms.
+	ErrChecksumAlgorithm = errors.New("unsupported checksum algorithm")
+	// ErrInvalidMetadata is returned for malformed Upload-Metadata.
+	ErrInvalidMetadata = errors.New("invalid Upload-Metadata")
+)
+
+// Upload is a resumable upload. Its content arrives in chunks, stored as
+// UploadParts until Offset reaches Length and they are assembled into a
+// File with the upload's id.
+type Upload struct {
+	ID     string `gorm:"primaryKey;size:36"`
+	UserID uint   `gorm:"not null;index"`
+	Length int64  `gorm:"column:upload_length;not null"`
+	Offset int64  `gorm:"column:upload_offset;not null"`
+	// Metadata is the Upload-Metadata header as the client sent it.
+	Metadata string
+	Name     string `gorm:"not null"`
+	MimeType string
+	// FileID is set once the upload has become a file.
+	FileID *string `gorm:"size:36"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Done reports whether the upload has become a file.
+func (u Upload) Done() bool {
+	return u.FileID != nil
+}
+
+// UploadPart is a chunk of an upload, stored as the blob at Key.
+type UploadPart struct {
+	ID       uint   `gorm:"primaryKey"`
+	UploadID string `gorm:"size:36;not null;index"`
+	Offset   int64  `gorm:"column:part_offset;not null"`
+	Size     int64  `gorm:"not null"`
+	Key      string `gorm:"not null"`
+}
+
+// Checksum is the expected digest of a chunk.
+type Checksum struct {
+	Algorithm string
+	Sum       []byte
+}
+
+// ParseChecksum parses an Upload-Checksum header: the algorithm and the
+// base64 digest, separated by a space.
+func ParseChecksum(header string) (*Checksum, error) {
+	algo, sum, ok := strings.Cut(strings.TrimSpace(header), " ")
+	if !ok {
+		return nil, errors.New("invalid Upload-Checksum")
+	}
+	if newChecksumHash(algo) == nil {
+		return nil, ErrChecksumAlgorithm
+	}
+	raw, err := base64.StdEncoding.DecodeString(sum)
+	if err != nil {
+		return nil, errors.New("invalid Upload-Checksum")
+	}
+	return &Checksum{Algorithm: algo, Sum: raw}, nil
+}
+
+func newChecksumHash(algo string) hash.Hash {
+	switch algo {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha256":
+		return sha256.New()
+	}
+	return nil
+}
+
+// ParseMetadata decodes an Upload-Metadata header: comma-separated keys,
+// each followed by a space and its base64 value unless it has none.
+func ParseMetadata(header string) (map[string]string, error) {
+	meta := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return meta, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(pair), " ")
+		if key == "" {
+			return nil, ErrInvalidMetadata
+		}
+		raw, err := base64.StdEncoding.DecodeString(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: bad value for %s", ErrInvalidMetadata, key)
+		}
+		meta[key] = string(raw)
+	}
+	return meta, nil
+}
+
+// CreateUpload starts a resumable upload of length bytes, which counts
+// against the user's quota until it is done. The file name and type come
+// from the filename (or name) and filetype (or type) metadata keys that
+// tus clients send.
+func (s *Service) CreateUpload(ctx context.Context, userID uint, length int64, metadata string) (Upload, error) {
+	meta, err := ParseMetadata(metadata)
+	if err != nil {
+		return Upload{}, err
+	}
+	if err := s.checkUpload(userID, length); err != nil {
+		return Upload{}, err
+	}
+
+	name := firstNonEmpty(meta["filename"], meta["name"])
+	if name == "" {
+		name = "upload"
+	}
+
+	u := Upload{
+		ID:       uuid.New().String(),
+		UserID:   userID,
+		Length:   length,
+		Metadata: metadata,
+		// secure name
+		Name:     filepath.Base(name),
+		MimeType: firstNonEmpty(meta["filetype"], meta["type"]),
+	}
+	if err := s.db.Create(&u).Error; err != nil {
+		return Upload{}, err
+	}
+
+	if u.Length == 0 {
+		return s.finishUpload(ctx, u)
+	}
+	return u, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// GetUpload fetches one of the user's uploads.
+func (s *Service) GetUpload(userID uint, id string) (Upload, error) {
+	var u Upload
+	err := s.db.Where("id = ? AND user_id = ?", id, userID).First(&u).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Upload{}, ErrNotFound
+	}
+	return u, err
+}
+
+// WriteUpload appends a chunk starting at offset to the user's upload.
+// size is the length of the chunk, or -1 when unknown. Without a checksum
+// whatever arrived before the connection broke is kept, so the client can
+// resume from there. The upload becomes a file with the last chunk.
+func (s *Service) WriteUpload(ctx context.Context, userID uint, id string, offset int64, body io.Reader, size int64, sum *Checksum) (Upload, error) {
+	u, err := s.GetUpload(userID, id)
+	if err != nil {
+		return Upload{}, err
+	}
+	if offset != u.Offset {
+		return u, ErrOffsetMismatch
+	}
+	remaining := u.Length - u.Offset
+	if size > remaining {
+		return u, ErrUploadTooLarge
+	}
+
+	if remaining > 0 {
+		n, err := s.writePart(ctx, u, body, remaining, sum)
+		if err != nil {
+			return u, err
+		}
+		u.Offset += n
+	}
+
+	if u.Offset == u.Length && !u.Done() {
+		return s.finishUpload(ctx, u)
+	}
+	return u, nil
+}
+
+// writePart stores a chunk of at most limit bytes and advances the
+// upload past it. A longer chunk fails with ErrUploadTooLarge and leaves
+// nothing behind.
+func (s *Service) writePart(ctx context.Context, u Upload, body io.Reader, limit int64, sum *Checksum) (int64, error) {
+	var in io.Reader = body
+	partial := &partialReader{r: body}
+	if sum == nil {
+		in = partial
+	}
+	// a chunk of unknown size that runs past the upload is refused as a
+	// whole rather than cut short
+	limited := &limitReader{r: in, n: limit, err: ErrUploadTooLarge}
+	in = limited
+	var h hash.Hash
+	if sum != nil {
+		h = newChecksumHash(sum.Algorithm)
+		in = io.TeeReader(in, h)
+	}
+
+	// a client that went away still leaves what it sent
+	ctx = context.WithoutCancel(ctx)
+
+	key := tusPrefix + u.ID + "/" + uuid.New().String()
+	n, err := s.blobs.Put(ctx, key, in, -1, "")
+	if limited.n < 0 {
+		err = ErrUploadTooLarge
+	}
+	if err != nil {
+		s.blobs.Delete(ctx, key)
+		return 0, err
+	}
+	if n == 0 {
+		s.blobs.Delete(ctx, key)
+		return 0, partial.err
+	}
+	if h != nil && !bytes.Equal(h.Sum(nil), sum.Sum) {
+		s.blobs.Delete(ctx, key)
+		return 0, ErrChecksumMismatch
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		// a concurrent request may have written at this offset meanwhile
+		res := tx.Model(&Upload{}).
+			Where("id = ? AND upload_offset = ?", u.ID, u.Offset).
+			Update("upload_offset", gorm.Expr("upload_offset + ?", n))
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrOffsetMismatch
+		}
+		return tx.Create(&UploadPart{UploadID: u.ID, Offset: u.Offset, Size: n, Key: key}).Error
+	})
+	if err != nil {
+		s.blobs.Delete(ctx, key)
+		return 0, err
+	}
+	return n, nil
+}
+
+// partialReader ends at the first read error instead of failing, so that
+// what was received of an interrupted chunk can be kept.
+type partialReader struct {
+	r   io.Reader
+	err error
+}
+
+func (p *partialReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	if err != nil && err != io.EOF {
+		p.err = err
+		err = io.EOF
+	}
+	return n, err
+}
+
+// finishUpload assembles the chunks of a complete upload into a file.
+// Running it again after an interruption picks up where it stopped. An
+// upload the user's limits refuse would be refused every time, so it is
+// dropped with its chunks.
+func (s *Service) finishUpload(ctx context.Context, u Upload) (Upload, error) {
+	var parts []UploadPart
+	if err := s.db.Where("upload_id = ?", u.ID).Order("part_offset").Find(&parts).Error; err != nil {
+		return u, err
+	}
+
+	f, err := s.Get(u.ID)
+	if errors.Is(err, ErrNotFound) {
+		f, err = s.assemble(ctx, u, parts)
+	}
+	if errors.Is(err, ErrQuotaExceeded) || errors.Is(err, ErrFileTooLarge) {
+		if derr := s.dropUpload(ctx, u); derr != nil {
+			log.Printf("[FILES] dropping refused upload %s: %v", u.ID, derr)
+		}
+		return u, err
+	}
+	if err != nil {
+		return u, err
+	}
+
+	u.FileID = &f.ID
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&u).Update("file_id", f.ID).Error; err != nil {
+			return err
+		}
+		return tx.Where("upload_id = ?", u.ID).Delete(&UploadPart{}).Error
+	})
+	if err != nil {
+		return u, err
+	}
+	for _, p := range parts {
+		s.blobs.Delete(ctx, p.Key)
+	}
+	return u, nil
+}
+
+// assemble streams the chunks of u into one blob and records it as a
+// file.
+func (s *Service) assemble(ctx context.Context, u Upload, parts []UploadPart) (File, error) {
+	var offset int64
+	for _, p := range parts {
+		if p.Offset != offset {
+			return File{}, fmt.Errorf("upload %s has a gap at %d", u.ID, offset)
+		}
+		offset += p.Size
+	}
+	if offset != u.Length {
+		return File{}, fmt.Errorf("upload %s has %d of %d bytes", u.ID, offset, u.Length)
+	}
+
+	tmp := incomingKey(u.ID)
+	defer s.blobs.Delete(context.WithoutCancel(ctx), tmp)
+
+	hash := sha256.New()
+	in := &partsReader{ctx: ctx, blobs: s.blobs, parts: parts}
+	defer in.Close()
+	size, err := s.blobs.Put(ctx, tmp, io.TeeReader(in, hash), u.Length, u.MimeType)
+	if err != nil {
+		return File{}, err
+	}
+
+	return s.create(ctx, File{
+		ID:       u.ID,
+		UserID:   u.UserID,
+		Name:     u.Name,
+		Size:     size,
+		MimeType: u.MimeType,
+		Checksum: hex.EncodeToString(hash.Sum(nil)),
+	}, tmp)
+}
+
+// partsReader reads the chunks of an upload one after the other.
+type partsReader struct {
+	ctx   context.Context
+	blobs storage.BlobStore
+	parts []UploadPart
+	cur   io.ReadCloser
+}
+
+func (r *partsReader) Read(b []byte) (int, error) {
+	for {
+		if r.cur == nil {
+			if len(r.parts) == 0 {
+				return 0, io.EOF
+			}
+			body, err := r.blobs.Get(r.ctx, r.parts[0].Key)
+			if err != nil {
+				return 0, err
+			}
+			r.cur, r.parts = body, r.parts[1:]
+		}
+		n, err := r.cur.Read(b)
+		if err == io.EOF {
+			r.Close()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+func (r *partsReader) Close() error {
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
+
+// TerminateUpload drops one of the user's uploads with the chunks
+// received so far. A file the upload became is kept.
+func (s *Service) TerminateUpload(ctx context.Context, userID uint, id string) error {
+	u, err := s.GetUpload(userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.dropUpload(ctx, u)
+}
+
+// dropUpload deletes an upload and its chunks.
+func (s *Service) dropUpload(ctx context.Context, u Upload) error {
+	var parts []UploadPart
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("upload_id = ?", u.ID).Find(&parts).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("upload_id = ?", u.ID).Delete(&UploadPart{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&u).Error
+	})
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		s.blobs.Delete(ctx, p.Key)
+	}
+	return nil
+}
+
+// FinishUploads turns uploads that received all their content but were
+// interrupted before becoming files, e.g. by a restart, into files.
+func (s *Service) FinishUploads(ctx context.Context) (int, error) {
+	var pending []Upload
+	err := s.db.Where("file_id IS NULL AND upload_offset = upload_length").Find(&pending).Error
+	if err != nil {
+		return 0, err
+	}
+
+	finished := 0
+	for _, u := range pending {
+		if _, err := s.finishUpload(ctx, u); err != nil {
+			log.Printf("[FILES] finishing upload %s: %v", u.ID, err)
+			continue
+		}
+		finished++
+	}
+	return finished, nil
+}
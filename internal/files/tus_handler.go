@@ -0,0 +1,202 @@
+package files
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum"
+
+	// statusChecksumMismatch is the status the tus checksum extension
+	// defines for chunks that fail verification.
+	statusChecksumMismatch = 460
+)
+
+// registerTusRoutes serves resumable uploads following the tus 1.0 core
+// protocol with the creation, termination and checksum extensions. See
+// https://tus.io/protocols/resumable-upload.
+func (h *Handler) registerTusRoutes(g *gin.RouterGroup) {
+	t := g.Group("/tus")
+	t.OPTIONS("", h.tusOptions)
+	t.OPTIONS("/", h.tusOptions)
+	t.OPTIONS("/:id", h.tusOptions)
+
+	t.Use(tusResumable(), auth.AuthRequired())
+	t.POST("", h.tusCreate)
+	t.POST("/", h.tusCreate)
+	t.HEAD("/:id", h.tusHead)
+	t.PATCH("/:id", h.tusPatch)
+	t.DELETE("/:id", h.tusTerminate)
+}
+
+// tusResumable rejects requests for other protocol versions and marks
+// every response with the version spoken.
+func tusResumable() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Tus-Resumable", tusVersion)
+		if c.GetHeader("Tus-Resumable") != tusVersion {
+			c.Header("Tus-Version", tusVersion)
+			response.PreconditionFailed(c, errors.New("unsupported Tus-Resumable version"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+func (h *Handler) tusOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Checksum-Algorithm", strings.Join(ChecksumAlgorithms, ","))
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload godoc
+// @Summary Create resumable upload
+// @Description Start a tus upload of Upload-Length bytes; the Location header is where its content goes
+// @Tags files
+// @Param Tus-Resumable header string true "1.0.0"
+// @Param Upload-Length header int true "Size of the whole file"
+// @Param Upload-Metadata header string false "filename and filetype, base64-encoded"
+// @Success 201
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 413 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /files/tus [post]
+func (h *Handler) tusCreate(c *gin.Context) {
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		response.BadRequest(c, errors.New("Upload-Length must be a non-negative integer"))
+		return
+	}
+
+	u, err := h.svc.CreateUpload(c.Request.Context(), c.GetUint("userID"), length, c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		h.tusError(c, err)
+		return
+	}
+
+	c.Header("Location", "/files/tus/"+u.ID)
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Status(http.StatusCreated)
+}
+
+// UploadOffset godoc
+// @Summary Resumable upload offset
+// @Description Get how many bytes of a tus upload were received
+// @Tags files
+// @Param Tus-Resumable header string true "1.0.0"
+// @Param id path string true "Upload ID"
+// @Success 200
+// @Failure 404
+// @Security ApiKeyAuth
+// @Router /files/tus/{id} [head]
+func (h *Handler) tusHead(c *gin.Context) {
+	c.Header("Cache-Control", "no-store")
+	u, err := h.svc.GetUpload(c.GetUint("userID"), c.Param("id"))
+	if err != nil {
+		// HEAD responses have no body
+		c.Status(tusStatus(err))
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if u.Metadata != "" {
+		c.Header("Upload-Metadata", u.Metadata)
+	}
+	c.Status(http.StatusOK)
+}
+
+// WriteUpload godoc
+// @Summary Send resumable upload content
+// @Description Append a chunk at Upload-Offset to a tus upload; with the last chunk the upload becomes a file with the upload's id
+// @Tags files
+// @Accept application/offset+octet-stream
+// @Param Tus-Resumable header string true "1.0.0"
+// @Param Upload-Offset header int true "Where the chunk starts"
+// @Param Upload-Checksum header string false "Algorithm and base64 digest of the chunk"
+// @Param id path string true "Upload ID"
+// @Success 204
+// @Failure 409 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Failure 460 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /files/tus/{id} [patch]
+func (h *Handler) tusPatch(c *gin.Context) {
+	if c.ContentType() != "application/offset+octet-stream" {
+		response.UnsupportedMediaType(c, errors.New("Content-Type must be application/offset+octet-stream"))
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		response.BadRequest(c, errors.New("Upload-Offset must be a non-negative integer"))
+		return
+	}
+
+	var sum *Checksum
+	if v := c.GetHeader("Upload-Checksum"); v != "" {
+		if sum, err = ParseChecksum(v); err != nil {
+			response.BadRequest(c, err)
+			return
+		}
+	}
+
+	u, err := h.svc.WriteUpload(c.Request.Context(), c.GetUint("userID"), c.Param("id"),
+		offset, c.Request.Body, c.Request.ContentLength, sum)
+	if err != nil {
+		h.tusError(c, err)
+		return
+	}
+
+	c.Header("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	c.Status(http.StatusNoContent)
+}
+
+// TerminateUpload godoc
+// @Summary Terminate resumable upload
+// @Description Drop a tus upload and the content received so far
+// @Tags files
+// @Param Tus-Resumable header string true "1.0.0"
+// @Param id path string true "Upload ID"
+// @Success 204
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /files/tus/{id} [delete]
+func (h *Handler) tusTerminate(c *gin.Context) {
+	if err := h.svc.TerminateUpload(c.Request.Context(), c.GetUint("userID"), c.Param("id")); err != nil {
+		h.tusError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func tusStatus(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, ErrOffsetMismatch):
+		return http.StatusConflict
+	case errors.Is(err, ErrUploadTooLarge), errors.Is(err, ErrFileTooLarge), errors.Is(err, ErrQuotaExceeded):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, ErrChecksumMismatch):
+		return statusChecksumMismatch
+	case errors.Is(err, ErrChecksumAlgorithm), errors.Is(err, ErrInvalidMetadata):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func (h *Handler) tusError(c *gin.Context, err error) {
+	c.JSON(tusStatus(err), response.ErrorResponse{Error: err.Error()})
+}
@@ -0,0 +1,165 @@
+package files
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/config"
+)
+
+// tusClient talks to the files API as one user.
+type tusClient struct {
+	t     *testing.T
+	r     http.Handler
+	token string
+}
+
+func newTusClient(t *testing.T, svc *Service, cfg *config.Config, userID uint) *tusClient {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	NewHandler(svc, cfg).RegisterRoutes(r)
+	token, err := auth.GenerateToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tusClient{t: t, r: r, token: token}
+}
+
+// do sends a request; a size of -1 sends body without a Content-Length,
+// as a chunked request would arrive.
+func (c *tusClient) do(method, path string, body io.Reader, size int64, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, body)
+	req.ContentLength = size
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	c.r.ServeHTTP(rec, req)
+	return rec
+}
+
+// create starts an upload of length bytes and returns its URL.
+func (c *tusClient) create(length int) string {
+	c.t.Helper()
+	rec := c.do(http.MethodPost, "/files/tus/", nil, 0, map[string]string{"Upload-Length": strconv.Itoa(length)})
+	if rec.Code != http.StatusCreated {
+		c.t.Fatalf("create: got %d: %s", rec.Code, rec.Body)
+	}
+	return rec.Header().Get("Location")
+}
+
+func (c *tusClient) patch(url string, offset int, chunk string, size int64) *httptest.ResponseRecorder {
+	return c.do(http.MethodPatch, url, strings.NewReader(chunk), size, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": strconv.Itoa(offset),
+	})
+}
+
+func (c *tusClient) offset(url string) string {
+	c.t.Helper()
+	rec := c.do(http.MethodHead, url, nil, 0, nil)
+	if rec.Code != http.StatusOK {
+		c.t.Fatalf("head: got %d", rec.Code)
+	}
+	return rec.Header().Get("Upload-Offset")
+}
+
+func TestTusUpload(t *testing.T) {
+	store := newTestStore(t)
+	cfg := &config.Config{}
+	svc := newTestService(t, cfg, store)
+	c := newTusClient(t, svc, cfg, 1)
+
+	url := c.create(10)
+	for _, chunk := range []struct {
+		offset int
+		data   string
+		size   int64
+	}{
+		{0, "0123", 4},
+		{4, "456789", -1},
+	} {
+		if rec := c.patch(url, chunk.offset, chunk.data, chunk.size); rec.Code != http.StatusNoContent {
+			t.Fatalf("patch at %d: got %d: %s", chunk.offset, rec.Code, rec.Body)
+		}
+	}
+
+	f, err := svc.Get(url[strings.LastIndex(url, "/")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := content(t, svc, f); got != "0123456789" || f.Size != 10 {
+		t.Fatalf("got %q of %d bytes", got, f.Size)
+	}
+}
+
+func TestTusOversizedChunk(t *testing.T) {
+	store := newTestStore(t)
+	cfg := &config.Config{}
+	svc := newTestService(t, cfg, store)
+	c := newTusClient(t, svc, cfg, 1)
+
+	url := c.create(10)
+	if rec := c.patch(url, 0, "0123", 4); rec.Code != http.StatusNoContent {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+
+	// with a length the chunk is refused up front, without one once it
+	// runs past the end; either way nothing of it is kept
+	for _, size := range []int64{11, -1} {
+		rec := c.patch(url, 4, "456789abcdef", size)
+		if rec.Code != http.StatusRequestEntityTooLarge {
+			t.Fatalf("size %d: got %d: %s", size, rec.Code, rec.Body)
+		}
+		if got := c.offset(url); got != "4" {
+			t.Fatalf("size %d: offset %s", size, got)
+		}
+	}
+	if keys := store.keys(t); len(keys) != 1 {
+		t.Fatalf("store has %v", keys)
+	}
+
+	// a chunk that fits exactly still goes through
+	if rec := c.patch(url, 4, "456789", -1); rec.Code != http.StatusNoContent {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	f, err := svc.Get(url[strings.LastIndex(url, "/")+1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := content(t, svc, f); got != "0123456789" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestTusChecksum(t *testing.T) {
+	store := newTestStore(t)
+	cfg := &config.Config{}
+	svc := newTestService(t, cfg, store)
+	c := newTusClient(t, svc, cfg, 1)
+
+	url := c.create(4)
+	rec := c.do(http.MethodPatch, url, bytes.NewReader([]byte("abcd")), 4, map[string]string{
+		"Content-Type":  "application/offset+octet-stream",
+		"Upload-Offset": "0",
+		// sha1 of "abce"
+		"Upload-Checksum": "sha1 CkMadjHKv2sRuYSpQxJ7Xgqp1oc=",
+	})
+	if rec.Code != statusChecksumMismatch {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	if got := c.offset(url); got != "0" {
+		t.Fatalf("offset %s", got)
+	}
+}
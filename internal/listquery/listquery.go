@@ -0,0 +1,270 @@
+// Package listquery parses the sort and filter parameters of list
+// endpoints against a whitelist and turns them into GORM scopes.
+//
+// A list endpoint declares a Spec once:
+//
+//	var spec = listquery.Spec{
+//		Sort:    map[string]string{"updated_at": "notes.updated_at", "title": "notes.title"},
+//		Default: "-id",
+//		Filters: []listquery.Filter{
+//			{Param: "created_after", Column: "notes.created_at", Op: listquery.Gt, Type: listquery.Time},
+//		},
+//		Params: []string{"page", "limit"},
+//	}
+//
+// and parses each request with spec.Parse(c.Request.URL.Query()).
+// Sorting is a comma separated field list where a leading "-" means
+// descending, e.g. sort=updated_at,-title.
+package listquery
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Type is the type a filter value is parsed as.
+type Type int
+
+const (
+	String Type = iota
+	Bool
+	Int
+	Time
+)
+
+// Op compares a column to a filter value.
+type Op string
+
+const (
+	Eq  Op = "="
+	Gt  Op = ">"
+	Gte Op = ">="
+	Lt  Op = "<"
+	Lte Op = "<="
+)
+
+// Filter whitelists one query parameter.
+type Filter struct {
+	Param  string
+	Column string
+	Op     Op
+	Type   Type
+
+	// Scope, when set, replaces the plain "Column Op value" condition. It
+	// gets the parsed value (string, bool, int64 or time.Time).
+	Scope func(value any) func(*gorm.DB) *gorm.DB
+}
+
+// Spec is the whitelist of a list endpoint.
+type Spec struct {
+	// Sort maps the field names clients may sort by to columns.
+	Sort map[string]string
+	// Default is the sort used when the request has none, in the same
+	// syntax as the sort parameter. Its fields must be in Sort.
+	Default string
+	// Tiebreak is appended to every order so that pages are stable.
+	Tiebreak string
+
+	Filters []Filter
+	// Params are other parameters the endpoint accepts and handles itself
+	// (pagination, search, ...). They are only checked for being known.
+	Params []string
+}
+
+// FieldError describes one rejected parameter.
+type FieldError struct {
+	Field string `json:"field"`
+	Error string `json:"error"`
+}
+
+// Errors is returned by Parse. It is meant to be passed to
+// response.ValidationError as details.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Error
+	}
+	return strings.Join(msgs, "; ")
+}
+
+type order struct {
+	column string
+	desc   bool
+}
+
+type condition struct {
+	filter Filter
+	value  any
+}
+
+// Query is a parsed list request.
+type Query struct {
+	orders     []order
+	conditions []condition
+	sorted     bool
+}
+
+// Sorted reports whether the request asked for an explicit sort rather
+// than getting the spec's default.
+func (q Query) Sorted() bool {
+	return q.sorted
+}
+
+// Parse validates values against the spec. All problems are collected
+// into a single Errors value.
+func (s Spec) Parse(values url.Values) (Query, error) {
+	var q Query
+	var errs Errors
+
+	filters := make(map[string]Filter, len(s.Filters))
+	for _, f := range s.Filters {
+		filters[f.Param] = f
+	}
+	known := make(map[string]bool, len(s.Params))
+	for _, p := range s.Params {
+		known[p] = true
+	}
+
+	// sorted keys keep the error order stable
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		raw := values[key]
+		switch {
+		case key == "sort":
+			orders, sortErrs := s.parseSort(raw[len(raw)-1])
+			errs = append(errs, sortErrs...)
+			q.orders = orders
+			q.sorted = len(orders) > 0
+		case known[key]:
+		default:
+			f, ok := filters[key]
+			if !ok {
+				errs = append(errs, FieldError{Field: key, Error: "unknown field"})
+				continue
+			}
+			v, err := parseValue(f.Type, raw[len(raw)-1])
+			if err != nil {
+				errs = append(errs, FieldError{Field: key, Error: err.Error()})
+				continue
+			}
+			q.conditions = append(q.conditions, condition{filter: f, value: v})
+		}
+	}
+
+	if !q.sorted && s.Default != "" {
+		orders, sortErrs := s.parseSort(s.Default)
+		if len(sortErrs) > 0 {
+			panic("listquery: invalid default sort " + s.Default)
+		}
+		q.orders = orders
+	}
+	if s.Tiebreak != "" && !q.orderedBy(s.Tiebreak) {
+		desc := len(q.orders) > 0 && q.orders[len(q.orders)-1].desc
+		q.orders = append(q.orders, order{column: s.Tiebreak, desc: desc})
+	}
+
+	if len(errs) > 0 {
+		return Query{}, errs
+	}
+	return q, nil
+}
+
+func (q Query) orderedBy(column string) bool {
+	for _, o := range q.orders {
+		if o.column == column {
+			return true
+		}
+	}
+	return false
+}
+
+func (s Spec) parseSort(raw string) ([]order, Errors) {
+	var orders []order
+	var errs Errors
+
+	for _, field := range strings.Split(raw, ",") {
+		field = strings.TrimSpace(field)
+		if field == "" {
+			continue
+		}
+		desc := strings.HasPrefix(field, "-")
+		name := strings.TrimPrefix(field, "-")
+
+		column, ok := s.Sort[name]
+		if !ok {
+			errs = append(errs, FieldError{Field: "sort", Error: fmt.Sprintf("cannot sort by %q", name)})
+			continue
+		}
+		orders = append(orders, order{column: column, desc: desc})
+	}
+	return orders, errs
+}
+
+func parseValue(t Type, raw string) (any, error) {
+	switch t {
+	case Bool:
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			return nil, fmt.Errorf("must be true or false")
+		}
+		return v, nil
+	case Int:
+		v, err := strconv.ParseInt(raw, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("must be an integer")
+		}
+		return v, nil
+	case Time:
+		if v, err := time.Parse(time.RFC3339, raw); err == nil {
+			return v, nil
+		}
+		if v, err := time.Parse(time.DateOnly, raw); err == nil {
+			return v, nil
+		}
+		return nil, fmt.Errorf("must be an RFC 3339 timestamp or a YYYY-MM-DD date")
+	default:
+		return raw, nil
+	}
+}
+
+// Where scopes a query to the parsed filters.
+func (q Query) Where() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, c := range q.conditions {
+			if c.filter.Scope != nil {
+				db = db.Scopes(c.filter.Scope(c.value))
+				continue
+			}
+			db = db.Where(c.filter.Column+" "+string(c.filter.Op)+" ?", c.value)
+		}
+		return db
+	}
+}
+
+// Order applies the parsed sort, or the spec's default one. GORM runs
+// scopes last, so columns ordered directly on the query come first.
+func (q Query) Order() func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, o := range q.orders {
+			if o.desc {
+				db = db.Order(o.column + " DESC")
+			} else {
+				db = db.Order(o.column)
+			}
+		}
+		return db
+	}
+}
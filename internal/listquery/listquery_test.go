@@ -0,0 +1,107 @@
+package listquery
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var spec = Spec{
+	Sort:     map[string]string{"updated_at": "notes.updated_at", "title": "notes.title", "id": "notes.id"},
+	Default:  "-updated_at",
+	Tiebreak: "notes.id",
+	Filters: []Filter{
+		{Param: "pinned", Column: "notes.pinned", Op: Eq, Type: Bool},
+		{Param: "created_after", Column: "notes.created_at", Op: Gt, Type: Time},
+		{Param: "min_version", Column: "notes.version", Op: Gte, Type: Int},
+		{Param: "title", Column: "notes.title", Op: Eq, Type: String},
+	},
+	Params: []string{"page", "limit"},
+}
+
+func parse(t *testing.T, query string) (Query, error) {
+	t.Helper()
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return spec.Parse(values)
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		query string
+		want  Errors
+	}{
+		{"sort=password", Errors{{"sort", `cannot sort by "password"`}}},
+		{"sort=title,-secret,-id", Errors{{"sort", `cannot sort by "secret"`}}},
+		{"user_id=2", Errors{{"user_id", "unknown field"}}},
+		{"pinned=maybe", Errors{{"pinned", "must be true or false"}}},
+		{"min_version=two", Errors{{"min_version", "must be an integer"}}},
+		{"created_after=last+week", Errors{{"created_after", "must be an RFC 3339 timestamp or a YYYY-MM-DD date"}}},
+		// every problem is reported, in the order of the parameters
+		{"zzz=1&sort=nope&page=2&aaa=1", Errors{{"aaa", "unknown field"}, {"sort", `cannot sort by "nope"`}, {"zzz", "unknown field"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parse(t, tt.query)
+			var got Errors
+			if !errors.As(err, &got) {
+				t.Fatalf("got %+v, %v", q, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query      string
+		sorted     bool
+		orders     []order
+		conditions []any
+	}{
+		{"", false, []order{{"notes.updated_at", true}, {"notes.id", true}}, nil},
+		{"page=2&limit=5", false, []order{{"notes.updated_at", true}, {"notes.id", true}}, nil},
+		{"sort=title", true, []order{{"notes.title", false}, {"notes.id", false}}, nil},
+		// the tiebreak is not added twice
+		{"sort=-title,id", true, []order{{"notes.title", true}, {"notes.id", false}}, nil},
+		{"sort=,", false, []order{{"notes.updated_at", true}, {"notes.id", true}}, nil},
+		{
+			"pinned=true&created_after=2026-01-02&min_version=3&title=a+b", false,
+			[]order{{"notes.updated_at", true}, {"notes.id", true}},
+			[]any{time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), int64(3), true, "a b"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q, err := parse(t, tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if q.Sorted() != tt.sorted || !reflect.DeepEqual(q.orders, tt.orders) {
+				t.Fatalf("sorted %v by %+v", q.Sorted(), q.orders)
+			}
+			var values []any
+			for _, c := range q.conditions {
+				values = append(values, c.value)
+			}
+			if !reflect.DeepEqual(values, tt.conditions) {
+				t.Fatalf("conditions %#v", values)
+			}
+		})
+	}
+}
+
+func TestInvalidDefaultPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic")
+		}
+	}()
+	Spec{Sort: map[string]string{"id": "id"}, Default: "-name"}.Parse(url.Values{})
+}
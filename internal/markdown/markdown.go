@@ -0,0 +1,175 @@
+package markdown
+
+import (
+	"bytes"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/extension"
+)
+
+// Format is an output representation of note content.
+type Format string
+
+const (
+	FormatMarkdown Format = "markdown"
+	FormatHTML     Format = "html"
+	FormatText     Format = "text"
+)
+
+var (
+	md = goldmark.New(
+		goldmark.WithExtensions(
+			extension.GFM,
+			highlighting.NewHighlighting(
+				highlighting.WithStyle("github"),
+				highlighting.WithFormatOptions(chromahtml.WithClasses(true)),
+			),
+		),
+	)
+
+	policy = newPolicy()
+	strict = bluemonday.StrictPolicy()
+
+	blankLines = regexp.MustCompile(`\n{3,}`)
+)
+
+// newPolicy allows what GFM produces on top of the usual user-content
+// rules: task list checkboxes and the class names used for highlighting.
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^[a-zA-Z0-9 _-]+$`)).OnElements("pre", "code", "span")
+	return p
+}
+
+// HTML renders CommonMark + GFM to sanitised HTML that is safe to embed.
+func HTML(src string) (string, error) {
+	var buf bytes.Buffer
+	if err := md.Convert([]byte(src), &buf); err != nil {
+		return "", err
+	}
+	return policy.Sanitize(buf.String()), nil
+}
+
+// Text renders markdown to plain text by dropping all markup.
+func Text(src string) (string, error) {
+	h, err := HTML(src)
+	if err != nil {
+		return "", err
+	}
+	text := html.UnescapeString(strict.Sanitize(h))
+	return strings.TrimSpace(blankLines.ReplaceAllString(text, "\n\n")), nil
+}
+
+// Render converts src to the requested format. Markdown is returned as is.
+func Render(src string, f Format) (string, error) {
+	switch f {
+	case FormatHTML:
+		return HTML(src)
+	case FormatText:
+		return Text(src)
+	default:
+		return src, nil
+	}
+}
+
+// WikiLink is a [[Note Title]] or [[id:123]] reference in note content.
+// Exactly one of Title and ID is set.
+type WikiLink struct {
+	Title string
+	ID    int64
+}
+
+// wikiLink matches wiki links, and code so that links in it can be left
+// alone: only the matches starting with [[ are links.
+var wikiLink = regexp.MustCompile("(?s)(```.*?```|~~~.*?~~~|`[^`\n]+`)|\\[\\[([^\\[\\]\\n]+)\\]\\]")
+
+func parseWikiLink(inner string) (WikiLink, bool) {
+	inner = strings.TrimSpace(inner)
+	if rest, ok := strings.CutPrefix(inner, "id:"); ok {
+		id, err := strconv.ParseInt(strings.TrimSpace(rest), 10, 64)
+		if err != nil || id <= 0 {
+			return WikiLink{}, false
+		}
+		return WikiLink{ID: id}, true
+	}
+	return WikiLink{Title: inner}, inner != ""
+}
+
+// replaceWikiLinks calls fn for every wiki link outside of code in src and
+// replaces the link with what it returns.
+func replaceWikiLinks(src string, fn func(m string, l WikiLink) string) string {
+	return wikiLink.ReplaceAllStringFunc(src, func(m string) string {
+		if !strings.HasPrefix(m, "[[") {
+			return m
+		}
+		l, ok := parseWikiLink(m[2 : len(m)-2])
+		if !ok {
+			return m
+		}
+		return fn(m, l)
+	})
+}
+
+// FindWikiLinks returns the distinct wiki links in src in the order they
+// first appear. Titles are compared case-insensitively.
+func FindWikiLinks(src string) []WikiLink {
+	var links []WikiLink
+	seen := map[WikiLink]bool{}
+	replaceWikiLinks(src, func(m string, l WikiLink) string {
+		key := WikiLink{Title: strings.ToLower(l.Title), ID: l.ID}
+		if !seen[key] {
+			seen[key] = true
+			links = append(links, l)
+		}
+		return m
+	})
+	return links
+}
+
+// LinkWikiLinks turns the wiki links in src into markdown links to the
+// URLs href returns, so that HTML renders them clickable.
+func LinkWikiLinks(src string, href func(WikiLink) string) string {
+	return replaceWikiLinks(src, func(_ string, l WikiLink) string {
+		text := l.Title
+		if text == "" {
+			text = "#" + strconv.FormatInt(l.ID, 10)
+		}
+		return "[" + escapePunct(text) + "](<" + href(l) + ">)"
+	})
+}
+
+// ReplaceWikiTitle rewrites the [[from]] links in src to [[to]], matching
+// from case-insensitively. It reports whether anything changed.
+func ReplaceWikiTitle(src, from, to string) (string, bool) {
+	changed := false
+	out := replaceWikiLinks(src, func(m string, l WikiLink) string {
+		if l.ID != 0 || !strings.EqualFold(l.Title, from) {
+			return m
+		}
+		changed = true
+		return "[[" + to + "]]"
+	})
+	return out, changed
+}
+
+// escapePunct backslash-escapes ASCII punctuation so that text is not
+// taken for markup.
+func escapePunct(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r < 128 && strings.ContainsRune("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", r) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
@@ -0,0 +1,149 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLStripsScripts(t *testing.T) {
+	tests := []string{
+		"<script>alert(1)</script>",
+		"hi <script>alert(1)</script> there",
+		"<SCRIPT SRC=//evil.example/x.js></SCRIPT>",
+		"<img src=x onerror=alert(1)>",
+		`<a href="#" onclick="alert(1)">x</a>`,
+		"<iframe src=\"https://evil.example\"></iframe>",
+		"<svg onload=alert(1)>",
+		"<style>body{display:none}</style>",
+		"```html\n<script>alert(1)</script>\n```",
+	}
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			got, err := HTML(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lower := strings.ToLower(got)
+			for _, bad := range []string{"<script", "onerror", "onclick", "onload", "<iframe", "<svg", "<style"} {
+				if strings.Contains(lower, bad) {
+					t.Fatalf("%s left in %q", bad, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHTMLDropsUnsafeLinks(t *testing.T) {
+	tests := []string{
+		"[x](javascript:alert(1))",
+		"[x](JavaScript:alert(1))",
+		"[x](javascript&#58;alert(1))",
+		"[x](vbscript:msgbox)",
+		"[x](data:text/html;base64,PHNjcmlwdD5hbGVydCgxKTwvc2NyaXB0Pg==)",
+		"![x](javascript:alert(1))",
+		`<a href="javascript:alert(1)">x</a>`,
+		`<a href=" javascript:alert(1)">x</a>`,
+		"<javascript:alert(1)>",
+	}
+	for _, src := range tests {
+		t.Run(src, func(t *testing.T) {
+			got, err := HTML(src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			lower := strings.ToLower(got)
+			for _, bad := range []string{"javascript", "vbscript", "data:"} {
+				if strings.Contains(lower, `href="`+bad) || strings.Contains(lower, `src="`+bad) {
+					t.Fatalf("%s link left in %q", bad, got)
+				}
+			}
+		})
+	}
+}
+
+func TestHTMLKeepsMarkdown(t *testing.T) {
+	tests := []struct {
+		src, want string
+	}{
+		{"# Title", "<h1>Title</h1>"},
+		{"**bold** and _it_", "<p><strong>bold</strong> and <em>it</em></p>"},
+		{"~~gone~~", "<p><del>gone</del></p>"},
+		{"[site](https://example.com)", `<p><a href="https://example.com" rel="nofollow">site</a></p>`},
+		{"- [x] done\n- [ ] todo", `<li><input checked="" disabled="" type="checkbox"> done</li>`},
+		{"| a |\n|---|\n| 1 |", "<td>1</td>"},
+		{"```go\nfunc f() {}\n```", `<pre class="chroma"><code><span class="line"><span class="cl"><span class="kd">func</span>`},
+		{"`a < b`", "<p><code>a &lt; b</code></p>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.src, func(t *testing.T) {
+			got, err := HTML(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Fatalf("got %q, want it to contain %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLDropsRawHTML(t *testing.T) {
+	// raw HTML never reaches the sanitizer; the text between tags stays
+	got, err := HTML(`<span class="kd">a</span> <b onclick="x()">b</b>`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "<p>a b</p>\n" {
+		t.Fatalf("got %q", got)
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`<script>alert(1)</script>x`, "x"},
+		{`<a href="javascript:alert(1)">x</a>`, "x"},
+		{`<a href="https://example.com" onclick="x()">x</a>`, `<a href="https://example.com" rel="nofollow">x</a>`},
+		{`<span class="kd">a</span>`, `<span class="kd">a</span>`},
+		{`<span class="a&quot;onclick=x">a</span>`, `<span>a</span>`},
+		{`<p class="kd">a</p>`, `<p>a</p>`},
+		{`<input type="checkbox" checked disabled>`, `<input type="checkbox" checked="" disabled="">`},
+		{`<input type="text" value="x">`, ""},
+	}
+	for _, tt := range tests {
+		if got := policy.Sanitize(tt.in); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestText(t *testing.T) {
+	got, err := Text("# Title\n\nSome **bold** & <script>alert(1)</script> text\n\n\n\n- one\n- two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Title\nSome bold & alert(1) text\n\none\ntwo"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestRender(t *testing.T) {
+	src := "*hi* <b>x</b>"
+	tests := []struct {
+		f    Format
+		want string
+	}{
+		{FormatMarkdown, src},
+		{"", src},
+		{FormatHTML, "<p><em>hi</em> x</p>\n"},
+		{FormatText, "hi x"},
+	}
+	for _, tt := range tests {
+		got, err := Render(src, tt.f)
+		if err != nil || got != tt.want {
+			t.Errorf("%q: got %q, %v, want %q", tt.f, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package notes
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/events"
+)
+
+// ErrBulkAborted is returned by Bulk in atomic mode when any item failed
+// and the whole batch was rolled back.
+var ErrBulkAborted = errors.New("bulk operation rolled back because an item failed")
+
+type BulkOp string
+
+const (
+	BulkDelete  BulkOp = "delete"
+	BulkRestore BulkOp = "restore"
+	BulkTag     BulkOp = "tag"
+	BulkUntag   BulkOp = "untag"
+	BulkMove    BulkOp = "move"
+
+	BulkPin       BulkOp = "pin"
+	BulkUnpin     BulkOp = "unpin"
+	BulkArchive   BulkOp = "archive"
+	BulkUnarchive BulkOp = "unarchive"
+)
+
+// BulkRequest applies one operation to many notes.
+type BulkRequest struct {
+	IDs        []int64
+	Op         BulkOp
+	Tags       []string // for tag / untag
+	NotebookID *int64   // for move; nil moves to the top level
+	// Atomic rolls back every item when any one of them fails.
+	Atomic bool
+}
+
+// BulkResult reports the outcome for a single note of a bulk request.
+type BulkResult struct {
+	ID    int64  `json:"id"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// withTx returns a copy of the service whose queries run in tx. The
+// events it publishes are held back in pending; callers publish them with
+// publishAll once tx committed.
+func (s *Service) withTx(tx *gorm.DB) *Service {
+	return &Service{db: tx, keepRevisions: s.keepRevisions, events: s.events, pending: &[]events.Event{}}
+}
+
+// Bulk runs req inside a single transaction. Each note is applied in its
+// own savepoint so one failing note does not undo the others, unless
+// req.Atomic is set.
+func (s *Service) Bulk(userID uint, req BulkRequest) ([]BulkResult, error) {
+	results := make([]BulkResult, 0, len(req.IDs))
+	var pending []events.Event
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		failed := false
+
+		for _, id := range req.IDs {
+			var txs *Service
+			err := tx.Transaction(func(itx *gorm.DB) error {
+				txs = s.withTx(itx)
+				return txs.bulkOne(userID, id, req)
+			})
+
+			res := BulkResult{ID: id, OK: err == nil}
+			if err != nil {
+				res.Error = err.Error()
+				failed = true
+			} else {
+				pending = append(pending, *txs.pending...)
+			}
+			results = append(results, res)
+		}
+
+		if failed && req.Atomic {
+			return ErrBulkAborted
+		}
+		return nil
+	})
+	if err == nil {
+		s.publishAll(pending)
+	}
+
+	return results, err
+}
+
+func (s *Service) bulkOne(userID uint, id int64, req BulkRequest) error {
+	var err error
+
+	switch req.Op {
+	case BulkDelete:
+		err = s.Delete(userID, id, 0)
+	case BulkRestore:
+		_, err = s.Untrash(userID, id)
+	case BulkTag:
+		_, err = s.AttachTags(userID, id, req.Tags)
+	case BulkUntag:
+		for _, name := range req.Tags {
+			if _, err = s.DetachTag(userID, id, name); err != nil {
+				break
+			}
+		}
+	case BulkMove:
+		_, err = s.MoveNote(userID, id, req.NotebookID)
+	case BulkPin, BulkUnpin:
+		_, err = s.SetState(userID, id, State{Pinned: boolPtr(req.Op == BulkPin)})
+	case BulkArchive, BulkUnarchive:
+		_, err = s.SetState(userID, id, State{Archived: boolPtr(req.Op == BulkArchive)})
+	default:
+		err = errors.New("unknown operation")
+	}
+
+	return err
+}
@@ -0,0 +1,80 @@
+package notes
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+type bulkReq struct {
+	IDs        []int64  `json:"ids" binding:"required,min=1,max=500"`
+	Op         BulkOp   `json:"op" binding:"required,oneof=delete restore tag untag move pin unpin archive unarchive"`
+	Tags       []string `json:"tags" binding:"omitempty,max=20,dive,min=1,max=32"`
+	NotebookID *int64   `json:"notebook_id"`
+	Atomic     bool     `json:"atomic"`
+}
+
+type bulkReport struct {
+	Succeeded int          `json:"succeeded"`
+	Failed    int          `json:"failed"`
+	Results   []BulkResult `json:"results"`
+}
+
+func newBulkReport(results []BulkResult) bulkReport {
+	r := bulkReport{Results: results}
+	for _, res := range results {
+		if res.OK {
+			r.Succeeded++
+		} else {
+			r.Failed++
+		}
+	}
+	return r
+}
+
+// BulkNotes godoc
+// @Summary Bulk note operation
+// @Description Apply delete, restore, tag, untag, move, pin, unpin, archive or unarchive to many notes in one transaction and report per note
+// @Tags notes
+// @Accept json
+// @Produce json
+// @Param payload body bulkReq true "Bulk request"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/bulk [post]
+func (h *Handler) bulk(c *gin.Context) {
+	var req bulkReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if (req.Op == BulkTag || req.Op == BulkUntag) && len(req.Tags) == 0 {
+		response.ValidationError(c, "tags are required for "+string(req.Op))
+		return
+	}
+
+	results, err := h.svc.Bulk(c.GetUint("userID"), BulkRequest{
+		IDs:        req.IDs,
+		Op:         req.Op,
+		Tags:       req.Tags,
+		NotebookID: req.NotebookID,
+		Atomic:     req.Atomic,
+	})
+	if errors.Is(err, ErrBulkAborted) {
+		c.JSON(http.StatusConflict, response.ErrorResponse{
+			Error:   err.Error(),
+			Details: newBulkReport(results),
+		})
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+
+	response.Success(c, "Bulk operation completed", newBulkReport(results))
+}
@@ -0,0 +1,194 @@
+package notes
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/tmsankram/gonotes/internal/events"
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+// drain takes the events waiting on s without blocking.
+func drain(s *events.Subscription) []string {
+	var got []string
+	for {
+		select {
+		case e := <-s.C:
+			got = append(got, fmt.Sprintf("%s %d", e.Type, e.Data.(NoteEvent).ID))
+		default:
+			return got
+		}
+	}
+}
+
+func newBulkService(t *testing.T) (*Service, *events.Subscription) {
+	t.Helper()
+	svc := newTestService(t)
+	svc.events = events.NewBus(100)
+	sub := svc.events.SubscribeAll(0, false)
+	t.Cleanup(func() { svc.events.Unsubscribe(sub) })
+	return svc, sub
+}
+
+func bulkNotes(t *testing.T, svc *Service, user uint, count int) []int64 {
+	t.Helper()
+	var ids []int64
+	for range count {
+		n, err := svc.Create(Note{UserID: user, Title: "Note", Content: "x"}, []string{"home"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestBulkKeepsOtherItems(t *testing.T) {
+	svc, sub := newBulkService(t)
+	ids := bulkNotes(t, svc, alice, 2)
+	bobs := bulkNotes(t, svc, bob, 1)[0]
+	drain(sub)
+
+	results, err := svc.Bulk(alice, BulkRequest{IDs: []int64{ids[0], 999, bobs, ids[1]}, Op: BulkPin})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ok []bool
+	for _, r := range results {
+		ok = append(ok, r.OK)
+		if !r.OK && r.Error == "" {
+			t.Fatalf("no error for %+v", r)
+		}
+	}
+	if !slices.Equal(ok, []bool{true, false, false, true}) {
+		t.Fatalf("results %+v", results)
+	}
+	for _, id := range ids {
+		if n, _ := svc.GetByID(alice, id); !n.Pinned {
+			t.Fatalf("note %d not pinned", id)
+		}
+	}
+	want := []string{fmt.Sprintf("note.updated %d", ids[0]), fmt.Sprintf("note.updated %d", ids[1])}
+	if got := drain(sub); !slices.Equal(got, want) {
+		t.Fatalf("events %v", got)
+	}
+}
+
+func TestBulkItemRollsBackAlone(t *testing.T) {
+	svc, sub := newBulkService(t)
+	for _, id := range []uint{alice, bob} {
+		u := users.User{ID: id, Name: fmt.Sprint(id), Email: fmt.Sprintf("%d@example.com", id), Password: "x"}
+		if err := svc.db.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	mine := bulkNotes(t, svc, alice, 1)[0]
+	shared, err := svc.Create(Note{UserID: bob, Title: "Shared", Content: "x"}, []string{"home", "work"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Share(bob, shared.ID, alice, PermEdit); err != nil {
+		t.Fatal(err)
+	}
+	drain(sub)
+
+	// alice has no "work" tag, so untagging her note fails after its
+	// "home" tag was already removed; the savepoint puts that back
+	results, err := svc.Bulk(alice, BulkRequest{IDs: []int64{mine, shared.ID}, Op: BulkUntag, Tags: []string{"home", "work"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if results[0].OK || !results[1].OK {
+		t.Fatalf("results %+v", results)
+	}
+	n, _ := svc.GetByID(alice, mine)
+	if !slices.Equal(tagNames(n), []string{"home"}) || n.Version != 1 {
+		t.Fatalf("failed item changed: %+v", n)
+	}
+	if n, _ = svc.GetByID(alice, shared.ID); len(n.Tags) != 0 {
+		t.Fatalf("shared note kept %v", tagNames(n))
+	}
+	// only the item that went through is announced, once per tag
+	want := []string{fmt.Sprintf("note.updated %d", shared.ID), fmt.Sprintf("note.updated %d", shared.ID)}
+	if got := drain(sub); !slices.Equal(got, want) {
+		t.Fatalf("events %v", got)
+	}
+}
+
+func TestBulkAtomic(t *testing.T) {
+	svc, sub := newBulkService(t)
+	ids := bulkNotes(t, svc, alice, 2)
+	drain(sub)
+
+	results, err := svc.Bulk(alice, BulkRequest{IDs: append(ids, 999), Op: BulkDelete, Atomic: true})
+	if !errors.Is(err, ErrBulkAborted) {
+		t.Fatalf("got %v", err)
+	}
+	if len(results) != 3 || !results[0].OK || !results[1].OK || results[2].OK {
+		t.Fatalf("results %+v", results)
+	}
+	for _, id := range ids {
+		if _, err := svc.GetByID(alice, id); err != nil {
+			t.Fatalf("note %d: %v", id, err)
+		}
+	}
+	if got := drain(sub); len(got) != 0 {
+		t.Fatalf("rolled back changes announced: %v", got)
+	}
+
+	if _, err := svc.Bulk(alice, BulkRequest{IDs: ids, Op: BulkDelete, Atomic: true}); err != nil {
+		t.Fatal(err)
+	}
+	if _, total, _ := svc.Trash(alice, 1, 10); total != 2 {
+		t.Fatalf("%d notes in the trash", total)
+	}
+	if got := drain(sub); len(got) != 2 {
+		t.Fatalf("events %v", got)
+	}
+}
+
+func TestBulkOps(t *testing.T) {
+	svc := newTestService(t)
+	ids := bulkNotes(t, svc, alice, 2)
+	nb, err := svc.CreateNotebook(alice, "box", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(req BulkRequest) {
+		t.Helper()
+		req.IDs = ids
+		results, err := svc.Bulk(alice, req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range results {
+			if !r.OK {
+				t.Fatalf("%s: %+v", req.Op, r)
+			}
+		}
+	}
+	run(BulkRequest{Op: BulkTag, Tags: []string{"work"}})
+	run(BulkRequest{Op: BulkMove, NotebookID: &nb.ID})
+	run(BulkRequest{Op: BulkArchive})
+	run(BulkRequest{Op: BulkPin})
+	for _, id := range ids {
+		n, _ := svc.GetByID(alice, id)
+		if !slices.Equal(tagNames(n), []string{"home", "work"}) || n.NotebookID == nil || !n.Archived || !n.Pinned {
+			t.Fatalf("note %+v", n)
+		}
+	}
+
+	run(BulkRequest{Op: BulkDelete})
+	run(BulkRequest{Op: BulkRestore})
+	if _, total, _ := svc.Trash(alice, 1, 10); total != 0 {
+		t.Fatalf("%d notes left in the trash", total)
+	}
+
+	results, err := svc.Bulk(alice, BulkRequest{IDs: ids, Op: "explode"})
+	if err != nil || results[0].OK || results[0].Error != "unknown operation" {
+		t.Fatalf("got %+v, %v", results, err)
+	}
+}
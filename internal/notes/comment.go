@@ -0,0 +1,98 @@
+package notes
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrCommentNotFound is returned when a comment does not exist on the note.
+var ErrCommentNotFound = errors.New("comment not found")
+
+// Comment is a remark a user left on a note they may comment on.
+type Comment struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	NoteID    int64     `gorm:"not null;index" json:"note_id"`
+	UserID    uint      `gorm:"not null;index" json:"user_id"`
+	Body      string    `gorm:"not null" json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// filled from the users table when listing comments
+	Email string `gorm:"->;-:migration" json:"email,omitempty"`
+	Name  string `gorm:"->;-:migration" json:"name,omitempty"`
+}
+
+// CanComment reports whether the user may comment on a note: its owner
+// and grantees with the comment or edit permission. Users without any
+// access get ErrNotFound.
+func (s *Service) CanComment(userID uint, id int64) (bool, error) {
+	_, err := s.authorize(userID, id, PermComment)
+	if errors.Is(err, ErrForbidden) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Comments lists the comments on a note, oldest first. Everyone who can
+// read the note can read them.
+func (s *Service) Comments(userID uint, noteID int64) ([]Comment, error) {
+	if _, err := s.authorize(userID, noteID, PermRead); err != nil {
+		return nil, err
+	}
+
+	comments := []Comment{}
+	err := s.commentsWithUsers().
+		Where("comments.note_id = ?", noteID).
+		Order("comments.created_at, comments.id").
+		Find(&comments).Error
+	return comments, err
+}
+
+// AddComment leaves a comment on a note.
+func (s *Service) AddComment(userID uint, noteID int64, body string) (Comment, error) {
+	if _, err := s.authorize(userID, noteID, PermComment); err != nil {
+		return Comment{}, err
+	}
+
+	cm := Comment{NoteID: noteID, UserID: userID, Body: body}
+	if err := s.db.Create(&cm).Error; err != nil {
+		return Comment{}, err
+	}
+	return s.comment(noteID, cm.ID)
+}
+
+// DeleteComment removes a comment. Authors can delete their own comments
+// and the note's owner can delete any of them.
+func (s *Service) DeleteComment(userID uint, noteID, commentID int64) error {
+	n, err := s.authorize(userID, noteID, PermRead)
+	if err != nil {
+		return err
+	}
+
+	cm, err := s.comment(noteID, commentID)
+	if err != nil {
+		return err
+	}
+	if cm.UserID != userID && n.UserID != userID {
+		return ErrForbidden
+	}
+	return s.db.Delete(&cm).Error
+}
+
+func (s *Service) comment(noteID, id int64) (Comment, error) {
+	var cm Comment
+	err := s.commentsWithUsers().
+		Where("comments.note_id = ? AND comments.id = ?", noteID, id).
+		First(&cm).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return cm, ErrCommentNotFound
+	}
+	return cm, err
+}
+
+func (s *Service) commentsWithUsers() *gorm.DB {
+	return s.db.Model(&Comment{}).
+		Select("comments.*, users.email, users.name").
+		Joins("LEFT JOIN users ON users.id = comments.user_id")
+}
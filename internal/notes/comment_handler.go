@@ -0,0 +1,110 @@
+package notes
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+type commentReq struct {
+	Body string `json:"body" binding:"required,min=1,max=2000"`
+}
+
+// commentError maps comment service errors to responses.
+func commentError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrCommentNotFound):
+		response.NotFound(c, err)
+	case errors.Is(err, ErrForbidden):
+		response.Forbidden(c, err)
+	default:
+		response.Internal(c, err)
+	}
+}
+
+// ListComments godoc
+// @Summary List note comments
+// @Description Get the comments on a note, oldest first
+// @Tags sharing
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/comments [get]
+func (h *Handler) listComments(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	comments, err := h.svc.Comments(c.GetUint("userID"), id)
+	if err != nil {
+		commentError(c, err)
+		return
+	}
+	response.Success(c, "Comments retrieved successfully", comments)
+}
+
+// AddComment godoc
+// @Summary Comment on note
+// @Description Leave a comment on a note; needs the comment or edit permission
+// @Tags sharing
+// @Accept json
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param payload body commentReq true "Comment"
+// @Success 201 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/comments [post]
+func (h *Handler) addComment(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req commentReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	cm, err := h.svc.AddComment(c.GetUint("userID"), id, req.Body)
+	if err != nil {
+		commentError(c, err)
+		return
+	}
+	response.Created(c, "Comment added successfully", cm)
+}
+
+// DeleteComment godoc
+// @Summary Delete comment
+// @Description Remove a comment; authors can remove their own, the note's owner any
+// @Tags sharing
+// @Param id path int true "Note ID"
+// @Param comment path int true "Comment ID"
+// @Success 204
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/comments/{comment} [delete]
+func (h *Handler) deleteComment(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	commentID, ok := paramID(c, "comment")
+	if !ok {
+		return
+	}
+
+	if err := h.svc.DeleteComment(c.GetUint("userID"), id, commentID); err != nil {
+		commentError(c, err)
+		return
+	}
+	response.NoContent(c)
+}
@@ -0,0 +1,165 @@
+package notes
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+// commentFixture is a note of bob's shared with a reader, a commenter and
+// an editor; alice has no access.
+type commentFixture struct {
+	svc                       *Service
+	note                      Note
+	reader, commenter, editor uint
+}
+
+func newCommentFixture(t *testing.T) commentFixture {
+	t.Helper()
+	svc := newTestService(t)
+	f := commentFixture{svc: svc, reader: 3, commenter: 4, editor: 5}
+
+	for _, id := range []uint{alice, bob, f.reader, f.commenter, f.editor} {
+		u := users.User{ID: id, Name: fmt.Sprintf("User %d", id), Email: fmt.Sprintf("user%d@example.com", id), Password: "x"}
+		if err := svc.db.Create(&u).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := svc.Create(Note{UserID: bob, Title: "Design review", Content: "Draft of the plan"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.note = n
+	for id, perm := range map[uint]Permission{f.reader: PermRead, f.commenter: PermComment, f.editor: PermEdit} {
+		if _, err := svc.Share(bob, n.ID, id, perm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+func TestAddCommentPermissions(t *testing.T) {
+	f := newCommentFixture(t)
+
+	tests := []struct {
+		name   string
+		userID uint
+		want   error
+	}{
+		{"owner", bob, nil},
+		{"editor", f.editor, nil},
+		{"commenter", f.commenter, nil},
+		{"reader", f.reader, ErrForbidden},
+		{"stranger", alice, ErrNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cm, err := f.svc.AddComment(tt.userID, f.note.ID, "Looks good to me")
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("got %v, want %v", err, tt.want)
+			}
+			if err == nil && (cm.UserID != tt.userID || cm.Email == "") {
+				t.Fatalf("got %+v", cm)
+			}
+
+			can, err := f.svc.CanComment(tt.userID, f.note.ID)
+			if tt.want == ErrNotFound {
+				if !errors.Is(err, ErrNotFound) {
+					t.Fatalf("CanComment: got %v", err)
+				}
+				return
+			}
+			if err != nil || can != (tt.want == nil) {
+				t.Fatalf("CanComment = %v, %v", can, err)
+			}
+		})
+	}
+
+	// readers see every comment, strangers none
+	comments, err := f.svc.Comments(f.reader, f.note.ID)
+	if err != nil || len(comments) != 3 {
+		t.Fatalf("got %d comments, %v", len(comments), err)
+	}
+	if _, err := f.svc.Comments(alice, f.note.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("stranger: got %v", err)
+	}
+}
+
+func TestDeleteComment(t *testing.T) {
+	f := newCommentFixture(t)
+
+	mine, err := f.svc.AddComment(f.commenter, f.note.ID, "First thought")
+	if err != nil {
+		t.Fatal(err)
+	}
+	theirs, err := f.svc.AddComment(f.editor, f.note.ID, "Second thought")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := f.svc.DeleteComment(f.commenter, f.note.ID, theirs.ID); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("deleting another's comment: got %v", err)
+	}
+	if err := f.svc.DeleteComment(alice, f.note.ID, theirs.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("stranger: got %v", err)
+	}
+	if err := f.svc.DeleteComment(f.commenter, f.note.ID, mine.ID); err != nil {
+		t.Fatalf("deleting own comment: %v", err)
+	}
+	if err := f.svc.DeleteComment(bob, f.note.ID, theirs.ID); err != nil {
+		t.Fatalf("owner: %v", err)
+	}
+	if err := f.svc.DeleteComment(bob, f.note.ID, theirs.ID); !errors.Is(err, ErrCommentNotFound) {
+		t.Fatalf("deleted twice: got %v", err)
+	}
+}
+
+func TestCommentHandler(t *testing.T) {
+	f := newCommentFixture(t)
+	r := gin.New()
+	NewHandler(f.svc, users.NewService(f.svc.db)).RegisterRoutes(r)
+
+	token := func(userID uint) string {
+		tok, err := auth.GenerateToken(userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tok
+	}
+	path := fmt.Sprintf("/notes/%d/comments", f.note.ID)
+	body := `{"body": "Ship it"}`
+
+	tests := []struct {
+		name   string
+		userID uint
+		body   string
+		want   int
+	}{
+		{"commenter", f.commenter, body, http.StatusCreated},
+		{"reader", f.reader, body, http.StatusForbidden},
+		{"stranger", alice, body, http.StatusNotFound},
+		{"empty", f.commenter, `{"body": ""}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := serve(r, token(tt.userID), http.MethodPost, path, "application/json", tt.body)
+			if rec.Code != tt.want {
+				t.Fatalf("got %d: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+
+	if rec := serve(r, token(f.reader), http.MethodGet, path, "", ""); rec.Code != http.StatusOK {
+		t.Fatalf("reader listing: got %d", rec.Code)
+	}
+	if rec := serve(r, token(alice), http.MethodGet, path, "", ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("stranger listing: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,90 @@
+package notes
+
+import (
+	"strconv"
+
+	"github.com/tmsankram/gonotes/internal/pagination"
+)
+
+// noteCursor puts pinned notes in the higher cursor group.
+func noteCursor(n Note) *pagination.Cursor {
+	c := &pagination.Cursor{Time: n.UpdatedAt, ID: strconv.FormatInt(n.ID, 10)}
+	if n.Pinned {
+		c.Group = 1
+	}
+	return c
+}
+
+// Keyset lists pinned notes first and then by most recently updated, starting right after
+// (or, with before, right before) the given cursor. Unlike Paginated it
+// never counts and stays fast however deep the client scrolls.
+func (s *Service) Keyset(userID uint, f Filter, after, before *pagination.Cursor, limit int) (pagination.Page[Note], error) {
+	var page pagination.Page[Note]
+
+	q := s.db.Scopes(
+		owned(userID),
+		tagged(userID, f.Tags, f.MatchAllTags),
+		inNotebook(userID, f.NotebookID, f.Recursive),
+		unarchived(f.IncludeArchived),
+		f.Query.Where(),
+	).Preload("Tags")
+
+	cur := after
+	if before != nil {
+		cur = before
+	}
+	if cur != nil {
+		id, err := strconv.ParseInt(cur.ID, 10, 64)
+		if err != nil {
+			return page, pagination.ErrInvalidCursor
+		}
+		pinned := cur.Group > 0
+		if before != nil {
+			q = q.Where("(notes.pinned, notes.updated_at, notes.id) > (?, ?, ?)", pinned, cur.Time, id)
+		} else {
+			q = q.Where("(notes.pinned, notes.updated_at, notes.id) < (?, ?, ?)", pinned, cur.Time, id)
+		}
+	}
+
+	order := "notes.pinned DESC, notes.updated_at DESC, notes.id DESC"
+	if before != nil {
+		order = "notes.pinned ASC, notes.updated_at ASC, notes.id ASC"
+	}
+
+	// one extra row tells whether there is more beyond this page
+	var notes []Note
+	if err := q.Order(order).Limit(limit + 1).Find(&notes).Error; err != nil {
+		return page, err
+	}
+
+	more := len(notes) > limit
+	if more {
+		notes = notes[:limit]
+	}
+	if before != nil {
+		for i, j := 0, len(notes)-1; i < j; i, j = i+1, j-1 {
+			notes[i], notes[j] = notes[j], notes[i]
+		}
+	}
+
+	page.Items = notes
+	if len(notes) == 0 {
+		return page, nil
+	}
+
+	first, last := notes[0], notes[len(notes)-1]
+	if before != nil {
+		page.Next = noteCursor(last)
+		if more {
+			page.Prev = noteCursor(first)
+		}
+	} else {
+		if more {
+			page.Next = noteCursor(last)
+		}
+		if after != nil {
+			page.Prev = noteCursor(first)
+		}
+	}
+	return page, nil
+}
@@ -0,0 +1,99 @@
+package notes
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/tmsankram/gonotes/internal/pagination"
+)
+
+func pageIDs(page pagination.Page[Note]) []int64 {
+	ids := []int64{}
+	for _, n := range page.Items {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestKeysetAcrossEqualTimes(t *testing.T) {
+	svc := newTestService(t)
+	base := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	// several notes share an updated_at, pinned ones among them
+	notes := []struct {
+		pinned bool
+		at     time.Time
+	}{
+		{false, base},
+		{true, base},
+		{false, base.Add(time.Hour)},
+		{false, base},
+		{true, base},
+		{false, base.Add(-time.Hour)},
+		{false, base},
+	}
+	ids := make([]int64, len(notes))
+	for i, spec := range notes {
+		n, err := svc.Create(Note{UserID: alice, Title: "Note", Content: "x"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = svc.db.Model(&Note{}).Where("id = ?", n.ID).
+			UpdateColumns(map[string]any{"pinned": spec.pinned, "updated_at": spec.at}).Error
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids[i] = n.ID
+	}
+	// pinned first, then newest first, then highest id first
+	want := []int64{ids[4], ids[1], ids[2], ids[6], ids[3], ids[0], ids[5]}
+
+	var got []int64
+	var pages []pagination.Page[Note]
+	var after *pagination.Cursor
+	for {
+		page, err := svc.Keyset(alice, Filter{}, after, nil, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, pageIDs(page)...)
+		pages = append(pages, page)
+		if page.Next == nil {
+			break
+		}
+		if len(pages) > len(notes) {
+			t.Fatalf("no end after %v", got)
+		}
+		after = page.Next
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("forward %v, want %v", got, want)
+	}
+	if pages[0].Prev != nil {
+		t.Fatal("first page has a previous one")
+	}
+
+	// walking back from the last page gives the same pages
+	before := pages[len(pages)-1].Prev
+	for i := len(pages) - 2; i >= 0; i-- {
+		page, err := svc.Keyset(alice, Filter{}, nil, before, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(pageIDs(page), pageIDs(pages[i])) {
+			t.Fatalf("back to page %d: %v, want %v", i, pageIDs(page), pageIDs(pages[i]))
+		}
+		if (page.Prev == nil) != (i == 0) || page.Next == nil {
+			t.Fatalf("page %d: prev %v, next %v", i, page.Prev, page.Next)
+		}
+		before = page.Prev
+	}
+
+	// a cursor whose id is not a note id is refused
+	bad := &pagination.Cursor{Time: base, ID: "abc"}
+	if _, err := svc.Keyset(alice, Filter{}, bad, nil, 2); !errors.Is(err, pagination.ErrInvalidCursor) {
+		t.Fatalf("got %v", err)
+	}
+}
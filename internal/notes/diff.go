@@ -0,0 +1,209 @@
+package notes
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+type DiffOp string
+
+const (
+	DiffEqual  DiffOp = "equal"
+	DiffInsert DiffOp = "insert"
+	DiffDelete DiffOp = "delete"
+)
+
+// DiffChunk is a run of tokens that share the same operation.
+type DiffChunk struct {
+	Op   DiffOp `json:"op"`
+	Text string `json:"text"`
+}
+
+const diffContext = 3
+
+// diffTokens computes a minimal edit script between a and b using the
+// classic LCS table. Notes are capped at a few thousand characters, so the
+// quadratic cost is fine here.
+func diffTokens(a, b []string) []DiffChunk {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	var out []DiffChunk
+	push := func(op DiffOp, tok string) {
+		if len(out) > 0 && out[len(out)-1].Op == op {
+			out[len(out)-1].Text += tok
+			return
+		}
+		out = append(out, DiffChunk{Op: op, Text: tok})
+	}
+
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			push(DiffEqual, a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			push(DiffDelete, a[i])
+			i++
+		default:
+			push(DiffInsert, b[j])
+			j++
+		}
+	}
+	for ; i < n; i++ {
+		push(DiffDelete, a[i])
+	}
+	for ; j < m; j++ {
+		push(DiffInsert, b[j])
+	}
+	return out
+}
+
+// WordDiff returns the word-level differences between two texts.
+// Whitespace is kept as separate tokens so the chunks concatenate back to
+// the original strings.
+func WordDiff(from, to string) []DiffChunk {
+	return diffTokens(splitWords(from), splitWords(to))
+}
+
+func splitWords(s string) []string {
+	var out []string
+	start, prevSpace := 0, false
+	for i, r := range s {
+		space := unicode.IsSpace(r)
+		if i > 0 && space != prevSpace {
+			out = append(out, s[start:i])
+			start = i
+		}
+		prevSpace = space
+	}
+	if start < len(s) {
+		out = append(out, s[start:])
+	}
+	return out
+}
+
+// UnifiedDiff renders a line-based diff in the familiar `diff -u` format.
+func UnifiedDiff(fromName, toName, from, to string) string {
+	a, b := splitLines(from), splitLines(to)
+	chunks := diffTokens(a, b)
+
+	// flatten to one line per entry so hunks can be cut on line boundaries
+	type line struct {
+		op   DiffOp
+		text string
+	}
+	var lines []line
+	for _, c := range chunks {
+		for _, l := range splitLines(c.Text) {
+			lines = append(lines, line{c.Op, l})
+		}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+
+	aLine, bLine := 1, 1
+	for i := 0; i < len(lines); {
+		if lines[i].op == DiffEqual {
+			i++
+			aLine++
+			bLine++
+			continue
+		}
+
+		// widen the hunk backwards for context
+		start := i
+		for k := 0; k < diffContext && start > 0 && lines[start-1].op == DiffEqual; k++ {
+			start--
+		}
+		hunkA, hunkB := aLine-(i-start), bLine-(i-start)
+
+		// extend forward until a run of unchanged lines long enough to split on
+		end := i
+		for end < len(lines) {
+			if lines[end].op != DiffEqual {
+				end++
+				continue
+			}
+			run := end
+			for run < len(lines) && lines[run].op == DiffEqual {
+				run++
+			}
+			if run == len(lines) || run-end > 2*diffContext {
+				end = min(end+diffContext, run)
+				break
+			}
+			end = run
+		}
+
+		var body strings.Builder
+		countA, countB := 0, 0
+		for _, l := range lines[start:end] {
+			switch l.op {
+			case DiffEqual:
+				body.WriteString(" " + l.text)
+				countA++
+				countB++
+			case DiffDelete:
+				body.WriteString("-" + l.text)
+				countA++
+			case DiffInsert:
+				body.WriteString("+" + l.text)
+				countB++
+			}
+			if !strings.HasSuffix(l.text, "\n") {
+				body.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+
+		// like diff -u, an empty side starts at the line before the hunk
+		if countA == 0 {
+			hunkA--
+		}
+		if countB == 0 {
+			hunkB--
+		}
+		fmt.Fprintf(&sb, "@@ -%d,%d +%d,%d @@\n", hunkA, countA, hunkB, countB)
+		sb.WriteString(body.String())
+
+		for _, l := range lines[i:end] {
+			if l.op != DiffInsert {
+				aLine++
+			}
+			if l.op != DiffDelete {
+				bLine++
+			}
+		}
+		i = end
+	}
+
+	return sb.String()
+}
+
+// splitLines splits s after each newline, keeping the terminators.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
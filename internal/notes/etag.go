@@ -0,0 +1,53 @@
+package notes
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/tmsankram/gonotes/internal/markdown"
+)
+
+// ETag identifies the current version of a note with its content in the
+// given format, so that caches keep the formats of a note apart. An empty
+// format is markdown, the format notes are stored in.
+func ETag(n Note, format markdown.Format) string {
+	if format == "" {
+		format = markdown.FormatMarkdown
+	}
+	return fmt.Sprintf(`"%d-%d-%s"`, n.ID, n.Version, format)
+}
+
+// etagMatches reports whether an If-None-Match header value matches etag.
+// Weak validators are compared by their opaque tag.
+func etagMatches(header, etag string) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" || tag == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// versionMatches reports whether an If-Match header value names the
+// current version of n. Writes do not depend on the format a client read
+// the note in, so only the id and the version of the tags are compared.
+func versionMatches(header string, n Note) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == "*" {
+			return true
+		}
+		parts := strings.SplitN(strings.Trim(tag, `"`), "-", 3)
+		if len(parts) < 2 {
+			continue
+		}
+		id, err1 := strconv.ParseInt(parts[0], 10, 64)
+		version, err2 := strconv.ParseInt(parts[1], 10, 64)
+		if err1 == nil && err2 == nil && id == n.ID && version == n.Version {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,69 @@
+package notes
+
+import (
+	"testing"
+
+	"github.com/tmsankram/gonotes/internal/markdown"
+)
+
+func TestETag(t *testing.T) {
+	n := Note{ID: 42, Version: 7}
+	tests := []struct {
+		format markdown.Format
+		want   string
+	}{
+		{"", `"42-7-markdown"`},
+		{markdown.FormatMarkdown, `"42-7-markdown"`},
+		{markdown.FormatHTML, `"42-7-html"`},
+		{markdown.FormatText, `"42-7-text"`},
+	}
+	for _, tt := range tests {
+		if got := ETag(n, tt.format); got != tt.want {
+			t.Errorf("ETag(%q) = %s, want %s", tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestETagMatches(t *testing.T) {
+	etag := ETag(Note{ID: 42, Version: 7}, markdown.FormatHTML)
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"42-7-html"`, true},
+		{`W/"42-7-html"`, true},
+		{`"1-1-text", "42-7-html"`, true},
+		{`*`, true},
+		{`"42-7-markdown"`, false},
+		{`"42-6-html"`, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, etag); got != tt.want {
+			t.Errorf("etagMatches(%s) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	n := Note{ID: 42, Version: 7}
+	tests := []struct {
+		header string
+		want   bool
+	}{
+		{`"42-7-markdown"`, true},
+		{`"42-7-html"`, true},
+		{`W/"42-7-text"`, true},
+		{`"42-7"`, true},
+		{`"1-1-html", "42-7-html"`, true},
+		{`*`, true},
+		{`"42-6-html"`, false},
+		{`"43-7-html"`, false},
+		{`"garbage"`, false},
+		{``, false},
+	}
+	for _, tt := range tests {
+		if got := versionMatches(tt.header, n); got != tt.want {
+			t.Errorf("versionMatches(%s) = %v, want %v", tt.header, got, tt.want)
+		}
+	}
+}
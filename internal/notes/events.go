@@ -0,0 +1,63 @@
+package notes
+
+import (
+	"log"
+
+	"github.com/tmsankram/gonotes/internal/events"
+)
+
+// NoteEvent is the payload of the note events on the event bus. It is
+// kept small; subscribers fetch the note if they need more.
+type NoteEvent struct {
+	ID        int64  `json:"id"`
+	Title     string `json:"title,omitempty"`
+	Version   int64  `json:"version,omitempty"`
+	Permanent bool   `json:"permanent,omitempty"`
+}
+
+// publish announces a change to n to its owner and everyone it is shared
+// with.
+func (s *Service) publish(typ string, n Note) {
+	s.emit(events.Event{
+		Type:  typ,
+		Data:  NoteEvent{ID: n.ID, Title: n.Title, Version: n.Version},
+		Users: s.audience(n),
+	})
+}
+
+// publishPurged announces that trashed notes were removed for good. Only
+// the owner sees trashed notes, so only they are told.
+func (s *Service) publishPurged(userID uint, ids []int64) {
+	for _, id := range ids {
+		s.emit(events.Event{
+			Type:  events.NoteDeleted,
+			Data:  NoteEvent{ID: id, Permanent: true},
+			Users: []uint{userID},
+		})
+	}
+}
+
+// emit publishes e, or holds it back while running in a transaction.
+func (s *Service) emit(e events.Event) {
+	if s.pending != nil {
+		*s.pending = append(*s.pending, e)
+		return
+	}
+	s.events.Publish(e)
+}
+
+// publishAll publishes events held back by a transaction that committed.
+func (s *Service) publishAll(pending []events.Event) {
+	for _, e := range pending {
+		s.emit(e)
+	}
+}
+
+func (s *Service) audience(n Note) []uint {
+	var grantees []uint
+	err := s.db.Model(&Share{}).Where("note_id = ?", n.ID).Pluck("user_id", &grantees).Error
+	if err != nil {
+		log.Printf("[EVENTS] loading shares of note %d: %v", n.ID, err)
+	}
+	return append([]uint{n.UserID}, grantees...)
+}
@@ -0,0 +1,258 @@
+package notes
+
+import "sort"
+
+// mostLinkedLimit is how many notes GraphMetrics.MostLinked holds.
+const mostLinkedLimit = 10
+
+// GraphOptions selects the part of a user's notes that Graph returns.
+type GraphOptions struct {
+	// Filter narrows the notes like a listing does; its sort and list
+	// filters are ignored.
+	Filter Filter
+
+	// Around limits the graph to the notes at most Depth links away from
+	// this note, following links in either direction.
+	Around *int64
+	Depth  int
+}
+
+// GraphNode is a note in the link graph.
+type GraphNode struct {
+	ID         int64    `json:"id"`
+	Title      string   `json:"title"`
+	NotebookID *int64   `json:"notebook_id"`
+	Tags       []string `json:"tags"`
+	InDegree   int      `json:"in_degree"`
+	OutDegree  int      `json:"out_degree"`
+	// Component numbers the connected components by size, largest first.
+	Component int `json:"component"`
+}
+
+// GraphEdge is a wiki link from Source to Target. Several links between
+// the same two notes make a single edge.
+type GraphEdge struct {
+	Source int64    `json:"source"`
+	Target int64    `json:"target"`
+	Kind   LinkKind `json:"kind"`
+}
+
+// LinkCount is a note with the number of notes linking to it.
+type LinkCount struct {
+	ID        int64  `json:"id"`
+	Title     string `json:"title"`
+	Backlinks int    `json:"backlinks"`
+}
+
+// GraphMetrics summarises a Graph.
+type GraphMetrics struct {
+	Nodes int `json:"nodes"`
+	Edges int `json:"edges"`
+	// Orphans are the notes without links in either direction.
+	Orphans    []int64     `json:"orphans"`
+	MostLinked []LinkCount `json:"most_linked"`
+	// Components counts the connected components, following links in
+	// either direction; ComponentSizes holds their sizes, largest first.
+	Components     int   `json:"components"`
+	ComponentSizes []int `json:"component_sizes"`
+}
+
+// Graph is the network of wiki links between a user's notes.
+type Graph struct {
+	Nodes   []GraphNode  `json:"nodes"`
+	Edges   []GraphEdge  `json:"edges"`
+	Metrics GraphMetrics `json:"metrics"`
+}
+
+// Graph builds the link graph of the user's notes. Links to notes outside
+// the selection, to trashed notes and dangling links are left out.
+func (s *Service) Graph(userID uint, opts GraphOptions) (Graph, error) {
+	f := opts.Filter
+
+	var notes []Note
+	err := s.db.Scopes(
+		owned(userID),
+		tagged(userID, f.Tags, f.MatchAllTags),
+		inNotebook(userID, f.NotebookID, f.Recursive),
+		unarchived(f.IncludeArchived),
+	).
+		Select("id", "title", "notebook_id").
+		Preload("Tags").
+		Order("notes.id").
+		Find(&notes).Error
+	if err != nil {
+		return Graph{}, err
+	}
+
+	// the note a neighbourhood is centred on is part of it even when the
+	// filter would leave it out
+	if opts.Around != nil {
+		center, err := s.authorize(userID, *opts.Around, permOwner)
+		if err != nil {
+			return Graph{}, err
+		}
+		if !containsNote(notes, center.ID) {
+			notes = append(notes, center)
+		}
+	}
+
+	var links []WikiLink
+	err = s.db.Where("target_id IS NOT NULL AND source_id IN (?)",
+		s.db.Model(&Note{}).Scopes(owned(userID)).Select("id"),
+	).Order("id").Find(&links).Error
+	if err != nil {
+		return Graph{}, err
+	}
+
+	g := newGraph(notes, links)
+	if opts.Around != nil {
+		g = g.neighbourhood(*opts.Around, max(opts.Depth, 1))
+	}
+	g.measure()
+	return g, nil
+}
+
+func containsNote(notes []Note, id int64) bool {
+	for _, n := range notes {
+		if n.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// newGraph turns notes into nodes and the links between them into edges.
+func newGraph(notes []Note, links []WikiLink) Graph {
+	g := Graph{Nodes: make([]GraphNode, 0, len(notes)), Edges: []GraphEdge{}}
+	index := make(map[int64]bool, len(notes))
+	for _, n := range notes {
+		tags := make([]string, len(n.Tags))
+		for i, t := range n.Tags {
+			tags[i] = t.Name
+		}
+		g.Nodes = append(g.Nodes, GraphNode{ID: n.ID, Title: n.Title, NotebookID: n.NotebookID, Tags: tags})
+		index[n.ID] = true
+	}
+
+	type pair struct{ source, target int64 }
+	seen := map[pair]bool{}
+	for _, l := range links {
+		p := pair{l.SourceID, *l.TargetID}
+		if p.source == p.target || !index[p.source] || !index[p.target] || seen[p] {
+			continue
+		}
+		seen[p] = true
+		g.Edges = append(g.Edges, GraphEdge{Source: p.source, Target: p.target, Kind: l.Kind})
+	}
+	return g
+}
+
+// adjacency lists the neighbours of every node, ignoring edge direction.
+func (g Graph) adjacency() map[int64][]int64 {
+	adj := make(map[int64][]int64, len(g.Nodes))
+	for _, e := range g.Edges {
+		adj[e.Source] = append(adj[e.Source], e.Target)
+		adj[e.Target] = append(adj[e.Target], e.Source)
+	}
+	return adj
+}
+
+// neighbourhood keeps the nodes at most depth edges away from id.
+func (g Graph) neighbourhood(id int64, depth int) Graph {
+	adj := g.adjacency()
+	keep := map[int64]bool{id: true}
+	frontier := []int64{id}
+	for d := 0; d < depth && len(frontier) > 0; d++ {
+		var next []int64
+		for _, n := range frontier {
+			for _, m := range adj[n] {
+				if !keep[m] {
+					keep[m] = true
+					next = append(next, m)
+				}
+			}
+		}
+		frontier = next
+	}
+
+	out := Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for _, n := range g.Nodes {
+		if keep[n.ID] {
+			out.Nodes = append(out.Nodes, n)
+		}
+	}
+	for _, e := range g.Edges {
+		if keep[e.Source] && keep[e.Target] {
+			out.Edges = append(out.Edges, e)
+		}
+	}
+	return out
+}
+
+// measure fills in the degrees, components and metrics.
+func (g *Graph) measure() {
+	pos := make(map[int64]int, len(g.Nodes))
+	for i, n := range g.Nodes {
+		pos[n.ID] = i
+	}
+	for _, e := range g.Edges {
+		g.Nodes[pos[e.Source]].OutDegree++
+		g.Nodes[pos[e.Target]].InDegree++
+	}
+
+	m := GraphMetrics{Nodes: len(g.Nodes), Edges: len(g.Edges), Orphans: []int64{}, MostLinked: []LinkCount{}, ComponentSizes: []int{}}
+
+	// label the components, then renumber them by size
+	adj := g.adjacency()
+	comp := make(map[int64]int, len(g.Nodes))
+	var sizes []int
+	for _, n := range g.Nodes {
+		if _, ok := comp[n.ID]; ok {
+			continue
+		}
+		c := len(sizes)
+		comp[n.ID] = c
+		stack := []int64{n.ID}
+		size := 0
+		for len(stack) > 0 {
+			cur := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			size++
+			for _, next := range adj[cur] {
+				if _, ok := comp[next]; !ok {
+					comp[next] = c
+					stack = append(stack, next)
+				}
+			}
+		}
+		sizes = append(sizes, size)
+	}
+	order := make([]int, len(sizes))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return sizes[order[a]] > sizes[order[b]] })
+	rank := make([]int, len(sizes))
+	for r, c := range order {
+		rank[c] = r
+		m.ComponentSizes = append(m.ComponentSizes, sizes[c])
+	}
+	m.Components = len(sizes)
+
+	for i := range g.Nodes {
+		n := &g.Nodes[i]
+		n.Component = rank[comp[n.ID]]
+		if n.InDegree == 0 && n.OutDegree == 0 {
+			m.Orphans = append(m.Orphans, n.ID)
+		}
+		if n.InDegree > 0 {
+			m.MostLinked = append(m.MostLinked, LinkCount{ID: n.ID, Title: n.Title, Backlinks: n.InDegree})
+		}
+	}
+	sort.SliceStable(m.MostLinked, func(a, b int) bool { return m.MostLinked[a].Backlinks > m.MostLinked[b].Backlinks })
+	if len(m.MostLinked) > mostLinkedLimit {
+		m.MostLinked = m.MostLinked[:mostLinkedLimit]
+	}
+
+	g.Metrics = m
+}
@@ -0,0 +1,84 @@
+package notes
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Graph export formats besides JSON.
+const (
+	GraphMLType = "application/graphml+xml"
+	DOTType     = "text/vnd.graphviz"
+)
+
+// WriteGraphML writes g as a GraphML document. Node attributes are the
+// title, notebook, tags, degrees and component.
+func (g Graph) WriteGraphML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+
+	bw.WriteString(xml.Header)
+	bw.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	for _, k := range []struct{ id, typ string }{
+		{"title", "string"},
+		{"notebook_id", "long"},
+		{"tags", "string"},
+		{"in_degree", "int"},
+		{"out_degree", "int"},
+		{"component", "int"},
+	} {
+		fmt.Fprintf(bw, `  <key id="%s" for="node" attr.name="%s" attr.type="%s"/>`+"\n", k.id, k.id, k.typ)
+	}
+	bw.WriteString(`  <key id="kind" for="edge" attr.name="kind" attr.type="string"/>` + "\n")
+	bw.WriteString(`  <graph id="notes" edgedefault="directed">` + "\n")
+
+	for _, n := range g.Nodes {
+		fmt.Fprintf(bw, `    <node id="n%d">`+"\n", n.ID)
+		fmt.Fprintf(bw, `      <data key="title">%s</data>`+"\n", esc(n.Title))
+		if n.NotebookID != nil {
+			fmt.Fprintf(bw, `      <data key="notebook_id">%d</data>`+"\n", *n.NotebookID)
+		}
+		if len(n.Tags) > 0 {
+			fmt.Fprintf(bw, `      <data key="tags">%s</data>`+"\n", esc(strings.Join(n.Tags, ",")))
+		}
+		fmt.Fprintf(bw, `      <data key="in_degree">%d</data>`+"\n", n.InDegree)
+		fmt.Fprintf(bw, `      <data key="out_degree">%d</data>`+"\n", n.OutDegree)
+		fmt.Fprintf(bw, `      <data key="component">%d</data>`+"\n", n.Component)
+		bw.WriteString("    </node>\n")
+	}
+	for i, e := range g.Edges {
+		fmt.Fprintf(bw, `    <edge id="e%d" source="n%d" target="n%d"><data key="kind">%s</data></edge>`+"\n", i, e.Source, e.Target, e.Kind)
+	}
+
+	bw.WriteString("  </graph>\n</graphml>\n")
+	return bw.Flush()
+}
+
+// WriteDOT writes g in the Graphviz DOT language, labelling nodes with
+// their titles.
+func (g Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	bw.WriteString("digraph notes {\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(bw, "  n%d [label=%s];\n", n.ID, dotQuote(n.Title))
+	}
+	for _, e := range g.Edges {
+		fmt.Fprintf(bw, "  n%d -> n%d;\n", e.Source, e.Target)
+	}
+	bw.WriteString("}\n")
+	return bw.Flush()
+}
+
+// dotQuote makes s a quoted DOT string.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\r", "")
+	return `"` + r.Replace(s) + `"`
+}
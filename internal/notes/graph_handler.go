@@ -0,0 +1,85 @@
+package notes
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+type graphQuery struct {
+	Tag       []string `form:"tag"`
+	TagMode   string   `form:"tag_mode" binding:"omitempty,oneof=all any"`
+	Notebook  *int64   `form:"notebook"`
+	Recursive bool     `form:"recursive"`
+	Archived  bool     `form:"archived"`
+
+	Around *int64 `form:"around"`
+	Depth  int    `form:"depth" binding:"omitempty,min=1,max=5"`
+
+	Format string `form:"format" binding:"omitempty,oneof=json graphml dot"`
+}
+
+// NoteGraph godoc
+// @Summary Note link graph
+// @Description Get the wiki links between the caller's notes as nodes and edges, with orphans, the most linked notes and connected components. around and depth limit it to the neighbourhood of a note.
+// @Tags links
+// @Produce json
+// @Produce xml
+// @Produce plain
+// @Param tag query []string false "Only notes with these tags"
+// @Param tag_mode query string false "all (default) or any"
+// @Param notebook query int false "Only notes in this notebook"
+// @Param recursive query bool false "Include notes in nested notebooks"
+// @Param archived query bool false "Include archived notes"
+// @Param around query int false "Only notes linked to this one, directly or through others"
+// @Param depth query int false "How many links away from around to go, 1 (default) to 5"
+// @Param format query string false "json (default), graphml or dot"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/graph [get]
+func (h *Handler) graph(c *gin.Context) {
+	var q graphQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	g, err := h.svc.Graph(c.GetUint("userID"), GraphOptions{
+		Filter: Filter{
+			Tags:            q.Tag,
+			MatchAllTags:    q.TagMode != "any",
+			NotebookID:      q.Notebook,
+			Recursive:       q.Recursive,
+			IncludeArchived: q.Archived,
+		},
+		Around: q.Around,
+		Depth:  q.Depth,
+	})
+	if err != nil {
+		shareError(c, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	switch q.Format {
+	case "graphml":
+		contentType = GraphMLType
+		err = g.WriteGraphML(&buf)
+	case "dot":
+		contentType = DOTType
+		err = g.WriteDOT(&buf)
+	default:
+		response.Success(c, "Graph retrieved successfully", g)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
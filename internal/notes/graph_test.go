@@ -0,0 +1,304 @@
+package notes
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// testGraph builds the graph of notes 1..n with the given links, each a
+// source and target id.
+func testGraph(n int, links ...[2]int64) Graph {
+	notes := make([]Note, n)
+	for i := range notes {
+		notes[i] = Note{ID: int64(i + 1), Title: fmt.Sprintf("Note %d", i+1)}
+	}
+	wl := make([]WikiLink, len(links))
+	for i, l := range links {
+		target := l[1]
+		wl[i] = WikiLink{SourceID: l[0], TargetID: &target, Kind: LinkTitle}
+	}
+	return newGraph(notes, wl)
+}
+
+func nodeIDs(g Graph) []int64 {
+	ids := []int64{}
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+	}
+	return ids
+}
+
+func TestGraphMetrics(t *testing.T) {
+	tests := []struct {
+		name       string
+		graph      Graph
+		edges      int
+		orphans    []int64
+		sizes      []int
+		components []int
+		mostLinked []int64
+	}{
+		{
+			name:       "empty",
+			graph:      testGraph(0),
+			orphans:    []int64{},
+			sizes:      []int{},
+			components: []int{},
+			mostLinked: []int64{},
+		},
+		{
+			name:       "orphans",
+			graph:      testGraph(2),
+			orphans:    []int64{1, 2},
+			sizes:      []int{1, 1},
+			components: []int{0, 1},
+			mostLinked: []int64{},
+		},
+		{
+			name:       "self-link",
+			graph:      testGraph(2, [2]int64{1, 1}, [2]int64{2, 1}),
+			edges:      1,
+			orphans:    []int64{},
+			sizes:      []int{2},
+			components: []int{0, 0},
+			mostLinked: []int64{1},
+		},
+		{
+			name:       "duplicate edges",
+			graph:      testGraph(2, [2]int64{1, 2}, [2]int64{1, 2}, [2]int64{2, 1}),
+			edges:      2,
+			orphans:    []int64{},
+			sizes:      []int{2},
+			components: []int{0, 0},
+			mostLinked: []int64{1, 2},
+		},
+		{
+			name:    "links out of the selection",
+			graph:   testGraph(1, [2]int64{1, 9}, [2]int64{9, 1}),
+			orphans: []int64{1},
+			sizes:   []int{1},
+			// a node without links still has a component of its own
+			components: []int{0},
+			mostLinked: []int64{},
+		},
+		{
+			// numbered by size, largest first; ties keep the order of
+			// their first node
+			name:       "components by size",
+			graph:      testGraph(7, [2]int64{2, 3}, [2]int64{4, 5}, [2]int64{6, 5}, [2]int64{5, 4}),
+			edges:      4,
+			orphans:    []int64{1, 7},
+			sizes:      []int{3, 2, 1, 1},
+			components: []int{2, 1, 1, 0, 0, 0, 3},
+			mostLinked: []int64{5, 3, 4},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := tt.graph
+			g.measure()
+			m := g.Metrics
+
+			var components []int
+			var mostLinked []int64
+			for _, n := range g.Nodes {
+				components = append(components, n.Component)
+			}
+			for _, l := range m.MostLinked {
+				mostLinked = append(mostLinked, l.ID)
+			}
+			if m.Nodes != len(g.Nodes) || m.Edges != tt.edges || len(g.Edges) != tt.edges {
+				t.Fatalf("%d nodes, %d edges: %+v", m.Nodes, m.Edges, g.Edges)
+			}
+			if !slices.Equal(m.Orphans, tt.orphans) {
+				t.Fatalf("orphans %v", m.Orphans)
+			}
+			if !slices.Equal(m.ComponentSizes, tt.sizes) || m.Components != len(tt.sizes) {
+				t.Fatalf("components %d, sizes %v", m.Components, m.ComponentSizes)
+			}
+			if !slices.Equal(components, tt.components) {
+				t.Fatalf("node components %v", components)
+			}
+			if !slices.Equal(mostLinked, tt.mostLinked) {
+				t.Fatalf("most linked %v", mostLinked)
+			}
+		})
+	}
+}
+
+func TestGraphDegrees(t *testing.T) {
+	g := testGraph(3, [2]int64{1, 2}, [2]int64{1, 2}, [2]int64{1, 3}, [2]int64{3, 2})
+	g.measure()
+	want := map[int64][2]int{1: {0, 2}, 2: {2, 0}, 3: {1, 1}}
+	for _, n := range g.Nodes {
+		if got := [2]int{n.InDegree, n.OutDegree}; got != want[n.ID] {
+			t.Errorf("note %d: in and out %v, want %v", n.ID, got, want[n.ID])
+		}
+	}
+	if len(g.Metrics.MostLinked) != 2 || g.Metrics.MostLinked[0].ID != 2 || g.Metrics.MostLinked[0].Backlinks != 2 {
+		t.Fatalf("most linked %+v", g.Metrics.MostLinked)
+	}
+}
+
+func TestGraphMostLinkedLimit(t *testing.T) {
+	var links [][2]int64
+	for i := int64(2); i <= mostLinkedLimit+5; i++ {
+		links = append(links, [2]int64{1, i})
+	}
+	g := testGraph(mostLinkedLimit+5, links...)
+	g.measure()
+	if len(g.Metrics.MostLinked) != mostLinkedLimit {
+		t.Fatalf("got %d", len(g.Metrics.MostLinked))
+	}
+}
+
+func TestGraphNeighbourhood(t *testing.T) {
+	// 1 -> 2 -> 3 -> 4, 5 -> 3, 6 alone
+	g := testGraph(6, [2]int64{1, 2}, [2]int64{2, 3}, [2]int64{3, 4}, [2]int64{5, 3})
+
+	tests := []struct {
+		around int64
+		depth  int
+		nodes  []int64
+		edges  int
+	}{
+		{1, 1, []int64{1, 2}, 1},
+		{1, 2, []int64{1, 2, 3}, 2},
+		// links are followed against their direction too
+		{4, 1, []int64{3, 4}, 1},
+		{4, 2, []int64{2, 3, 4, 5}, 3},
+		{1, 10, []int64{1, 2, 3, 4, 5}, 4},
+		{6, 3, []int64{6}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%d depth %d", tt.around, tt.depth), func(t *testing.T) {
+			got := g.neighbourhood(tt.around, tt.depth)
+			if !slices.Equal(nodeIDs(got), tt.nodes) || len(got.Edges) != tt.edges {
+				t.Fatalf("nodes %v, edges %+v", nodeIDs(got), got.Edges)
+			}
+		})
+	}
+}
+
+func TestServiceGraph(t *testing.T) {
+	svc := newTestService(t)
+	create := func(userID uint, title, content string) Note {
+		t.Helper()
+		n, err := svc.Create(Note{UserID: userID, Title: title, Content: content}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	c := create(alice, "C", "")
+	b := create(alice, "B", "On to [[C]]")
+	a := create(alice, "A", "See [[B]] and [[B]] and [[Missing]]")
+	lone := create(alice, "Lone", "[[Lone]]")
+	other := create(bob, "Elsewhere", fmt.Sprintf("[[id:%d]]", a.ID))
+
+	g, err := svc.Graph(alice, GraphOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(nodeIDs(g), []int64{c.ID, b.ID, a.ID, lone.ID}) || len(g.Edges) != 2 {
+		t.Fatalf("nodes %v, edges %+v", nodeIDs(g), g.Edges)
+	}
+	if !slices.Equal(g.Metrics.Orphans, []int64{lone.ID}) || !slices.Equal(g.Metrics.ComponentSizes, []int{3, 1}) {
+		t.Fatalf("metrics %+v", g.Metrics)
+	}
+
+	// a depth below one means one
+	g, err = svc.Graph(alice, GraphOptions{Around: &a.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(nodeIDs(g), []int64{b.ID, a.ID}) {
+		t.Fatalf("nodes %v", nodeIDs(g))
+	}
+	g, err = svc.Graph(alice, GraphOptions{Around: &a.ID, Depth: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(nodeIDs(g), []int64{c.ID, b.ID, a.ID}) {
+		t.Fatalf("nodes %v", nodeIDs(g))
+	}
+
+	if _, err := svc.Graph(alice, GraphOptions{Around: &other.ID}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("around bob's note: %v", err)
+	}
+}
+
+const trickyTitle = "Tom & \"Jerry\" <3\nPart 2"
+
+func TestGraphExport(t *testing.T) {
+	notebook := int64(4)
+	g := Graph{
+		Nodes: []GraphNode{
+			{ID: 1, Title: trickyTitle, NotebookID: &notebook, Tags: []string{"a&b", "<c>"}, OutDegree: 1},
+			{ID: 2, Title: "Plain", InDegree: 1},
+		},
+		Edges: []GraphEdge{{Source: 1, Target: 2, Kind: LinkID}},
+	}
+
+	t.Run("GraphML", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := g.WriteGraphML(&buf); err != nil {
+			t.Fatal(err)
+		}
+		var doc struct {
+			Graph struct {
+				Nodes []struct {
+					ID   string `xml:"id,attr"`
+					Data []struct {
+						Key   string `xml:"key,attr"`
+						Value string `xml:",chardata"`
+					} `xml:"data"`
+				} `xml:"node"`
+				Edges []struct {
+					Source string `xml:"source,attr"`
+					Target string `xml:"target,attr"`
+					Kind   string `xml:"data"`
+				} `xml:"edge"`
+			} `xml:"graph"`
+		}
+		if err := xml.Unmarshal(buf.Bytes(), &doc); err != nil {
+			t.Fatalf("%v:\n%s", err, buf.String())
+		}
+		if len(doc.Graph.Nodes) != 2 || doc.Graph.Nodes[0].ID != "n1" {
+			t.Fatalf("nodes %+v", doc.Graph.Nodes)
+		}
+		data := map[string]string{}
+		for _, d := range doc.Graph.Nodes[0].Data {
+			data[d.Key] = d.Value
+		}
+		if data["title"] != trickyTitle || data["tags"] != "a&b,<c>" || data["notebook_id"] != "4" || data["out_degree"] != "1" {
+			t.Fatalf("data %q", data)
+		}
+		if e := doc.Graph.Edges; len(e) != 1 || e[0].Source != "n1" || e[0].Target != "n2" || e[0].Kind != string(LinkID) {
+			t.Fatalf("edges %+v", e)
+		}
+	})
+
+	t.Run("DOT", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := g.WriteDOT(&buf); err != nil {
+			t.Fatal(err)
+		}
+		want := strings.Join([]string{
+			"digraph notes {",
+			`  n1 [label="Tom & \"Jerry\" <3\nPart 2"];`,
+			`  n2 [label="Plain"];`,
+			"  n1 -> n2;",
+			"}",
+			"",
+		}, "\n")
+		if buf.String() != want {
+			t.Fatalf("got\n%s", buf.String())
+		}
+	})
+}
@@ -6,54 +6,206 @@ import (
 	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/listquery"
+	"github.com/tmsankram/gonotes/internal/markdown"
 	"github.com/tmsankram/gonotes/internal/pagination"
 	"github.com/tmsankram/gonotes/internal/response"
+	"github.com/tmsankram/gonotes/internal/users"
+	"gorm.io/gorm"
 )
 
 type Handler struct {
-	svc *Service
+	svc   *Service
+	users *users.Service
 }
 
-func NewHandler(svc *Service) *Handler {
-	return &Handler{svc: svc}
+func NewHandler(svc *Service, usersSvc *users.Service) *Handler {
+	return &Handler{svc: svc, users: usersSvc}
 }
 
 func (h *Handler) RegisterRoutes(r *gin.Engine) {
 	notes := r.Group("/notes")
+	notes.Use(auth.AuthRequired())
 	{
 		notes.GET("/", h.getAll)
+		notes.GET("/trash", h.listTrash)
+		notes.GET("/graph", h.graph)
+		notes.GET("/shared", h.sharedWithMe)
+		notes.DELETE("/trash", h.emptyTrash)
 		notes.GET("/:id", h.getByID)
+		notes.GET("/:id/render", h.render)
 		notes.POST("/", h.create)
+		notes.POST("/bulk", h.bulk)
 		notes.PUT("/:id", h.update)
+		notes.PATCH("/:id", h.patch)
 		notes.DELETE("/:id", h.delete)
+
+		notes.GET("/:id/revisions", h.listRevisions)
+		notes.GET("/:id/revisions/:rev", h.getRevision)
+		notes.POST("/:id/revisions/:rev/restore", h.restoreRevision)
+		notes.GET("/:id/diff", h.diffRevisions)
+
+		notes.POST("/:id/tags", h.attachTags)
+		notes.DELETE("/:id/tags/:tag", h.detachTag)
+
+		notes.POST("/:id/move", h.moveNote)
+
+		notes.POST("/:id/pin", h.pin)
+		notes.DELETE("/:id/pin", h.unpin)
+		notes.POST("/:id/archive", h.archive)
+		notes.DELETE("/:id/archive", h.unarchive)
+
+		notes.GET("/:id/shares", h.listShares)
+		notes.POST("/:id/shares", h.shareNote)
+		notes.DELETE("/:id/shares/:user", h.revokeShare)
+
+		notes.GET("/:id/comments", h.listComments)
+		notes.POST("/:id/comments", h.addComment)
+		notes.DELETE("/:id/comments/:comment", h.deleteComment)
+
+		notes.GET("/:id/public-links", h.listLinks)
+		notes.POST("/:id/public-links", h.createLink)
+		notes.DELETE("/:id/public-links/:link", h.revokeLink)
+
+		notes.GET("/:id/links", h.outLinks)
+		notes.GET("/:id/backlinks", h.backlinks)
+
+		notes.POST("/:id/restore", h.untrash)
+		notes.DELETE("/:id/permanent", h.deletePermanently)
+	}
+
+	tags := r.Group("/tags")
+	tags.Use(auth.AuthRequired())
+	{
+		tags.GET("/", h.listTags)
+		tags.POST("/", h.createTag)
+		tags.PUT("/:id", h.renameTag)
+		tags.DELETE("/:id", h.deleteTag)
+	}
+
+	notebooks := r.Group("/notebooks")
+	notebooks.Use(auth.AuthRequired())
+	{
+		notebooks.GET("/", h.notebookTree)
+		notebooks.POST("/", h.createNotebook)
+		notebooks.GET("/:id", h.notebookSubtree)
+		notebooks.PUT("/:id", h.renameNotebook)
+		notebooks.POST("/:id/move", h.moveNotebook)
+		notebooks.DELETE("/:id", h.deleteNotebook)
 	}
 }
 
 type NoteQuery struct {
-	Title   string `form:"title"`
-	Content string `form:"content"`
+	Q       string   `form:"q"`
+	Title   string   `form:"title"`
+	Content string   `form:"content"`
+	Tag     []string `form:"tag"`
+	TagMode string   `form:"tag_mode" binding:"omitempty,oneof=all any"`
+
+	Notebook  *int64 `form:"notebook"`
+	Recursive bool   `form:"recursive"`
+
+	Archived bool `form:"archived"`
+}
+
+func (q NoteQuery) filter(lq listquery.Query) Filter {
+	return Filter{
+		Tags:         q.Tag,
+		MatchAllTags: q.TagMode != "any",
+		NotebookID:   q.Notebook,
+		Recursive:    q.Recursive,
+		Query:        lq,
+
+		IncludeArchived: q.Archived,
+	}
 }
 
-func (s *Service) Paginated(page, limit int) ([]Note, int64, error) {
+// attachmentLink matches the download link of an uploaded file in note content.
+const attachmentLink = `/files/[0-9a-f-]+/download`
+
+// listSpec whitelists the sort and filter parameters of GET /notes.
+var listSpec = listquery.Spec{
+	Sort: map[string]string{
+		"id":         "notes.id",
+		"title":      "notes.title",
+		"created_at": "notes.created_at",
+		"updated_at": "notes.updated_at",
+	},
+	Default:  "-id",
+	Tiebreak: "notes.id",
+	Filters: []listquery.Filter{
+		{Param: "created_after", Column: "notes.created_at", Op: listquery.Gt, Type: listquery.Time},
+		{Param: "created_before", Column: "notes.created_at", Op: listquery.Lt, Type: listquery.Time},
+		{Param: "updated_after", Column: "notes.updated_at", Op: listquery.Gt, Type: listquery.Time},
+		{Param: "updated_before", Column: "notes.updated_at", Op: listquery.Lt, Type: listquery.Time},
+		{Param: "pinned", Column: "notes.pinned", Op: listquery.Eq, Type: listquery.Bool},
+		{Param: "has_attachments", Type: listquery.Bool, Scope: func(v any) func(*gorm.DB) *gorm.DB {
+			return func(db *gorm.DB) *gorm.DB {
+				if v.(bool) {
+					return db.Where("notes.content ~ ?", attachmentLink)
+				}
+				return db.Where("notes.content !~ ?", attachmentLink)
+			}
+		}},
+	},
+	// handled by NoteQuery and the pagination types
+	Params: []string{"q", "title", "content", "tag", "tag_mode", "notebook", "recursive", "archived", "page", "limit", "after", "before"},
+}
+
+func (s *Service) Paginated(userID uint, f Filter, page, limit int) ([]Note, int64, error) {
 	var notes []Note
 	var total int64
 
-	s.db.Model(&Note{}).Count(&total)
+	scopes := []func(*gorm.DB) *gorm.DB{
+		owned(userID),
+		tagged(userID, f.Tags, f.MatchAllTags),
+		inNotebook(userID, f.NotebookID, f.Recursive),
+		unarchived(f.IncludeArchived),
+		f.Query.Where(),
+	}
+
+	if err := s.db.Model(&Note{}).Scopes(scopes...).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
 
 	offset := (page - 1) * limit
 
-	err := s.db.Limit(limit).Offset(offset).Order("id DESC").Find(&notes).Error
+	// pinned notes come before whatever sort was asked for
+	err := s.db.Scopes(scopes...).
+		Preload("Tags").
+		Order("notes.pinned DESC").
+		Scopes(f.Query.Order()).
+		Limit(limit).
+		Offset(offset).
+		Find(&notes).Error
 
 	return notes, total, err
 }
 
 // ListNotes godoc
 // @Summary List notes
-// @Description Get paginated notes
+// @Description Get paginated notes, pinned first and archived hidden unless archived=true, or full-text search them when q is set
 // @Tags notes
 // @Accept json
 // @Produce json
+// @Param q query string false "Full-text search query"
+// @Param tag query []string false "Only notes with these tags"
+// @Param tag_mode query string false "all (default) or any"
+// @Param notebook query int false "Only notes in this notebook"
+// @Param recursive query bool false "Include notes in nested notebooks"
+// @Param archived query bool false "Include archived notes"
+// @Param pinned query bool false "Only pinned (or unpinned) notes"
+// @Param sort query string false "Comma separated id, title, created_at, updated_at; prefix - for descending"
+// @Param created_after query string false "RFC 3339 time or YYYY-MM-DD"
+// @Param created_before query string false "RFC 3339 time or YYYY-MM-DD"
+// @Param updated_after query string false "RFC 3339 time or YYYY-MM-DD"
+// @Param updated_before query string false "RFC 3339 time or YYYY-MM-DD"
+// @Param has_attachments query bool false "Only notes that do (or do not) link an uploaded file"
 // @Param page query int false "Page number"
+// @Param after query string false "Cursor from next_cursor; empty for the first page"
+// @Param before query string false "Cursor from prev_cursor"
 // @Param limit query int false "Limit"
 // @Success 200 {object} response.ListResponse
 // @Security ApiKeyAuth
@@ -65,6 +217,22 @@ func (h *Handler) getAll(c *gin.Context) {
 		return
 	}
 
+	lq, err := listSpec.Parse(c.Request.URL.Query())
+	if err != nil {
+		response.ValidationError(c, err)
+		return
+	}
+	f := q.filter(lq)
+
+	if q.Q == "" && pagination.CursorRequested(c.Request.URL.Query()) {
+		if lq.Sorted() {
+			response.ValidationError(c, listquery.Errors{{Field: "sort", Error: "cursor pages are always sorted by updated_at"}})
+			return
+		}
+		h.getAllCursor(c, f)
+		return
+	}
+
 	var page pagination.Pagination
 
 	if err := c.ShouldBindQuery(&page); err != nil {
@@ -72,7 +240,18 @@ func (h *Handler) getAll(c *gin.Context) {
 		return
 	}
 	page.Normalize()
-	items, total, err := h.svc.Paginated(page.Page, page.Limit)
+
+	if q.Q != "" {
+		results, total, err := h.svc.Search(c.GetUint("userID"), q.Q, f, page.Page, page.Limit)
+		if err != nil {
+			response.Internal(c, err)
+			return
+		}
+		response.List(c, results, page.Page, page.Limit, int(total))
+		return
+	}
+
+	items, total, err := h.svc.Paginated(c.GetUint("userID"), f, page.Page, page.Limit)
 	if err != nil {
 		response.ValidationError(c, err.Error())
 		return
@@ -80,6 +259,50 @@ func (h *Handler) getAll(c *gin.Context) {
 	response.List(c, items, page.Page, page.Limit, int(total))
 }
 
+func (h *Handler) getAllCursor(c *gin.Context, f Filter) {
+	var ks pagination.Keyset
+	if err := c.ShouldBindQuery(&ks); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	ks.Normalize()
+
+	after, before, err := ks.Decode()
+	if err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	page, err := h.svc.Keyset(c.GetUint("userID"), f, after, before, ks.Limit)
+	if errors.Is(err, pagination.ErrInvalidCursor) {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+
+	response.CursorList(c, page.Items, ks.Limit, page.Next.String(), page.Prev.String())
+}
+
+type formatQuery struct {
+	Format markdown.Format `form:"format" binding:"omitempty,oneof=html markdown text"`
+}
+
+// GetNote godoc
+// @Summary Get note
+// @Description Get a note; format converts its content to html, markdown (default) or text
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param format query string false "html, markdown or text"
+// @Param If-None-Match header string false "ETag from a previous response"
+// @Success 200 {object} response.SuccessResponse
+// @Success 304
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id} [get]
 func (h *Handler) getByID(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -87,18 +310,74 @@ func (h *Handler) getByID(c *gin.Context) {
 		return
 	}
 
-	n, err := h.svc.GetByID(id)
+	var q formatQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	n, err := h.svc.GetByID(c.GetUint("userID"), id)
 	if err != nil {
 		response.NotFound(c, errors.New("Note not found"))
 		return
 	}
 
+	etag := ETag(n, q.Format)
+	c.Header("ETag", etag)
+	if inm := c.GetHeader("If-None-Match"); inm != "" && etagMatches(inm, etag) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	n.Content, err = markdown.Render(n.Content, q.Format)
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+
 	response.Success(c, "Note retrieved successfully", n)
 }
 
+// RenderNote godoc
+// @Summary Render note
+// @Description Render note content from markdown to sanitised HTML
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/render [get]
+func (h *Handler) render(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	n, err := h.svc.GetByID(c.GetUint("userID"), id)
+	if err != nil {
+		response.NotFound(c, errors.New("Note not found"))
+		return
+	}
+
+	out, err := markdown.HTML(n.Content)
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+
+	response.Success(c, "Note rendered successfully", gin.H{
+		"id":    n.ID,
+		"title": n.Title,
+		"html":  out,
+	})
+}
+
 type createUpdateReq struct {
-	Title   string `json:"title" binding:"required,min=3,max=100,notest"`
-	Content string `json:"content" binding:"required,min=5,max=5000"`
+	Title      string   `json:"title" binding:"required,min=3,max=100,notest"`
+	Content    string   `json:"content" binding:"required,min=5,max=5000"`
+	Tags       []string `json:"tags" binding:"omitempty,max=20,dive,min=1,max=32"`
+	NotebookID *int64   `json:"notebook_id"`
 }
 
 func (h *Handler) create(c *gin.Context) {
@@ -110,17 +389,56 @@ func (h *Handler) create(c *gin.Context) {
 	}
 
 	n, err := h.svc.Create(Note{
-		Title:   req.Title,
-		Content: req.Content,
-	})
+		UserID:     c.GetUint("userID"),
+		NotebookID: req.NotebookID,
+		Title:      req.Title,
+		Content:    req.Content,
+	}, req.Tags)
 	if err != nil {
 		response.ValidationError(c, err.Error())
 		return
 	}
 
+	c.Header("ETag", ETag(n, markdown.FormatMarkdown))
 	response.Created(c, "Note created successfully", n)
 }
 
+// checkIfMatch evaluates the If-Match header of a write request against the
+// current note. It returns the version the write must apply to (0 when the
+// header is absent) or writes a 404/412 response and returns false.
+func (h *Handler) checkIfMatch(c *gin.Context, id int64) (int64, bool) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return 0, true
+	}
+
+	n, err := h.svc.GetByID(c.GetUint("userID"), id)
+	if err != nil {
+		response.NotFound(c, errors.New("Note not found"))
+		return 0, false
+	}
+	if !versionMatches(header, n) {
+		c.Header("ETag", ETag(n, markdown.FormatMarkdown))
+		response.PreconditionFailed(c, ErrVersionConflict)
+		return 0, false
+	}
+	return n.Version, true
+}
+
+// UpdateNote godoc
+// @Summary Update note
+// @Tags notes
+// @Accept json
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param If-Match header string false "ETag the update is based on"
+// @Param rewrite_links query bool false "Change [[Old Title]] links in other notes to the new title"
+// @Param payload body createUpdateReq true "Note"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id} [put]
 func (h *Handler) update(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -132,17 +450,126 @@ func (h *Handler) update(c *gin.Context) {
 		response.ValidationError(c, err.Error())
 		return
 	}
-	n, err := h.svc.Update(id, Note{
+	version, ok := h.checkIfMatch(c, id)
+	if !ok {
+		return
+	}
+	update := h.svc.Update
+	if c.Query("rewrite_links") == "true" {
+		update = h.svc.UpdateRewritingLinks
+	}
+	n, err := update(c.GetUint("userID"), id, Note{
 		Title:   req.Title,
 		Content: req.Content,
-	})
+		Version: version,
+	}, req.Tags)
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		response.Forbidden(c, err)
+		return
+	}
+	if errors.Is(err, ErrVersionConflict) {
+		response.PreconditionFailed(c, err)
+		return
+	}
 	if err != nil {
 		response.ValidationError(c, err.Error())
 		return
 	}
+	c.Header("ETag", ETag(n, markdown.FormatMarkdown))
 	response.Success(c, "Note updated successfully", n)
 }
 
+// PatchNote godoc
+// @Summary Patch note
+// @Description Partially update a note with a JSON Merge Patch (RFC 7396) or JSON Patch (RFC 6902) over {title, content, tags}
+// @Tags notes
+// @Accept application/merge-patch+json
+// @Accept application/json-patch+json
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param If-Match header string false "ETag the patch is based on"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Failure 415 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id} [patch]
+func (h *Handler) patch(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	n, err := h.svc.GetByID(c.GetUint("userID"), id)
+	if err != nil {
+		response.NotFound(c, errors.New("Note not found"))
+		return
+	}
+	if header := c.GetHeader("If-Match"); header != "" && !versionMatches(header, n) {
+		c.Header("ETag", ETag(n, markdown.FormatMarkdown))
+		response.PreconditionFailed(c, ErrVersionConflict)
+		return
+	}
+
+	body, err := c.GetRawData()
+	if err != nil {
+		response.BadRequest(c, err)
+		return
+	}
+
+	doc, err := applyPatch(n, c.ContentType(), body)
+	if errors.Is(err, ErrUnsupportedPatch) {
+		response.UnsupportedMediaType(c, err)
+		return
+	}
+	if err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if err := binding.Validator.ValidateStruct(&doc); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	// the patch was computed against n, so only apply it to that version
+	updated, err := h.svc.Patch(c.GetUint("userID"), id, Note{
+		Title:   doc.Title,
+		Content: doc.Content,
+		Version: n.Version,
+	}, doc.Tags, State{Pinned: &doc.Pinned, Archived: &doc.Archived})
+	if errors.Is(err, ErrVersionConflict) {
+		response.PreconditionFailed(c, err)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+
+	c.Header("ETag", ETag(updated, markdown.FormatMarkdown))
+	response.Success(c, "Note updated successfully", updated)
+}
+
+// DeleteNote godoc
+// @Summary Delete note
+// @Description Move a note to the trash
+// @Tags notes
+// @Param id path int true "Note ID"
+// @Param If-Match header string false "ETag the delete is based on"
+// @Success 204
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 412 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id} [delete]
 func (h *Handler) delete(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
@@ -150,9 +577,175 @@ func (h *Handler) delete(c *gin.Context) {
 		return
 	}
 
-	if err := h.svc.Delete(id); err != nil {
+	version, ok := h.checkIfMatch(c, id)
+	if !ok {
+		return
+	}
+
+	err = h.svc.Delete(c.GetUint("userID"), id, version)
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		response.Forbidden(c, err)
+		return
+	}
+	if errors.Is(err, ErrVersionConflict) {
+		response.PreconditionFailed(c, err)
+		return
+	}
+	if err != nil {
 		response.ValidationError(c, err.Error())
 		return
 	}
 	c.Status(http.StatusNoContent)
 }
+
+// paramID parses an int64 path parameter, writing a validation error on failure.
+func paramID(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil {
+		response.ValidationError(c, "invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
+
+// ListRevisions godoc
+// @Summary List note revisions
+// @Description Get the saved revisions of a note, newest first
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/revisions [get]
+func (h *Handler) listRevisions(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	revs, err := h.svc.Revisions(c.GetUint("userID"), id)
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Revisions retrieved successfully", revs)
+}
+
+// GetRevision godoc
+// @Summary Get a note revision
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param rev path int true "Revision ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/revisions/{rev} [get]
+func (h *Handler) getRevision(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	revID, ok := paramID(c, "rev")
+	if !ok {
+		return
+	}
+
+	rev, err := h.svc.Revision(c.GetUint("userID"), id, revID)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrRevisionNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Revision retrieved successfully", rev)
+}
+
+// RestoreRevision godoc
+// @Summary Restore a note revision
+// @Description Copy an old revision back onto the note as a new revision
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param rev path int true "Revision ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/revisions/{rev}/restore [post]
+func (h *Handler) restoreRevision(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	revID, ok := paramID(c, "rev")
+	if !ok {
+		return
+	}
+
+	n, err := h.svc.Restore(c.GetUint("userID"), id, revID)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrRevisionNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Revision restored successfully", n)
+}
+
+type diffQuery struct {
+	From int64 `form:"from" binding:"required"`
+	To   int64 `form:"to" binding:"required"`
+}
+
+// DiffRevisions godoc
+// @Summary Diff two note revisions
+// @Description Unified line diff plus word-level chunks between two revisions
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param from query int true "Base revision ID"
+// @Param to query int true "Target revision ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/diff [get]
+func (h *Handler) diffRevisions(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var q diffQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	d, err := h.svc.Diff(c.GetUint("userID"), id, q.From, q.To)
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrRevisionNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Diff generated successfully", d)
+}
@@ -0,0 +1,43 @@
+package notes
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/listquery"
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+func TestListRejectsUnknownFields(t *testing.T) {
+	svc := newTestService(t)
+	r := gin.New()
+	NewHandler(svc, users.NewService(svc.db)).RegisterRoutes(r)
+	token, err := auth.GenerateToken(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := serve(r, token, http.MethodGet, "/notes/?sort=-password&user_id=2&pinned=yes", "", "")
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Details listquery.Errors `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	want := listquery.Errors{
+		{Field: "pinned", Error: "must be true or false"},
+		{Field: "sort", Error: `cannot sort by "password"`},
+		{Field: "user_id", Error: "unknown field"},
+	}
+	if !slices.Equal(body.Details, want) {
+		t.Fatalf("got %+v", body.Details)
+	}
+}
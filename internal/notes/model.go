@@ -1,11 +1,40 @@
 package notes
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/listquery"
+)
 
 type Note struct {
-	ID        int64     `gorm:"primaryKey" json:"id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	ID         int64          `gorm:"primaryKey" json:"id"`
+	UserID     uint           `gorm:"index" json:"user_id"`
+	NotebookID *int64         `gorm:"index" json:"notebook_id"`
+	Title      string         `json:"title"`
+	Content    string         `json:"content"`
+	Tags       []Tag          `gorm:"many2many:note_tags;" json:"tags"`
+	Version    int64          `gorm:"not null;default:1" json:"version"`
+	Pinned     bool           `gorm:"not null;default:false" json:"pinned"`
+	Archived   bool           `gorm:"not null;default:false;index" json:"archived"`
+	CreatedAt  time.Time      `json:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at"`
+	DeletedAt  gorm.DeletedAt `gorm:"index" json:"deleted_at"`
+}
+
+// Filter narrows a note listing.
+type Filter struct {
+	Tags         []string
+	MatchAllTags bool
+
+	NotebookID *int64
+	// Recursive includes notes from notebooks nested below NotebookID.
+	Recursive bool
+
+	// IncludeArchived lists archived notes too; they are hidden by default.
+	IncludeArchived bool
+
+	// Query holds the sort and the filters parsed from listSpec.
+	Query listquery.Query
 }
@@ -0,0 +1,266 @@
+package notes
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/events"
+)
+
+var (
+	// ErrNotebookNotFound is returned when a notebook does not exist or belongs to another user.
+	ErrNotebookNotFound = errors.New("notebook not found")
+	// ErrNotebookCycle is returned when a notebook would be moved into its own subtree.
+	ErrNotebookCycle = errors.New("cannot move a notebook into itself or one of its descendants")
+)
+
+// DeletePolicy decides what happens to the contents of a deleted notebook.
+type DeletePolicy string
+
+const (
+	// DeleteCascade removes the whole subtree and moves its notes to the trash.
+	DeleteCascade DeletePolicy = "cascade"
+	// DeleteReparent moves child notebooks and notes up to the parent.
+	DeleteReparent DeletePolicy = "reparent"
+)
+
+// Notebook is a folder of notes. Notebooks nest through ParentID; a nil
+// ParentID puts the notebook at the top level.
+type Notebook struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"index;not null" json:"-"`
+	ParentID  *int64    `gorm:"index" json:"parent_id"`
+	Name      string    `gorm:"not null" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// NotebookNode is a notebook with its children, used for tree listings.
+type NotebookNode struct {
+	Notebook
+	Children []*NotebookNode `json:"children"`
+}
+
+// subtreeSQL selects the ID of a notebook and all of its descendants.
+const subtreeSQL = `WITH RECURSIVE subtree AS (
+	SELECT id FROM notebooks WHERE id = ? AND user_id = ?
+	UNION ALL
+	SELECT nb.id FROM notebooks nb JOIN subtree ON nb.parent_id = subtree.id
+) SELECT id FROM subtree`
+
+// inNotebook restricts a note query to one notebook, or to the notebook and
+// everything below it when recursive is set.
+func inNotebook(userID uint, notebookID *int64, recursive bool) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if notebookID == nil {
+			return db
+		}
+		if recursive {
+			return db.Where("notes.notebook_id IN (?)", gorm.Expr(subtreeSQL, *notebookID, userID))
+		}
+		return db.Where("notes.notebook_id = ?", *notebookID)
+	}
+}
+
+func (s *Service) subtreeIDs(tx *gorm.DB, userID uint, id int64) ([]int64, error) {
+	var ids []int64
+	err := tx.Raw(subtreeSQL, id, userID).Scan(&ids).Error
+	return ids, err
+}
+
+func (s *Service) GetNotebook(userID uint, id int64) (Notebook, error) {
+	var nb Notebook
+	err := s.db.Where("user_id = ?", userID).First(&nb, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nb, ErrNotebookNotFound
+	}
+	return nb, err
+}
+
+// checkNotebook verifies that an optional notebook reference belongs to the user.
+func (s *Service) checkNotebook(userID uint, id *int64) error {
+	if id == nil {
+		return nil
+	}
+	_, err := s.GetNotebook(userID, *id)
+	return err
+}
+
+// NotebookTree returns the user's notebooks as a forest. With a non-nil
+// root only that notebook's subtree is returned.
+func (s *Service) NotebookTree(userID uint, root *int64) ([]*NotebookNode, error) {
+	q := s.db.Where("user_id = ?", userID)
+	if root != nil {
+		ids, err := s.subtreeIDs(s.db, userID, *root)
+		if err != nil {
+			return nil, err
+		}
+		if len(ids) == 0 {
+			return nil, ErrNotebookNotFound
+		}
+		q = q.Where("id IN ?", ids)
+	}
+
+	var all []Notebook
+	if err := q.Order("name").Find(&all).Error; err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[int64]*NotebookNode, len(all))
+	for _, nb := range all {
+		nodes[nb.ID] = &NotebookNode{Notebook: nb, Children: []*NotebookNode{}}
+	}
+
+	roots := []*NotebookNode{}
+	for _, nb := range all {
+		var parent *NotebookNode
+		if nb.ParentID != nil && (root == nil || nb.ID != *root) {
+			parent = nodes[*nb.ParentID]
+		}
+		if parent != nil {
+			parent.Children = append(parent.Children, nodes[nb.ID])
+		} else {
+			roots = append(roots, nodes[nb.ID])
+		}
+	}
+	return roots, nil
+}
+
+func (s *Service) CreateNotebook(userID uint, name string, parentID *int64) (Notebook, error) {
+	if err := s.checkNotebook(userID, parentID); err != nil {
+		return Notebook{}, err
+	}
+
+	nb := Notebook{UserID: userID, Name: name, ParentID: parentID}
+	if err := s.db.Create(&nb).Error; err != nil {
+		return Notebook{}, err
+	}
+	return nb, nil
+}
+
+func (s *Service) RenameNotebook(userID uint, id int64, name string) (Notebook, error) {
+	nb, err := s.GetNotebook(userID, id)
+	if err != nil {
+		return Notebook{}, err
+	}
+
+	nb.Name = name
+	if err := s.db.Save(&nb).Error; err != nil {
+		return Notebook{}, err
+	}
+	return nb, nil
+}
+
+// MoveNotebook re-parents a notebook. A nil parent moves it to the top level.
+func (s *Service) MoveNotebook(userID uint, id int64, parentID *int64) (Notebook, error) {
+	nb, err := s.GetNotebook(userID, id)
+	if err != nil {
+		return Notebook{}, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if parentID != nil {
+			if err := s.checkNotebook(userID, parentID); err != nil {
+				return err
+			}
+
+			subtree, err := s.subtreeIDs(tx, userID, id)
+			if err != nil {
+				return err
+			}
+			for _, sid := range subtree {
+				if sid == *parentID {
+					return ErrNotebookCycle
+				}
+			}
+		}
+
+		nb.ParentID = parentID
+		return tx.Save(&nb).Error
+	})
+	if err != nil {
+		return Notebook{}, err
+	}
+	return nb, nil
+}
+
+// DeleteNotebook removes a notebook according to policy.
+func (s *Service) DeleteNotebook(userID uint, id int64, policy DeletePolicy) error {
+	nb, err := s.GetNotebook(userID, id)
+	if err != nil {
+		return err
+	}
+
+	var trashedNotes []Note
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if policy == DeleteReparent {
+			if err := tx.Model(&Notebook{}).Where("parent_id = ?", nb.ID).Update("parent_id", nb.ParentID).Error; err != nil {
+				return err
+			}
+			if err := tx.Unscoped().Model(&Note{}).Where("notebook_id = ?", nb.ID).Update("notebook_id", nb.ParentID).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&nb).Error
+		}
+
+		ids, err := s.subtreeIDs(tx, userID, nb.ID)
+		if err != nil {
+			return err
+		}
+
+		err = tx.Select("id", "user_id", "title", "version").
+			Where("notebook_id IN ?", ids).
+			Find(&trashedNotes).Error
+		if err != nil {
+			return err
+		}
+
+		// Trashed notes are detached so that restoring them does not point
+		// at a notebook that no longer exists.
+		err = tx.Unscoped().Model(&Note{}).
+			Where("notebook_id IN ?", ids).
+			Updates(map[string]interface{}{"notebook_id": nil, "deleted_at": gorm.Expr("COALESCE(deleted_at, ?)", time.Now())}).Error
+		if err != nil {
+			return err
+		}
+		if err := resolveTitles(tx, userID, 0); err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&Notebook{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, n := range trashedNotes {
+		s.publish(events.NoteDeleted, n)
+	}
+	return nil
+}
+
+// MoveNote files a note under a notebook. A nil notebook moves it to the top level.
+func (s *Service) MoveNote(userID uint, noteID int64, notebookID *int64) (Note, error) {
+	n, err := s.authorize(userID, noteID, permOwner)
+	if err != nil {
+		return Note{}, err
+	}
+	if err := s.checkNotebook(userID, notebookID); err != nil {
+		return Note{}, err
+	}
+
+	err = s.db.Model(&n).Updates(map[string]interface{}{
+		"notebook_id": notebookID,
+		"version":     gorm.Expr("version + 1"),
+	}).Error
+	if err != nil {
+		return Note{}, err
+	}
+	if n, err = s.GetByID(userID, noteID); err != nil {
+		return Note{}, err
+	}
+
+	s.publish(events.NoteUpdated, n)
+	return n, nil
+}
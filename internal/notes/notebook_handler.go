@@ -0,0 +1,237 @@
+package notes
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+type notebookReq struct {
+	Name     string `json:"name" binding:"required,min=1,max=100"`
+	ParentID *int64 `json:"parent_id"`
+}
+
+type renameNotebookReq struct {
+	Name string `json:"name" binding:"required,min=1,max=100"`
+}
+
+type moveNotebookReq struct {
+	ParentID *int64 `json:"parent_id"`
+}
+
+type moveNoteReq struct {
+	NotebookID *int64 `json:"notebook_id"`
+}
+
+type deleteNotebookQuery struct {
+	Policy DeletePolicy `form:"policy" binding:"omitempty,oneof=cascade reparent"`
+}
+
+// notebookError maps notebook service errors to responses.
+func notebookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrNotebookNotFound):
+		response.NotFound(c, err)
+	case errors.Is(err, ErrNotebookCycle):
+		response.BadRequest(c, err)
+	case errors.Is(err, ErrForbidden):
+		response.Forbidden(c, err)
+	default:
+		response.Internal(c, err)
+	}
+}
+
+// NotebookTree godoc
+// @Summary List notebooks
+// @Description Get the user's notebooks as a nested tree
+// @Tags notebooks
+// @Produce json
+// @Success 200 {object} response.SuccessResponse
+// @Security ApiKeyAuth
+// @Router /notebooks [get]
+func (h *Handler) notebookTree(c *gin.Context) {
+	tree, err := h.svc.NotebookTree(c.GetUint("userID"), nil)
+	if err != nil {
+		notebookError(c, err)
+		return
+	}
+	response.Success(c, "Notebooks retrieved successfully", tree)
+}
+
+// NotebookSubtree godoc
+// @Summary Get notebook subtree
+// @Description Get a notebook with all of its descendants
+// @Tags notebooks
+// @Produce json
+// @Param id path int true "Notebook ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notebooks/{id} [get]
+func (h *Handler) notebookSubtree(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	tree, err := h.svc.NotebookTree(c.GetUint("userID"), &id)
+	if err != nil {
+		notebookError(c, err)
+		return
+	}
+	response.Success(c, "Notebook retrieved successfully", tree[0])
+}
+
+// CreateNotebook godoc
+// @Summary Create notebook
+// @Tags notebooks
+// @Accept json
+// @Produce json
+// @Param payload body notebookReq true "Notebook"
+// @Success 201 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notebooks [post]
+func (h *Handler) createNotebook(c *gin.Context) {
+	var req notebookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	nb, err := h.svc.CreateNotebook(c.GetUint("userID"), req.Name, req.ParentID)
+	if err != nil {
+		notebookError(c, err)
+		return
+	}
+	response.Created(c, "Notebook created successfully", nb)
+}
+
+// RenameNotebook godoc
+// @Summary Rename notebook
+// @Tags notebooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Notebook ID"
+// @Param payload body renameNotebookReq true "Notebook"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notebooks/{id} [put]
+func (h *Handler) renameNotebook(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req renameNotebookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	nb, err := h.svc.RenameNotebook(c.GetUint("userID"), id, req.Name)
+	if err != nil {
+		notebookError(c, err)
+		return
+	}
+	response.Success(c, "Notebook updated successfully", nb)
+}
+
+// MoveNotebook godoc
+// @Summary Move notebook
+// @Description Re-parent a notebook; a null parent_id moves it to the top level
+// @Tags notebooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Notebook ID"
+// @Param payload body moveNotebookReq true "New parent"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notebooks/{id}/move [post]
+func (h *Handler) moveNotebook(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req moveNotebookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	nb, err := h.svc.MoveNotebook(c.GetUint("userID"), id, req.ParentID)
+	if err != nil {
+		notebookError(c, err)
+		return
+	}
+	response.Success(c, "Notebook moved successfully", nb)
+}
+
+// DeleteNotebook godoc
+// @Summary Delete notebook
+// @Description cascade deletes the subtree and its notes; reparent moves children up
+// @Tags notebooks
+// @Param id path int true "Notebook ID"
+// @Param policy query string false "cascade (default) or reparent"
+// @Success 204
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notebooks/{id} [delete]
+func (h *Handler) deleteNotebook(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var q deleteNotebookQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	if q.Policy == "" {
+		q.Policy = DeleteCascade
+	}
+
+	if err := h.svc.DeleteNotebook(c.GetUint("userID"), id, q.Policy); err != nil {
+		notebookError(c, err)
+		return
+	}
+	response.NoContent(c)
+}
+
+// MoveNote godoc
+// @Summary Move note
+// @Description File a note under a notebook; a null notebook_id moves it to the top level
+// @Tags notebooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param payload body moveNoteReq true "Target notebook"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/move [post]
+func (h *Handler) moveNote(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req moveNoteReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	n, err := h.svc.MoveNote(c.GetUint("userID"), id, req.NotebookID)
+	if err != nil {
+		notebookError(c, err)
+		return
+	}
+	response.Success(c, "Note moved successfully", n)
+}
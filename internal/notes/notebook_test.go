@@ -0,0 +1,212 @@
+package notes
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// tree renders a notebook forest as "name(child child)" for comparison.
+func tree(nodes []*NotebookNode) string {
+	var s string
+	for i, n := range nodes {
+		if i > 0 {
+			s += " "
+		}
+		s += n.Name
+		if len(n.Children) > 0 {
+			s += "(" + tree(n.Children) + ")"
+		}
+	}
+	return s
+}
+
+func newNotebook(t *testing.T, svc *Service, user uint, name string, parent *int64) *int64 {
+	t.Helper()
+	nb, err := svc.CreateNotebook(user, name, parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &nb.ID
+}
+
+func TestNotebookTree(t *testing.T) {
+	svc := newTestService(t)
+	work := newNotebook(t, svc, alice, "work", nil)
+	newNotebook(t, svc, alice, "home", nil)
+	projects := newNotebook(t, svc, alice, "projects", work)
+	newNotebook(t, svc, alice, "beta", projects)
+	newNotebook(t, svc, alice, "alpha", projects)
+	newNotebook(t, svc, alice, "archive", work)
+	newNotebook(t, svc, bob, "bobs", nil)
+
+	all, err := svc.NotebookTree(alice, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree(all); got != "home work(archive projects(alpha beta))" {
+		t.Fatalf("got %s", got)
+	}
+
+	sub, err := svc.NotebookTree(alice, projects)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tree(sub); got != "projects(alpha beta)" {
+		t.Fatalf("subtree %s", got)
+	}
+	if _, err := svc.NotebookTree(bob, work); !errors.Is(err, ErrNotebookNotFound) {
+		t.Fatalf("bob reading alice's subtree: %v", err)
+	}
+	if _, err := svc.CreateNotebook(bob, "inside", work); !errors.Is(err, ErrNotebookNotFound) {
+		t.Fatalf("bob nesting under alice's notebook: %v", err)
+	}
+}
+
+func TestMoveNotebook(t *testing.T) {
+	svc := newTestService(t)
+	a := newNotebook(t, svc, alice, "a", nil)
+	b := newNotebook(t, svc, alice, "b", a)
+	c := newNotebook(t, svc, alice, "c", b)
+	d := newNotebook(t, svc, alice, "d", nil)
+
+	for _, parent := range []*int64{a, b, c} {
+		if _, err := svc.MoveNotebook(alice, *a, parent); !errors.Is(err, ErrNotebookCycle) {
+			t.Fatalf("moving a under %d: %v", *parent, err)
+		}
+	}
+
+	if _, err := svc.MoveNotebook(alice, *b, d); err != nil {
+		t.Fatal(err)
+	}
+	// c left a's subtree with b, so a can go below it
+	if _, err := svc.MoveNotebook(alice, *a, c); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.MoveNotebook(alice, *d, nil); err != nil {
+		t.Fatal(err)
+	}
+	all, _ := svc.NotebookTree(alice, nil)
+	if got := tree(all); got != "d(b(c(a)))" {
+		t.Fatalf("got %s", got)
+	}
+
+	other := newNotebook(t, svc, bob, "other", nil)
+	if _, err := svc.MoveNotebook(alice, *a, other); !errors.Is(err, ErrNotebookNotFound) {
+		t.Fatalf("moving under bob's notebook: %v", err)
+	}
+	if _, err := svc.MoveNotebook(bob, *a, nil); !errors.Is(err, ErrNotebookNotFound) {
+		t.Fatalf("bob moving alice's notebook: %v", err)
+	}
+}
+
+func TestNotebookFilter(t *testing.T) {
+	svc := newTestService(t)
+	top := newNotebook(t, svc, alice, "top", nil)
+	sub := newNotebook(t, svc, alice, "sub", top)
+	create := func(nb *int64) int64 {
+		t.Helper()
+		n, err := svc.Create(Note{UserID: alice, Title: "Note", Content: "x", NotebookID: nb}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n.ID
+	}
+	inTop, inSub := create(top), create(sub)
+	create(nil)
+
+	ids := func(f Filter) []int64 {
+		t.Helper()
+		list, _, err := svc.Paginated(alice, f, 1, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, n := range list {
+			got = append(got, n.ID)
+		}
+		slices.Sort(got)
+		return got
+	}
+	if got := ids(Filter{NotebookID: top}); !slices.Equal(got, []int64{inTop}) {
+		t.Fatalf("direct %v", got)
+	}
+	if got := ids(Filter{NotebookID: top, Recursive: true}); !slices.Equal(got, []int64{inTop, inSub}) {
+		t.Fatalf("recursive %v", got)
+	}
+
+	if _, err := svc.Create(Note{UserID: bob, Title: "Note", Content: "x", NotebookID: top}, nil); !errors.Is(err, ErrNotebookNotFound) {
+		t.Fatalf("bob filing into alice's notebook: %v", err)
+	}
+	n, err := svc.MoveNote(alice, inTop, sub)
+	if err != nil || n.NotebookID == nil || *n.NotebookID != *sub || n.Version != 2 {
+		t.Fatalf("moved %+v, %v", n, err)
+	}
+}
+
+func TestDeleteNotebookReparent(t *testing.T) {
+	svc := newTestService(t)
+	top := newNotebook(t, svc, alice, "top", nil)
+	mid := newNotebook(t, svc, alice, "mid", top)
+	newNotebook(t, svc, alice, "leaf", mid)
+	n, err := svc.Create(Note{UserID: alice, Title: "Note", Content: "x", NotebookID: mid}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.DeleteNotebook(alice, *mid, DeleteReparent); err != nil {
+		t.Fatal(err)
+	}
+	all, _ := svc.NotebookTree(alice, nil)
+	if got := tree(all); got != "top(leaf)" {
+		t.Fatalf("got %s", got)
+	}
+	if n, err = svc.GetByID(alice, n.ID); err != nil || n.NotebookID == nil || *n.NotebookID != *top {
+		t.Fatalf("note %+v, %v", n, err)
+	}
+}
+
+func TestDeleteNotebookCascade(t *testing.T) {
+	svc := newTestService(t)
+	top := newNotebook(t, svc, alice, "top", nil)
+	sub := newNotebook(t, svc, alice, "sub", top)
+	keep := newNotebook(t, svc, alice, "keep", nil)
+	inTop, err := svc.Create(Note{UserID: alice, Title: "Top", Content: "x", NotebookID: top}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	inSub, err := svc.Create(Note{UserID: alice, Title: "Sub", Content: "x", NotebookID: sub}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := svc.Create(Note{UserID: alice, Title: "Kept", Content: "x", NotebookID: keep}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := svc.DeleteNotebook(bob, *top, DeleteCascade); !errors.Is(err, ErrNotebookNotFound) {
+		t.Fatalf("bob deleting: %v", err)
+	}
+	if err := svc.DeleteNotebook(alice, *top, DeleteCascade); err != nil {
+		t.Fatal(err)
+	}
+
+	all, _ := svc.NotebookTree(alice, nil)
+	if got := tree(all); got != "keep" {
+		t.Fatalf("got %s", got)
+	}
+	if _, err := svc.GetByID(alice, kept.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	// the subtree's notes went to the trash, detached from the notebooks
+	trash, total, err := svc.Trash(alice, 1, 10)
+	if err != nil || total != 2 {
+		t.Fatalf("trash %+v, %v", trash, err)
+	}
+	for _, n := range trash {
+		if (n.ID != inTop.ID && n.ID != inSub.ID) || n.NotebookID != nil {
+			t.Fatalf("trashed %+v", n)
+		}
+	}
+}
@@ -0,0 +1,233 @@
+package notes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/testdb"
+	"github.com/tmsankram/gonotes/internal/users"
+	myval "github.com/tmsankram/gonotes/internal/validator"
+)
+
+const (
+	alice uint = 1
+	bob   uint = 2
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		_ = v.RegisterValidation("notest", myval.TitleNoTest)
+	}
+}
+
+func newTestService(t *testing.T) *Service {
+	t.Helper()
+	db := testdb.Open(t, &users.User{}, &Note{}, &Revision{}, &Tag{}, &Notebook{},
+		&Share{}, &Comment{}, &PublicLink{}, &WikiLink{})
+	if testdb.IsPostgres(db) {
+		if err := Migrate(db); err != nil {
+			t.Fatalf("migrate: %v", err)
+		}
+	}
+	return NewService(db, &config.Config{}, nil)
+}
+
+// bobsNote gives bob a tagged note with two revisions.
+func bobsNote(t *testing.T, svc *Service) (Note, []Revision) {
+	t.Helper()
+	n, err := svc.Create(Note{UserID: bob, Title: "Garden plans", Content: "Plant tomatoes in May"}, []string{"garden"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	n, err = svc.Update(bob, n.ID, Note{Title: "Garden plans", Content: "Plant tomatoes in June"}, nil)
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	revs, err := svc.Revisions(bob, n.ID)
+	if err != nil || len(revs) != 2 {
+		t.Fatalf("revisions: %v %v", revs, err)
+	}
+	return n, revs
+}
+
+func TestServiceHidesOtherUsersNotes(t *testing.T) {
+	svc := newTestService(t)
+	n, revs := bobsNote(t, svc)
+	if _, err := svc.Create(Note{UserID: alice, Title: "Shopping", Content: "Milk and bread"}, []string{"home"}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	calls := map[string]func() error{
+		"GetByID": func() error { _, err := svc.GetByID(alice, n.ID); return err },
+		"Update": func() error {
+			_, err := svc.Update(alice, n.ID, Note{Title: "Taken over", Content: "Not yours"}, nil)
+			return err
+		},
+		"Patch": func() error {
+			_, err := svc.Patch(alice, n.ID, Note{Title: "Taken over", Content: "Not yours"}, nil, State{Pinned: boolPtr(true)})
+			return err
+		},
+		"Delete":     func() error { return svc.Delete(alice, n.ID, 0) },
+		"SetState":   func() error { _, err := svc.SetState(alice, n.ID, State{Archived: boolPtr(true)}); return err },
+		"AttachTags": func() error { _, err := svc.AttachTags(alice, n.ID, []string{"mine"}); return err },
+		"DetachTag":  func() error { _, err := svc.DetachTag(alice, n.ID, "garden"); return err },
+		"MoveNote":   func() error { _, err := svc.MoveNote(alice, n.ID, nil); return err },
+		"Revisions":  func() error { _, err := svc.Revisions(alice, n.ID); return err },
+		"Revision":   func() error { _, err := svc.Revision(alice, n.ID, revs[0].ID); return err },
+		"Diff":       func() error { _, err := svc.Diff(alice, n.ID, revs[1].ID, revs[0].ID); return err },
+		"Restore":    func() error { _, err := svc.Restore(alice, n.ID, revs[1].ID); return err },
+	}
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			if err := call(); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("got %v, want ErrNotFound", err)
+			}
+		})
+	}
+
+	t.Run("Paginated", func(t *testing.T) {
+		list, total, err := svc.Paginated(alice, Filter{}, 1, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 1 || len(list) != 1 || list[0].UserID != alice {
+			t.Fatalf("got %d notes of %d: %+v", len(list), total, list)
+		}
+	})
+
+	t.Run("Keyset", func(t *testing.T) {
+		page, err := svc.Keyset(alice, Filter{}, nil, nil, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, got := range page.Items {
+			if got.ID == n.ID {
+				t.Fatalf("bob's note listed for alice")
+			}
+		}
+	})
+
+	t.Run("Tags", func(t *testing.T) {
+		tags, err := svc.Tags(alice)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tags) != 1 || tags[0].Name != "home" {
+			t.Fatalf("got %+v", tags)
+		}
+		tagged, _, err := svc.Paginated(alice, Filter{Tags: []string{"garden"}}, 1, 50)
+		if err != nil || len(tagged) != 0 {
+			t.Fatalf("got %+v, %v", tagged, err)
+		}
+		if _, err := svc.GetTag(alice, n.Tags[0].ID); !errors.Is(err, ErrTagNotFound) {
+			t.Fatalf("GetTag: got %v", err)
+		}
+	})
+
+	t.Run("Search", func(t *testing.T) {
+		if !testdb.IsPostgres(svc.db) {
+			t.Skip("full-text search needs TEST_DATABASE_URL")
+		}
+		results, total, err := svc.Search(alice, "tomatoes", Filter{}, 1, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 0 || len(results) != 0 {
+			t.Fatalf("got %+v", results)
+		}
+	})
+
+	// nothing alice tried changed bob's note
+	got, err := svc.GetByID(bob, n.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Version != n.Version || got.Title != n.Title || got.Pinned || got.Archived || len(got.Tags) != 1 {
+		t.Fatalf("note changed: %+v", got)
+	}
+	if revs, _ := svc.Revisions(bob, n.ID); len(revs) != 2 {
+		t.Fatalf("got %d revisions", len(revs))
+	}
+}
+
+func TestHandlerHidesOtherUsersNotes(t *testing.T) {
+	svc := newTestService(t)
+	n, revs := bobsNote(t, svc)
+
+	r := gin.New()
+	NewHandler(svc, users.NewService(svc.db)).RegisterRoutes(r)
+	token, err := auth.GenerateToken(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	note := fmt.Sprintf("/notes/%d", n.ID)
+	body := `{"title": "Taken over", "content": "Not yours"}`
+	requests := []struct {
+		method, path, contentType, body string
+	}{
+		{http.MethodGet, note, "", ""},
+		{http.MethodGet, note + "/render", "", ""},
+		{http.MethodPut, note, "application/json", body},
+		{http.MethodPatch, note, "application/merge-patch+json", `{"title": "Taken over"}`},
+		{http.MethodDelete, note, "", ""},
+		{http.MethodGet, note + "/revisions", "", ""},
+		{http.MethodGet, fmt.Sprintf("%s/revisions/%d", note, revs[0].ID), "", ""},
+		{http.MethodPost, fmt.Sprintf("%s/revisions/%d/restore", note, revs[1].ID), "", ""},
+		{http.MethodGet, fmt.Sprintf("%s/diff?from=%d&to=%d", note, revs[1].ID, revs[0].ID), "", ""},
+		{http.MethodPost, note + "/tags", "application/json", `{"tags": ["mine"]}`},
+		{http.MethodDelete, note + "/tags/garden", "", ""},
+		{http.MethodPost, note + "/pin", "", ""},
+		{http.MethodPost, note + "/archive", "", ""},
+		{http.MethodGet, note + "/links", "", ""},
+		{http.MethodGet, note + "/backlinks", "", ""},
+		{http.MethodGet, note + "/public-links", "", ""},
+	}
+	for _, req := range requests {
+		t.Run(req.method+" "+req.path, func(t *testing.T) {
+			rec := serve(r, token, req.method, req.path, req.contentType, req.body)
+			if rec.Code != http.StatusNotFound {
+				t.Fatalf("got %d: %s", rec.Code, rec.Body)
+			}
+		})
+	}
+
+	t.Run("GET /notes", func(t *testing.T) {
+		rec := serve(r, token, http.MethodGet, "/notes/", "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", rec.Code, rec.Body)
+		}
+		var list struct {
+			Items []Note `json:"items"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &list); err != nil {
+			t.Fatal(err)
+		}
+		if len(list.Items) != 0 {
+			t.Fatalf("got %+v", list.Items)
+		}
+	})
+}
+
+func serve(r http.Handler, token, method, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,83 @@
+package notes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// ErrUnsupportedPatch is returned for patch media types other than
+// MergePatchType and JSONPatchType.
+var ErrUnsupportedPatch = errors.New("unsupported patch type, use " + MergePatchType + " or " + JSONPatchType)
+
+// patchDoc is the editable view of a note that PATCH requests operate on.
+// Its binding rules mirror createUpdateReq so that a patched note is held
+// to the same constraints as one sent with PUT.
+type patchDoc struct {
+	Title   string   `json:"title" binding:"required,min=3,max=100,notest"`
+	Content string   `json:"content" binding:"required,min=5,max=5000"`
+	Tags    []string `json:"tags" binding:"max=20,dive,min=1,max=32"`
+
+	Pinned   bool `json:"pinned"`
+	Archived bool `json:"archived"`
+}
+
+func newPatchDoc(n Note) patchDoc {
+	doc := patchDoc{
+		Title:   n.Title,
+		Content: n.Content,
+		Tags:    make([]string, len(n.Tags)),
+
+		Pinned:   n.Pinned,
+		Archived: n.Archived,
+	}
+	for i, t := range n.Tags {
+		doc.Tags[i] = t.Name
+	}
+	return doc
+}
+
+// applyPatch applies an RFC 7396 merge patch or an RFC 6902 JSON patch to
+// the note's patchDoc. Fields outside the document are rejected.
+func applyPatch(n Note, contentType string, patch []byte) (patchDoc, error) {
+	original, err := json.Marshal(newPatchDoc(n))
+	if err != nil {
+		return patchDoc{}, err
+	}
+
+	var patched []byte
+	switch contentType {
+	case MergePatchType:
+		patched, err = jsonpatch.MergePatch(original, patch)
+	case JSONPatchType:
+		var ops jsonpatch.Patch
+		ops, err = jsonpatch.DecodePatch(patch)
+		if err == nil {
+			patched, err = ops.Apply(original)
+		}
+	default:
+		return patchDoc{}, ErrUnsupportedPatch
+	}
+	if err != nil {
+		return patchDoc{}, fmt.Errorf("invalid patch: %w", err)
+	}
+
+	var doc patchDoc
+	dec := json.NewDecoder(bytes.NewReader(patched))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&doc); err != nil {
+		return patchDoc{}, fmt.Errorf("invalid patch result: %w", err)
+	}
+	if doc.Tags == nil {
+		doc.Tags = []string{}
+	}
+	return doc, nil
+}
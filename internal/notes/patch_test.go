@@ -0,0 +1,162 @@
+package notes
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/markdown"
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+func TestApplyPatch(t *testing.T) {
+	n := Note{Title: "Groceries", Content: "milk, eggs", Pinned: true, Tags: []Tag{{Name: "home"}, {Name: "todo"}}}
+	tests := []struct {
+		name, contentType, patch string
+		want                     patchDoc
+	}{
+		{
+			"merge title", MergePatchType, `{"title": "Shopping"}`,
+			patchDoc{Title: "Shopping", Content: "milk, eggs", Tags: []string{"home", "todo"}, Pinned: true},
+		},
+		{
+			"merge replaces tags", MergePatchType, `{"tags": ["errands"], "archived": true}`,
+			patchDoc{Title: "Groceries", Content: "milk, eggs", Tags: []string{"errands"}, Pinned: true, Archived: true},
+		},
+		{
+			"merge null clears", MergePatchType, `{"tags": null, "pinned": null}`,
+			patchDoc{Title: "Groceries", Content: "milk, eggs", Tags: []string{}},
+		},
+		{
+			"json patch", JSONPatchType,
+			`[{"op": "test", "path": "/title", "value": "Groceries"},
+			  {"op": "add", "path": "/tags/-", "value": "weekly"},
+			  {"op": "remove", "path": "/tags/0"},
+			  {"op": "replace", "path": "/pinned", "value": false}]`,
+			patchDoc{Title: "Groceries", Content: "milk, eggs", Tags: []string{"todo", "weekly"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := applyPatch(n, tt.contentType, []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("got %+v", got)
+			}
+		})
+	}
+}
+
+func TestApplyPatchRejects(t *testing.T) {
+	n := Note{Title: "Groceries", Content: "milk, eggs"}
+	tests := []struct {
+		name, contentType, patch string
+	}{
+		{"unknown field", MergePatchType, `{"user_id": 2}`},
+		{"unknown path", JSONPatchType, `[{"op": "add", "path": "/version", "value": 9}]`},
+		{"failed test", JSONPatchType, `[{"op": "test", "path": "/title", "value": "Other"}]`},
+		{"missing path", JSONPatchType, `[{"op": "remove", "path": "/tags/3"}]`},
+		{"wrong type", MergePatchType, `{"title": 5}`},
+		{"not json", MergePatchType, `{`},
+		{"not a list of ops", JSONPatchType, `{"title": "x"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if doc, err := applyPatch(n, tt.contentType, []byte(tt.patch)); err == nil {
+				t.Fatalf("got %+v", doc)
+			}
+		})
+	}
+
+	if _, err := applyPatch(n, "application/json", []byte(`{}`)); !errors.Is(err, ErrUnsupportedPatch) {
+		t.Fatalf("plain json: %v", err)
+	}
+}
+
+func TestPatchNote(t *testing.T) {
+	svc := newTestService(t)
+	r := gin.New()
+	NewHandler(svc, users.NewService(svc.db)).RegisterRoutes(r)
+	token, err := auth.GenerateToken(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := svc.Create(Note{UserID: alice, Title: "Groceries", Content: "milk, eggs"}, []string{"home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := fmt.Sprintf("/notes/%d", n.ID)
+
+	patch := func(contentType, ifMatch, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPatch, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", contentType)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := patch(MergePatchType, ETag(n, markdown.FormatMarkdown), `{"content": "milk, eggs, bread", "pinned": true}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	var body struct {
+		Details Note `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	got := body.Details
+	if got.Title != "Groceries" || got.Content != "milk, eggs, bread" || !got.Pinned || len(got.Tags) != 1 {
+		t.Fatalf("patched %+v", got)
+	}
+	if rec.Header().Get("ETag") != ETag(got, markdown.FormatMarkdown) {
+		t.Fatalf("etag %s for version %d", rec.Header().Get("ETag"), got.Version)
+	}
+
+	// the old ETag no longer matches
+	if rec := patch(MergePatchType, ETag(n, markdown.FormatMarkdown), `{"title": "Late"}`); rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("stale If-Match: %d", rec.Code)
+	}
+
+	rec = patch(JSONPatchType, "", `[{"op": "add", "path": "/tags/-", "value": "weekly"}]`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	n, _ = svc.GetByID(alice, n.ID)
+	if !slices.Equal(tagNames(n), []string{"home", "weekly"}) || !n.Pinned {
+		t.Fatalf("after json patch %+v", n)
+	}
+
+	rejected := []struct {
+		contentType, body string
+		code              int
+	}{
+		{"application/json", `{"title": "Plain"}`, http.StatusUnsupportedMediaType},
+		{MergePatchType, `{"title": "ab"}`, http.StatusBadRequest},
+		{MergePatchType, `{"content": null}`, http.StatusBadRequest},
+		{MergePatchType, `{"version": 1}`, http.StatusBadRequest},
+		{JSONPatchType, `[{"op": "test", "path": "/title", "value": "Other"}]`, http.StatusBadRequest},
+	}
+	for _, tt := range rejected {
+		if rec := patch(tt.contentType, "", tt.body); rec.Code != tt.code {
+			t.Errorf("%s %s: got %d: %s", tt.contentType, tt.body, rec.Code, rec.Body)
+		}
+	}
+	if after, _ := svc.GetByID(alice, n.ID); after.Version != n.Version || after.Title != "Groceries" {
+		t.Fatalf("rejected patches changed the note: %+v", after)
+	}
+}
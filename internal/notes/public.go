@@ -0,0 +1,164 @@
+package notes
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+var (
+	// ErrLinkNotFound is returned for unknown or revoked public link tokens.
+	ErrLinkNotFound = errors.New("link not found")
+	// ErrLinkExpired is returned for public links past their expiry time.
+	ErrLinkExpired = errors.New("link has expired")
+	// ErrLinkPassword is returned when a password protected link is opened
+	// without the right password.
+	ErrLinkPassword = errors.New("link password required")
+)
+
+// PublicLink makes a note readable by anyone who knows its token.
+type PublicLink struct {
+	ID           int64      `gorm:"primaryKey" json:"id"`
+	NoteID       int64      `gorm:"not null;index" json:"note_id"`
+	Token        string     `gorm:"not null;uniqueIndex" json:"token"`
+	PasswordHash string     `json:"-"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+	Views        int64      `gorm:"not null;default:0" json:"views"`
+	CreatedAt    time.Time  `json:"created_at"`
+
+	HasPassword bool `gorm:"-" json:"has_password"`
+}
+
+func (l *PublicLink) AfterFind(tx *gorm.DB) error {
+	l.HasPassword = l.PasswordHash != ""
+	return nil
+}
+
+// PublicNote is what a public link shows. It deliberately leaves out
+// everything about the owner.
+type PublicNote struct {
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// newLinkToken returns 32 random bytes, URL safe.
+func newLinkToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// CreateLink publishes a note under a new public link. A nil expiresAt
+// never expires and an empty password leaves the link open.
+func (s *Service) CreateLink(ownerID uint, noteID int64, expiresAt *time.Time, password string) (PublicLink, error) {
+	if _, err := s.authorize(ownerID, noteID, permOwner); err != nil {
+		return PublicLink{}, err
+	}
+
+	token, err := newLinkToken()
+	if err != nil {
+		return PublicLink{}, err
+	}
+
+	l := PublicLink{NoteID: noteID, Token: token, ExpiresAt: expiresAt}
+	if password != "" {
+		if l.PasswordHash, err = users.HashPassword(password); err != nil {
+			return PublicLink{}, err
+		}
+	}
+
+	if err := s.db.Create(&l).Error; err != nil {
+		return PublicLink{}, err
+	}
+	l.HasPassword = l.PasswordHash != ""
+	return l, nil
+}
+
+// Links lists the public links of a note.
+func (s *Service) Links(ownerID uint, noteID int64) ([]PublicLink, error) {
+	if _, err := s.authorize(ownerID, noteID, permOwner); err != nil {
+		return nil, err
+	}
+
+	links := []PublicLink{}
+	err := s.db.Where("note_id = ?", noteID).Order("id DESC").Find(&links).Error
+	return links, err
+}
+
+// RevokeLink deletes a public link; its token stops working at once.
+func (s *Service) RevokeLink(ownerID uint, noteID, linkID int64) error {
+	if _, err := s.authorize(ownerID, noteID, permOwner); err != nil {
+		return err
+	}
+
+	res := s.db.Where("note_id = ?", noteID).Delete(&PublicLink{}, linkID)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrLinkNotFound
+	}
+	return nil
+}
+
+// LinkRequiresPassword reports whether the link behind token is password
+// protected, so that callers can ask for it before opening the link.
+func (s *Service) LinkRequiresPassword(token string) (bool, error) {
+	l, err := s.link(token)
+	if err != nil {
+		return false, err
+	}
+	return l.PasswordHash != "", nil
+}
+
+// OpenLink resolves a public link token and counts the view. Links to
+// trashed notes behave like revoked ones.
+func (s *Service) OpenLink(token, password string) (PublicNote, error) {
+	l, err := s.link(token)
+	if err != nil {
+		return PublicNote{}, err
+	}
+	if l.PasswordHash != "" && !users.CheckPasswordHash(password, l.PasswordHash) {
+		return PublicNote{}, ErrLinkPassword
+	}
+
+	var n Note
+	err = s.db.Select("title", "content", "updated_at").First(&n, l.NoteID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return PublicNote{}, ErrLinkNotFound
+	}
+	if err != nil {
+		return PublicNote{}, err
+	}
+
+	err = s.db.Model(&PublicLink{}).Where("id = ?", l.ID).
+		UpdateColumn("views", gorm.Expr("views + 1")).Error
+	if err != nil {
+		return PublicNote{}, err
+	}
+
+	return PublicNote{Title: n.Title, Content: n.Content, UpdatedAt: n.UpdatedAt}, nil
+}
+
+func (s *Service) link(token string) (PublicLink, error) {
+	var l PublicLink
+	err := s.db.Where("token = ?", token).First(&l).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return l, ErrLinkNotFound
+	}
+	if err != nil {
+		return l, err
+	}
+	if l.ExpiresAt != nil && time.Now().After(*l.ExpiresAt) {
+		return l, ErrLinkExpired
+	}
+	return l, nil
+}
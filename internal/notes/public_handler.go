@@ -0,0 +1,115 @@
+package notes
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+type linkReq struct {
+	ExpiresAt *time.Time `json:"expires_at"`
+	Password  string     `json:"password" binding:"omitempty,min=4,max=72"`
+}
+
+// linkError maps public link service errors to responses.
+func linkError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrLinkNotFound):
+		response.NotFound(c, err)
+	case errors.Is(err, ErrForbidden):
+		response.Forbidden(c, err)
+	default:
+		response.Internal(c, err)
+	}
+}
+
+// ListLinks godoc
+// @Summary List public links
+// @Description Get the public read-only links of a note; owner only
+// @Tags sharing
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/public-links [get]
+func (h *Handler) listLinks(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	links, err := h.svc.Links(c.GetUint("userID"), id)
+	if err != nil {
+		linkError(c, err)
+		return
+	}
+	response.Success(c, "Links retrieved successfully", links)
+}
+
+// CreateLink godoc
+// @Summary Create public link
+// @Description Publish a note read-only at /p/{token}, optionally with an expiry time and a password
+// @Tags sharing
+// @Accept json
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param payload body linkReq false "Expiry and password"
+// @Success 201 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/public-links [post]
+func (h *Handler) createLink(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req linkReq
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			response.ValidationError(c, err.Error())
+			return
+		}
+	}
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		response.ValidationError(c, "expires_at must be in the future")
+		return
+	}
+
+	l, err := h.svc.CreateLink(c.GetUint("userID"), id, req.ExpiresAt, req.Password)
+	if err != nil {
+		linkError(c, err)
+		return
+	}
+	response.Created(c, "Link created successfully", l)
+}
+
+// RevokeLink godoc
+// @Summary Revoke public link
+// @Tags sharing
+// @Param id path int true "Note ID"
+// @Param link path int true "Link ID"
+// @Success 204
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/public-links/{link} [delete]
+func (h *Handler) revokeLink(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	linkID, ok := paramID(c, "link")
+	if !ok {
+		return
+	}
+
+	if err := h.svc.RevokeLink(c.GetUint("userID"), id, linkID); err != nil {
+		linkError(c, err)
+		return
+	}
+	response.NoContent(c)
+}
@@ -0,0 +1,115 @@
+package notes
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ErrRevisionNotFound is returned when a revision does not exist for the note.
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// Revision is an immutable snapshot of a note taken every time it is saved.
+type Revision struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	NoteID    int64     `gorm:"index;not null" json:"note_id"`
+	AuthorID  uint      `json:"author_id"`
+	Title     string    `json:"title"`
+	Content   string    `json:"content"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RevisionDiff describes the changes between two revisions of a note.
+type RevisionDiff struct {
+	From    int64       `json:"from"`
+	To      int64       `json:"to"`
+	Unified string      `json:"unified"`
+	Title   []DiffChunk `json:"title"`
+	Words   []DiffChunk `json:"words"`
+}
+
+// recordRevision snapshots n and prunes revisions beyond the retention limit.
+func (s *Service) recordRevision(tx *gorm.DB, authorID uint, n Note) error {
+	rev := Revision{
+		NoteID:   n.ID,
+		AuthorID: authorID,
+		Title:    n.Title,
+		Content:  n.Content,
+	}
+	if err := tx.Create(&rev).Error; err != nil {
+		return err
+	}
+
+	if s.keepRevisions <= 0 {
+		return nil
+	}
+
+	keep := tx.Model(&Revision{}).
+		Select("id").
+		Where("note_id = ?", n.ID).
+		Order("id DESC").
+		Limit(s.keepRevisions)
+
+	return tx.Where("note_id = ? AND id NOT IN (?)", n.ID, keep).Delete(&Revision{}).Error
+}
+
+// Revisions lists the revisions of a note, newest first.
+func (s *Service) Revisions(userID uint, noteID int64) ([]Revision, error) {
+	if _, err := s.GetByID(userID, noteID); err != nil {
+		return nil, err
+	}
+
+	revs := []Revision{}
+	err := s.db.Where("note_id = ?", noteID).Order("id DESC").Find(&revs).Error
+	return revs, err
+}
+
+// Revision fetches a single revision of a note.
+func (s *Service) Revision(userID uint, noteID, revID int64) (Revision, error) {
+	if _, err := s.GetByID(userID, noteID); err != nil {
+		return Revision{}, err
+	}
+
+	var rev Revision
+	err := s.db.Where("note_id = ?", noteID).First(&rev, revID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return rev, ErrRevisionNotFound
+	}
+	return rev, err
+}
+
+// Diff compares two revisions of the same note.
+func (s *Service) Diff(userID uint, noteID, fromID, toID int64) (RevisionDiff, error) {
+	from, err := s.Revision(userID, noteID, fromID)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+	to, err := s.Revision(userID, noteID, toID)
+	if err != nil {
+		return RevisionDiff{}, err
+	}
+
+	return RevisionDiff{
+		From:    from.ID,
+		To:      to.ID,
+		Unified: UnifiedDiff(fmt.Sprintf("revision %d", from.ID), fmt.Sprintf("revision %d", to.ID), from.Content, to.Content),
+		Title:   WordDiff(from.Title, to.Title),
+		Words:   WordDiff(from.Content, to.Content),
+	}, nil
+}
+
+// Restore makes an old revision the current state of the note. The restore
+// is itself recorded as a new revision, so history is never rewritten.
+func (s *Service) Restore(userID uint, noteID, revID int64) (Note, error) {
+	rev, err := s.Revision(userID, noteID, revID)
+	if err != nil {
+		return Note{}, err
+	}
+
+	return s.Update(userID, noteID, Note{
+		Title:   rev.Title,
+		Content: rev.Content,
+	}, nil)
+}
@@ -0,0 +1,181 @@
+package notes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestWordDiff(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     []DiffChunk
+	}{
+		{"", "", nil},
+		{"same text", "same text", []DiffChunk{{DiffEqual, "same text"}}},
+		{"", "new", []DiffChunk{{DiffInsert, "new"}}},
+		{"old", "", []DiffChunk{{DiffDelete, "old"}}},
+		{"the quick  fox", "the slow fox jumps", []DiffChunk{
+			{DiffEqual, "the "}, {DiffDelete, "quick  "}, {DiffInsert, "slow "}, {DiffEqual, "fox"}, {DiffInsert, " jumps"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			got := WordDiff(tt.from, tt.to)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("got %q", got)
+			}
+
+			// the chunks put both texts back together
+			var from, to strings.Builder
+			for _, c := range got {
+				if c.Op != DiffInsert {
+					from.WriteString(c.Text)
+				}
+				if c.Op != DiffDelete {
+					to.WriteString(c.Text)
+				}
+			}
+			if from.String() != tt.from || to.String() != tt.to {
+				t.Fatalf("rebuilt %q and %q", from.String(), to.String())
+			}
+		})
+	}
+}
+
+// TestUnifiedDiff compares with the output of GNU diff -u.
+func TestUnifiedDiff(t *testing.T) {
+	alphabet := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\no\np\nq\nr\n"
+	tests := []struct {
+		name, from, to, want string
+	}{
+		{"unchanged", "x\n", "x\n", ""},
+		{"deleted line", "x\ny\nz\n", "x\nz\n", "@@ -1,3 +1,2 @@\n x\n-y\n z\n"},
+		{"from nothing", "", "x\n", "@@ -0,0 +1,1 @@\n+x\n"},
+		{"to nothing", "x\ny\n", "", "@@ -1,2 +0,0 @@\n-x\n-y\n"},
+		{
+			"two hunks", alphabet,
+			strings.Replace(strings.Replace(alphabet, "b\n", "B\n", 1), "q\n", "Q\n", 1) + "extra\n",
+			"@@ -1,5 +1,5 @@\n a\n-b\n+B\n c\n d\n e\n" +
+				"@@ -14,5 +14,6 @@\n n\n o\n p\n-q\n+Q\n r\n+extra\n",
+		},
+		{
+			"no newline at end", "one\ntwo", "one\ntwo\nthree",
+			"@@ -1,2 +1,3 @@\n one\n-two\n\\ No newline at end of file\n+two\n+three\n\\ No newline at end of file\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			want := "--- a\n+++ b\n" + tt.want
+			if got := UnifiedDiff("a", "b", tt.from, tt.to); got != want {
+				t.Fatalf("got\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestRevisionPruning(t *testing.T) {
+	svc := newTestService(t)
+	svc.keepRevisions = 3
+
+	n, err := svc.Create(Note{UserID: alice, Title: "Draft", Content: "v1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i <= 5; i++ {
+		if n, err = svc.Update(alice, n.ID, Note{Title: "Draft", Content: fmt.Sprintf("v%d", i)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	other, err := svc.Create(Note{UserID: alice, Title: "Other", Content: "kept"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	revs, err := svc.Revisions(alice, n.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var contents []string
+	for _, r := range revs {
+		contents = append(contents, r.Content)
+	}
+	if strings.Join(contents, ",") != "v5,v4,v3" {
+		t.Fatalf("kept %v", contents)
+	}
+	// pruning one note leaves the others alone
+	if revs, err := svc.Revisions(alice, other.ID); err != nil || len(revs) != 1 {
+		t.Fatalf("other note: %+v, %v", revs, err)
+	}
+}
+
+func TestRevisionsKeptWithoutLimit(t *testing.T) {
+	// the default configuration keeps every revision
+	svc := newTestService(t)
+	n, err := svc.Create(Note{UserID: alice, Title: "Draft", Content: "v1"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i <= 12; i++ {
+		if _, err := svc.Update(alice, n.ID, Note{Title: "Draft", Content: fmt.Sprintf("v%d", i)}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if revs, err := svc.Revisions(alice, n.ID); err != nil || len(revs) != 12 {
+		t.Fatalf("got %d revisions, %v", len(revs), err)
+	}
+}
+
+func TestDiffAndRestore(t *testing.T) {
+	svc := newTestService(t)
+	n, err := svc.Create(Note{UserID: alice, Title: "Plan", Content: "buy milk\n"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Update(alice, n.ID, Note{Title: "Plans", Content: "buy oat milk\n"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	revs, err := svc.Revisions(alice, n.ID)
+	if err != nil || len(revs) != 2 {
+		t.Fatalf("got %+v, %v", revs, err)
+	}
+	newer, older := revs[0], revs[1]
+
+	d, err := svc.Diff(alice, n.ID, older.ID, newer.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantUnified := fmt.Sprintf("--- revision %d\n+++ revision %d\n@@ -1,1 +1,1 @@\n-buy milk\n+buy oat milk\n", older.ID, newer.ID)
+	if d.Unified != wantUnified {
+		t.Fatalf("unified\n%s", d.Unified)
+	}
+	if fmt.Sprint(d.Title) != fmt.Sprint([]DiffChunk{{DiffDelete, "Plan"}, {DiffInsert, "Plans"}}) {
+		t.Fatalf("title %q", d.Title)
+	}
+	if fmt.Sprint(d.Words) != fmt.Sprint([]DiffChunk{{DiffEqual, "buy "}, {DiffInsert, "oat "}, {DiffEqual, "milk\n"}}) {
+		t.Fatalf("words %q", d.Words)
+	}
+
+	// a revision of another note is not found through this one
+	other, err := svc.Create(Note{UserID: alice, Title: "Other", Content: "x"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRevs, _ := svc.Revisions(alice, other.ID)
+	if _, err := svc.Diff(alice, n.ID, older.ID, otherRevs[0].ID); !errors.Is(err, ErrRevisionNotFound) {
+		t.Fatalf("got %v", err)
+	}
+
+	// restoring records a new revision rather than rewriting history
+	restored, err := svc.Restore(alice, n.ID, older.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored.Title != "Plan" || restored.Content != "buy milk\n" {
+		t.Fatalf("restored %+v", restored)
+	}
+	if revs, _ := svc.Revisions(alice, n.ID); len(revs) != 3 || revs[0].Content != "buy milk\n" || revs[2].ID != older.ID {
+		t.Fatalf("revisions %+v", revs)
+	}
+}
@@ -0,0 +1,164 @@
+package notes
+
+import (
+	"html"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Markers handed to ts_headline. They are private-use runes so that the
+// snippet can be HTML-escaped before they are swapped for <mark> tags.
+const (
+	markStart = "\uE000"
+	markStop  = "\uE001"
+)
+
+const headlineOptions = "StartSel=" + markStart + ",StopSel=" + markStop + ",MaxFragments=2,MaxWords=30,MinWords=10"
+
+// SearchResult is a note matched by a full-text query.
+type SearchResult struct {
+	Note
+	Rank    float64 `json:"rank"`
+	Snippet string  `json:"snippet"` // HTML-escaped, matches wrapped in <mark>
+}
+
+// Migrate creates the database objects AutoMigrate cannot express: the
+// generated tsvector column over title+content and its GIN index.
+func Migrate(db *gorm.DB) error {
+	stmts := []string{
+		`ALTER TABLE notes ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (
+				setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+				setweight(to_tsvector('english', coalesce(content, '')), 'B')
+			) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_notes_search_vector ON notes USING GIN (search_vector)`,
+	}
+	for _, stmt := range stmts {
+		if err := db.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Search runs a ranked full-text query over the user's notes.
+//
+// The query syntax is intentionally small: bare words are ANDed,
+// "quoted words" must appear as a phrase and a trailing * makes a word a
+// prefix match (e.g. `"meeting notes" proj*`). Results are ordered by
+// rank unless f.Query asks for another sort.
+func (s *Service) Search(userID uint, q string, f Filter, page, limit int) ([]SearchResult, int64, error) {
+	results := []SearchResult{}
+	var total int64
+
+	tsq := ParseQuery(q)
+	if tsq == "" {
+		return results, 0, nil
+	}
+
+	base := func() *gorm.DB {
+		return s.db.Model(&Note{}).
+			Scopes(owned(userID), tagged(userID, f.Tags, f.MatchAllTags), inNotebook(userID, f.NotebookID, f.Recursive), unarchived(f.IncludeArchived), f.Query.Where()).
+			Joins("CROSS JOIN to_tsquery('english', ?) AS query", tsq).
+			Where("search_vector @@ query")
+	}
+
+	if err := base().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+
+	sel := base().
+		Select("notes.*, ts_rank(search_vector, query) AS rank, ts_headline('english', content, query, ?) AS snippet", headlineOptions)
+	if f.Query.Sorted() {
+		sel = sel.Scopes(f.Query.Order())
+	} else {
+		sel = sel.Order("rank DESC, id DESC")
+	}
+
+	err := sel.
+		Limit(limit).
+		Offset(offset).
+		Scan(&results).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if err := s.loadTags(results); err != nil {
+		return nil, 0, err
+	}
+	for i := range results {
+		results[i].Snippet = highlight(results[i].Snippet)
+	}
+
+	return results, total, nil
+}
+
+// loadTags fills in the tags of search results, which are scanned from a
+// raw projection and so cannot use Preload.
+func (s *Service) loadTags(results []SearchResult) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+
+	var withTags []Note
+	if err := s.db.Preload("Tags").Select("id").Find(&withTags, ids).Error; err != nil {
+		return err
+	}
+
+	byID := make(map[int64][]Tag, len(withTags))
+	for _, n := range withTags {
+		byID[n.ID] = n.Tags
+	}
+	for i := range results {
+		results[i].Tags = byID[results[i].ID]
+	}
+	return nil
+}
+
+// ParseQuery turns user input into a PostgreSQL tsquery string. Only
+// letters and digits survive, so the result is always valid tsquery syntax.
+func ParseQuery(q string) string {
+	var terms []string
+
+	for i, part := range strings.Split(q, `"`) {
+		// odd parts were between quotes
+		if i%2 == 1 {
+			words := queryWords(part)
+			if len(words) > 0 {
+				terms = append(terms, "("+strings.Join(words, " <-> ")+")")
+			}
+			continue
+		}
+
+		for _, field := range strings.Fields(part) {
+			words := queryWords(field)
+			if len(words) > 0 && strings.HasSuffix(field, "*") {
+				words[len(words)-1] += ":*"
+			}
+			terms = append(terms, words...)
+		}
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+func queryWords(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	snippet = strings.ReplaceAll(snippet, markStart, "<mark>")
+	return strings.ReplaceAll(snippet, markStop, "</mark>")
+}
@@ -0,0 +1,119 @@
+package notes
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/tmsankram/gonotes/internal/testdb"
+)
+
+func TestParseQuery(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"meeting", "meeting"},
+		{"Meeting  Notes", "meeting & notes"},
+		{`"meeting notes" proj*`, "(meeting <-> notes) & proj:*"},
+		{`"Quarterly  report, draft"`, "(quarterly <-> report <-> draft)"},
+		{`"one"`, "(one)"},
+		{`""`, ""},
+		{`" "`, ""},
+		// an unclosed quote runs to the end
+		{`budget "next year`, "budget & (next <-> year)"},
+		{`a "b c" d "e f"`, "a & (b <-> c) & d & (e <-> f)"},
+		// only a trailing * makes a prefix, of the last word only
+		{"proj*", "proj:*"},
+		{"proj*ect", "proj & ect"},
+		{"follow-up*", "follow & up:*"},
+		{`"proj*"`, "(proj)"},
+		{"*", ""},
+		{"***", ""},
+		// tsquery operators and punctuation never get through
+		{"a & b | !c", "a & b & c"},
+		{"x:* <-> (y)", "x:* & y"},
+		{"'); DROP TABLE notes; --", "drop & table & notes"},
+		{"Café 2026", "café & 2026"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := ParseQuery(tt.in); got != tt.want {
+				t.Fatalf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	got := highlight("a <b>&amp; " + markStart + "match" + markStop + " \"q\"")
+	want := "a &lt;b&gt;&amp;amp; <mark>match</mark> &#34;q&#34;"
+	if got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestSearchWithoutTerms(t *testing.T) {
+	// nothing to look for, so no query reaches the database
+	svc := newTestService(t)
+	results, total, err := svc.Search(alice, `"" * !`, Filter{}, 1, 10)
+	if err != nil || total != 0 || len(results) != 0 {
+		t.Fatalf("got %+v, %d, %v", results, total, err)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	svc := newTestService(t)
+	if !testdb.IsPostgres(svc.db) {
+		t.Skip("full-text search needs TEST_DATABASE_URL")
+	}
+	create := func(title, content string) int64 {
+		t.Helper()
+		n, err := svc.Create(Note{UserID: alice, Title: title, Content: content}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n.ID
+	}
+	inTitle := create("Meeting notes", "Agenda for Monday")
+	inContent := create("Monday", "Notes from the weekly meeting <b>")
+	apart := create("Notes", "The meeting was long, as were the notes")
+	project := create("Projects", "Project plan and projection")
+
+	ids := func(q string) []int64 {
+		t.Helper()
+		results, total, err := svc.Search(alice, q, Filter{}, 1, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(total) != len(results) {
+			t.Fatalf("%s: total %d for %d results", q, total, len(results))
+		}
+		var got []int64
+		for _, r := range results {
+			got = append(got, r.ID)
+		}
+		return got
+	}
+
+	// title matches rank above content matches
+	if got := ids("meeting notes"); len(got) != 3 || got[0] != inTitle || !slices.Contains(got, apart) {
+		t.Fatalf("words: %v", got)
+	}
+	// the words are apart in one note and out of order in another
+	if got := ids(`"meeting notes"`); !slices.Equal(got, []int64{inTitle}) {
+		t.Fatalf("phrase: %v", got)
+	}
+	if got := ids("proj*"); !slices.Equal(got, []int64{project}) {
+		t.Fatalf("prefix: %v", got)
+	}
+
+	results, _, err := svc.Search(alice, "weekly", Filter{}, 1, 10)
+	if err != nil || len(results) != 1 || results[0].ID != inContent {
+		t.Fatalf("got %+v, %v", results, err)
+	}
+	if s := results[0].Snippet; !strings.Contains(s, "<mark>weekly</mark>") || !strings.Contains(s, "&lt;b&gt;") {
+		t.Fatalf("snippet %q", s)
+	}
+}
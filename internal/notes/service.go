@@ -2,55 +2,226 @@ package notes
 
 import (
 	"errors"
+	"strings"
 
 	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/events"
+)
+
+var (
+	// ErrNotFound is returned when a note does not exist or belongs to another user.
+	ErrNotFound = errors.New("note not found")
+	// ErrVersionConflict is returned when a note changed since the caller last read it.
+	ErrVersionConflict = errors.New("note was modified by someone else")
 )
 
 type Service struct {
-	db *gorm.DB
+	db            *gorm.DB
+	keepRevisions int
+
+	// events receives note changes; nil disables them. While running in a
+	// transaction they are collected in pending until it commits.
+	events  *events.Bus
+	pending *[]events.Event
 }
 
-func NewService(db *gorm.DB) *Service {
+func NewService(db *gorm.DB, cfg *config.Config, bus *events.Bus) *Service {
 	return &Service{
-		db: db,
+		db:            db,
+		keepRevisions: cfg.NoteRevisionRetention,
+		events:        bus,
 	}
 }
 
-func (s *Service) GetByID(id int64) (Note, error) {
-	var n Note
-	err := s.db.First(&n, id).Error
-	if errors.Is(err, gorm.ErrRecordNotFound) {
-		return n, err
+// owned scopes a query to the notes of a single user.
+func owned(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("user_id = ?", userID)
 	}
-	return n, err
 }
 
-func (s *Service) Create(n Note) (Note, error) {
-	if err := s.db.Create(&n).Error; err != nil {
+// GetByID fetches a note the user owns or that was shared with them.
+func (s *Service) GetByID(userID uint, id int64) (Note, error) {
+	return s.authorize(userID, id, PermRead)
+}
+
+// Create stores a new note. Tags are given by name and created on demand.
+func (s *Service) Create(n Note, tags []string) (Note, error) {
+	if err := s.checkNotebook(n.UserID, n.NotebookID); err != nil {
 		return Note{}, err
 	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Tags").Create(&n).Error; err != nil {
+			return err
+		}
+		if err := replaceTags(tx, &n, tags); err != nil {
+			return err
+		}
+		if err := syncLinks(tx, n); err != nil {
+			return err
+		}
+		// the new title may be what dangling links were waiting for
+		if err := resolveTitles(tx, n.UserID, 0); err != nil {
+			return err
+		}
+		return s.recordRevision(tx, n.UserID, n)
+	})
+	if err != nil {
+		return Note{}, err
+	}
+
+	s.publish(events.NoteCreated, n)
 	return n, nil
 }
 
-func (s *Service) Update(id int64, data Note) (Note, error) {
-	var n Note
-	if err := s.db.First(&n, id).Error; err != nil {
+// Update overwrites the title and content of a note. A nil tags slice
+// leaves the note's tags untouched; an empty one clears them. When
+// data.Version is set the update only applies if the stored note still has
+// that version, otherwise ErrVersionConflict is returned. Users the note
+// is shared with need the edit permission.
+func (s *Service) Update(userID uint, id int64, data Note, tags []string) (Note, error) {
+	return s.update(userID, id, data, tags, State{}, false)
+}
+
+// UpdateRewritingLinks is Update, except that when the title changes the
+// [[Old Title]] links in other notes are changed to the new title, so that
+// they keep pointing at the note. Only notes the user may edit are changed.
+func (s *Service) UpdateRewritingLinks(userID uint, id int64, data Note, tags []string) (Note, error) {
+	return s.update(userID, id, data, tags, State{}, true)
+}
+
+func (s *Service) update(userID uint, id int64, data Note, tags []string, st State, rewriteLinks bool) (Note, error) {
+	old, err := s.authorize(userID, id, PermEdit)
+	if err != nil {
 		return Note{}, err
 	}
+	changes := stateChanges(old, st)
+	if len(changes) > 0 && old.UserID != userID {
+		return Note{}, ErrForbidden
+	}
+	changes["title"] = data.Title
+	changes["content"] = data.Content
+	changes["version"] = gorm.Expr("version + 1")
+
+	var n Note
+	var txs *Service
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		txs = s.withTx(tx)
+		q := tx.Model(&Note{}).Where("id = ?", id)
+		if data.Version > 0 {
+			q = q.Where("version = ?", data.Version)
+		}
 
-	n.Title = data.Title
-	n.Content = data.Content
+		res := q.Updates(changes)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
 
-	if err := s.db.Save(&n).Error; err != nil {
+		if err := tx.Preload("Tags").First(&n, id).Error; err != nil {
+			return err
+		}
+		if tags != nil {
+			if err := replaceTags(tx, &n, tags); err != nil {
+				return err
+			}
+		}
+		if err := syncLinks(tx, n); err != nil {
+			return err
+		}
+
+		if strings.EqualFold(old.Title, n.Title) {
+			if err := resolveTitles(tx, n.UserID, n.ID); err != nil {
+				return err
+			}
+		} else {
+			if rewriteLinks {
+				if err := txs.rewriteLinks(userID, n, old.Title, n.Title); err != nil {
+					return err
+				}
+			}
+			if err := resolveTitles(tx, n.UserID, 0); err != nil {
+				return err
+			}
+		}
+		return s.recordRevision(tx, userID, n)
+	})
+	if err != nil {
 		return Note{}, err
 	}
 
+	s.publish(events.NoteUpdated, n)
+	s.publishAll(*txs.pending)
 	return n, nil
 }
 
-func (s *Service) Delete(id int64) error {
-	if err := s.db.Delete(&Note{}, id).Error; err != nil {
+// Delete moves a note to the trash. Use DeletePermanently to remove it for good.
+// A non-zero version makes the delete conditional like in Update. Only
+// the owner can delete a note.
+func (s *Service) Delete(userID uint, id int64, version int64) error {
+	n, err := s.authorize(userID, id, permOwner)
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		q := tx.Scopes(owned(userID)).Where("id = ?", id)
+		if version > 0 {
+			q = q.Where("version = ?", version)
+		}
+
+		res := q.Delete(&Note{})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrVersionConflict
+		}
+		// links to the trashed note dangle, or find another with its title
+		return resolveTitles(tx, userID, 0)
+	})
+	if err != nil {
 		return err
 	}
+
+	s.publish(events.NoteDeleted, n)
 	return nil
 }
+
+// bumpVersion marks a note as changed for changes made outside Update.
+func bumpVersion(tx *gorm.DB, id int64) error {
+	return tx.Model(&Note{}).Where("id = ?", id).UpdateColumn("version", gorm.Expr("version + 1")).Error
+}
+
+// purgeNotes permanently removes notes together with their tag links,
+// revisions, shares, public links and the wiki links in them.
+// It also removes notes that are already in the trash.
+func purgeNotes(tx *gorm.DB, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	if err := tx.Exec("DELETE FROM note_tags WHERE note_id IN ?", ids).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN ?", ids).Delete(&Revision{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN ?", ids).Delete(&Share{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN ?", ids).Delete(&Comment{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("note_id IN ?", ids).Delete(&PublicLink{}).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("source_id IN ?", ids).Delete(&WikiLink{}).Error; err != nil {
+		return err
+	}
+	return tx.Unscoped().Where("id IN ?", ids).Delete(&Note{}).Error
+}
@@ -0,0 +1,225 @@
+package notes
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrForbidden is returned when a note is shared with the user but not
+	// with a permission that allows the operation.
+	ErrForbidden = errors.New("you do not have permission to do this")
+	// ErrShareNotFound is returned when a note is not shared with a user.
+	ErrShareNotFound = errors.New("share not found")
+	// ErrShareWithOwner is returned when a note is shared with its own owner.
+	ErrShareWithOwner = errors.New("cannot share a note with its owner")
+)
+
+// Permission is what a share lets the grantee do with a note. Each level
+// includes the ones before it.
+type Permission string
+
+const (
+	PermRead    Permission = "read"
+	PermComment Permission = "comment"
+	PermEdit    Permission = "edit"
+
+	// permOwner is never stored; it stands for the note's owner.
+	permOwner Permission = "owner"
+)
+
+var permRank = map[Permission]int{
+	PermRead:    1,
+	PermComment: 2,
+	PermEdit:    3,
+	permOwner:   4,
+}
+
+// Share grants another user access to a note.
+type Share struct {
+	ID         int64      `gorm:"primaryKey" json:"id"`
+	NoteID     int64      `gorm:"not null;uniqueIndex:idx_shares_note_user" json:"note_id"`
+	UserID     uint       `gorm:"not null;uniqueIndex:idx_shares_note_user;index" json:"user_id"`
+	Permission Permission `gorm:"not null" json:"permission"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+
+	// filled from the users table when listing the shares of a note
+	Email string `gorm:"->;-:migration" json:"email,omitempty"`
+	Name  string `gorm:"->;-:migration" json:"name,omitempty"`
+}
+
+// SharedNote is a note someone else shared with the user.
+type SharedNote struct {
+	Note
+	Permission Permission `json:"permission"`
+}
+
+// authorize loads a note the user may access with at least the need
+// permission. Users without any access get ErrNotFound so that they
+// cannot probe for note ids; grantees with too little access get
+// ErrForbidden.
+func (s *Service) authorize(userID uint, id int64, need Permission) (Note, error) {
+	var n Note
+	err := s.db.Preload("Tags").First(&n, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Note{}, ErrNotFound
+	}
+	if err != nil {
+		return Note{}, err
+	}
+
+	have := permOwner
+	if n.UserID != userID {
+		var sh Share
+		err := s.db.Where("note_id = ? AND user_id = ?", id, userID).First(&sh).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return Note{}, ErrNotFound
+		}
+		if err != nil {
+			return Note{}, err
+		}
+		have = sh.Permission
+	}
+
+	if permRank[have] < permRank[need] {
+		return Note{}, ErrForbidden
+	}
+	return n, nil
+}
+
+// CanEdit reports whether the user may change a note, either as its owner
+// or through an edit share. Users without any access get ErrNotFound.
+func (s *Service) CanEdit(userID uint, id int64) (bool, error) {
+	_, err := s.authorize(userID, id, PermEdit)
+	if errors.Is(err, ErrForbidden) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Share grants granteeID access to a note, or changes the permission of
+// an existing share. Only the owner can share a note.
+func (s *Service) Share(ownerID uint, noteID int64, granteeID uint, perm Permission) (Share, error) {
+	if _, err := s.authorize(ownerID, noteID, permOwner); err != nil {
+		return Share{}, err
+	}
+	if granteeID == ownerID {
+		return Share{}, ErrShareWithOwner
+	}
+
+	sh := Share{NoteID: noteID, UserID: granteeID, Permission: perm}
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "note_id"}, {Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"permission", "updated_at"}),
+	}).Create(&sh).Error
+	if err != nil {
+		return Share{}, err
+	}
+	return s.share(noteID, granteeID)
+}
+
+// Shares lists who a note is shared with. Only the owner can see them.
+func (s *Service) Shares(ownerID uint, noteID int64) ([]Share, error) {
+	if _, err := s.authorize(ownerID, noteID, permOwner); err != nil {
+		return nil, err
+	}
+
+	shares := []Share{}
+	err := s.sharesWithUsers().
+		Where("shares.note_id = ?", noteID).
+		Order("shares.created_at").
+		Find(&shares).Error
+	return shares, err
+}
+
+// Revoke removes granteeID's access to a note. The owner can revoke any
+// share and grantees can drop their own.
+func (s *Service) Revoke(userID uint, noteID int64, granteeID uint) error {
+	need := permOwner
+	if userID == granteeID {
+		need = PermRead
+	}
+	if _, err := s.authorize(userID, noteID, need); err != nil {
+		return err
+	}
+
+	res := s.db.Where("note_id = ? AND user_id = ?", noteID, granteeID).Delete(&Share{})
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrShareNotFound
+	}
+	return nil
+}
+
+// SharedWithMe lists the notes other users shared with userID, most
+// recently shared first. Trashed notes are left out.
+func (s *Service) SharedWithMe(userID uint, page, limit int) ([]SharedNote, int64, error) {
+	var total int64
+	shared := func() *gorm.DB {
+		return s.db.Model(&Share{}).
+			Joins("JOIN notes ON notes.id = shares.note_id AND notes.deleted_at IS NULL").
+			Where("shares.user_id = ?", userID)
+	}
+
+	if err := shared().Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	var shares []Share
+	err := shared().
+		Select("shares.*").
+		Order("shares.created_at DESC, shares.id DESC").
+		Limit(limit).
+		Offset((page - 1) * limit).
+		Find(&shares).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ids := make([]int64, len(shares))
+	for i, sh := range shares {
+		ids[i] = sh.NoteID
+	}
+
+	var list []Note
+	if len(ids) > 0 {
+		if err := s.db.Preload("Tags").Find(&list, ids).Error; err != nil {
+			return nil, 0, err
+		}
+	}
+	byID := make(map[int64]Note, len(list))
+	for _, n := range list {
+		byID[n.ID] = n
+	}
+
+	out := make([]SharedNote, 0, len(shares))
+	for _, sh := range shares {
+		if n, ok := byID[sh.NoteID]; ok {
+			out = append(out, SharedNote{Note: n, Permission: sh.Permission})
+		}
+	}
+	return out, total, nil
+}
+
+func (s *Service) share(noteID int64, userID uint) (Share, error) {
+	var sh Share
+	err := s.sharesWithUsers().
+		Where("shares.note_id = ? AND shares.user_id = ?", noteID, userID).
+		First(&sh).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return sh, ErrShareNotFound
+	}
+	return sh, err
+}
+
+func (s *Service) sharesWithUsers() *gorm.DB {
+	return s.db.Model(&Share{}).
+		Select("shares.*, users.email, users.name").
+		Joins("JOIN users ON users.id = shares.user_id")
+}
@@ -0,0 +1,154 @@
+package notes
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/pagination"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+var errUserNotFound = errors.New("no user with that email")
+
+type shareReq struct {
+	Email      string     `json:"email" binding:"required,email"`
+	Permission Permission `json:"permission" binding:"required,oneof=read comment edit"`
+}
+
+// shareError maps sharing service errors to responses.
+func shareError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrShareNotFound):
+		response.NotFound(c, err)
+	case errors.Is(err, ErrForbidden):
+		response.Forbidden(c, err)
+	case errors.Is(err, ErrShareWithOwner):
+		response.BadRequest(c, err)
+	default:
+		response.Internal(c, err)
+	}
+}
+
+// ListShares godoc
+// @Summary List note shares
+// @Description Get the users a note is shared with; owner only
+// @Tags sharing
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/shares [get]
+func (h *Handler) listShares(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	shares, err := h.svc.Shares(c.GetUint("userID"), id)
+	if err != nil {
+		shareError(c, err)
+		return
+	}
+	response.Success(c, "Shares retrieved successfully", shares)
+}
+
+// ShareNote godoc
+// @Summary Share note
+// @Description Share a note with another user by email, or change their permission
+// @Tags sharing
+// @Accept json
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param payload body shareReq true "Grantee and permission"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/shares [post]
+func (h *Handler) shareNote(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req shareReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	u, err := h.users.GetByEmail(strings.TrimSpace(req.Email))
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	if u.ID == 0 {
+		response.NotFound(c, errUserNotFound)
+		return
+	}
+
+	sh, err := h.svc.Share(c.GetUint("userID"), id, u.ID, req.Permission)
+	if err != nil {
+		shareError(c, err)
+		return
+	}
+	response.Success(c, "Note shared successfully", sh)
+}
+
+// RevokeShare godoc
+// @Summary Revoke share
+// @Description Remove a user's access to a note. Grantees may remove their own access.
+// @Tags sharing
+// @Param id path int true "Note ID"
+// @Param user path int true "Grantee user ID"
+// @Success 204
+// @Failure 403 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/shares/{user} [delete]
+func (h *Handler) revokeShare(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	grantee, ok := paramID(c, "user")
+	if !ok {
+		return
+	}
+
+	if err := h.svc.Revoke(c.GetUint("userID"), id, uint(grantee)); err != nil {
+		shareError(c, err)
+		return
+	}
+	response.NoContent(c)
+}
+
+// SharedWithMe godoc
+// @Summary Notes shared with me
+// @Description Get the notes other users shared with the caller, with the permission of each
+// @Tags sharing
+// @Produce json
+// @Param page query int false "Page number"
+// @Param limit query int false "Limit"
+// @Success 200 {object} response.ListResponse
+// @Security ApiKeyAuth
+// @Router /notes/shared [get]
+func (h *Handler) sharedWithMe(c *gin.Context) {
+	var page pagination.Pagination
+	if err := c.ShouldBindQuery(&page); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	page.Normalize()
+
+	items, total, err := h.svc.SharedWithMe(c.GetUint("userID"), page.Page, page.Limit)
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.List(c, items, page.Page, page.Limit, int(total))
+}
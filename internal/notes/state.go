@@ -0,0 +1,74 @@
+package notes
+
+import (
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/events"
+)
+
+// State changes the pinned and archived flags of a note. Nil fields are
+// left as they are.
+type State struct {
+	Pinned   *bool
+	Archived *bool
+}
+
+// unarchived hides archived notes unless include is set.
+func unarchived(include bool) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if include {
+			return db
+		}
+		return db.Where("notes.archived = ?", false)
+	}
+}
+
+// SetState pins, unpins, archives or unarchives a note. Only the owner
+// can change the state, but asking for the current one is not an error.
+func (s *Service) SetState(userID uint, id int64, st State) (Note, error) {
+	n, err := s.GetByID(userID, id)
+	if err != nil {
+		return Note{}, err
+	}
+
+	changes := stateChanges(n, st)
+	if len(changes) == 0 {
+		return n, nil
+	}
+	if n.UserID != userID {
+		return Note{}, ErrForbidden
+	}
+	changes["version"] = gorm.Expr("version + 1")
+
+	if err := s.db.Model(&n).Updates(changes).Error; err != nil {
+		return Note{}, err
+	}
+	if n, err = s.GetByID(userID, id); err != nil {
+		return Note{}, err
+	}
+
+	s.publish(events.NoteUpdated, n)
+	return n, nil
+}
+
+// Patch is Update that also sets the state, as one change to the note.
+// Like SetState, only the owner may change the state.
+func (s *Service) Patch(userID uint, id int64, data Note, tags []string, st State) (Note, error) {
+	return s.update(userID, id, data, tags, st, false)
+}
+
+// stateChanges returns the columns st changes in n.
+func stateChanges(n Note, st State) map[string]interface{} {
+	changes := map[string]interface{}{}
+	if st.Pinned != nil && *st.Pinned != n.Pinned {
+		changes["pinned"] = *st.Pinned
+	}
+	if st.Archived != nil && *st.Archived != n.Archived {
+		changes["archived"] = *st.Archived
+	}
+	return changes
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
@@ -0,0 +1,87 @@
+package notes
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/markdown"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+// PinNote godoc
+// @Summary Pin note
+// @Description Keep a note at the top of the list
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/pin [post]
+func (h *Handler) pin(c *gin.Context) {
+	h.setState(c, State{Pinned: boolPtr(true)}, "Note pinned successfully")
+}
+
+// UnpinNote godoc
+// @Summary Unpin note
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/pin [delete]
+func (h *Handler) unpin(c *gin.Context) {
+	h.setState(c, State{Pinned: boolPtr(false)}, "Note unpinned successfully")
+}
+
+// ArchiveNote godoc
+// @Summary Archive note
+// @Description Hide a note from the list without deleting it
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/archive [post]
+func (h *Handler) archive(c *gin.Context) {
+	h.setState(c, State{Archived: boolPtr(true)}, "Note archived successfully")
+}
+
+// UnarchiveNote godoc
+// @Summary Unarchive note
+// @Tags notes
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/archive [delete]
+func (h *Handler) unarchive(c *gin.Context) {
+	h.setState(c, State{Archived: boolPtr(false)}, "Note unarchived successfully")
+}
+
+func (h *Handler) setState(c *gin.Context, st State, msg string) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	n, err := h.svc.SetState(c.GetUint("userID"), id, st)
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+
+	c.Header("ETag", ETag(n, markdown.FormatMarkdown))
+	response.Success(c, msg, n)
+}
@@ -0,0 +1,158 @@
+package notes
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+func TestSetState(t *testing.T) {
+	svc := newTestService(t)
+	if err := svc.db.Create(&users.User{ID: bob, Name: "Bob", Email: "bob@example.com", Password: "x"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	n, err := svc.Create(Note{UserID: alice, Title: "Note", Content: "x"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = svc.SetState(alice, n.ID, State{Pinned: boolPtr(true), Archived: boolPtr(true)})
+	if err != nil || !n.Pinned || !n.Archived || n.Version != 2 {
+		t.Fatalf("got %+v, %v", n, err)
+	}
+	// asking for the current state changes nothing
+	if n, err = svc.SetState(alice, n.ID, State{Pinned: boolPtr(true)}); err != nil || n.Version != 2 {
+		t.Fatalf("got %+v, %v", n, err)
+	}
+	if n, err = svc.SetState(alice, n.ID, State{Archived: boolPtr(false)}); err != nil || !n.Pinned || n.Archived || n.Version != 3 {
+		t.Fatalf("got %+v, %v", n, err)
+	}
+
+	// an editor may look but not change the owner's state
+	if _, err := svc.Share(alice, n.ID, bob, PermEdit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.SetState(bob, n.ID, State{Pinned: boolPtr(true)}); err != nil {
+		t.Fatalf("editor asking for the current state: %v", err)
+	}
+	if _, err := svc.SetState(bob, n.ID, State{Pinned: boolPtr(false)}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("editor unpinning: %v", err)
+	}
+	if _, err := svc.SetState(alice, 999, State{Pinned: boolPtr(true)}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("missing note: %v", err)
+	}
+}
+
+func TestPinnedAndArchivedListing(t *testing.T) {
+	svc := newTestService(t)
+	r := gin.New()
+	NewHandler(svc, users.NewService(svc.db)).RegisterRoutes(r)
+	token, err := auth.GenerateToken(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	create := func(title string) int64 {
+		t.Helper()
+		n, err := svc.Create(Note{UserID: alice, Title: title, Content: "x"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n.ID
+	}
+	a, b, c, d := create("aaa"), create("bbb"), create("ccc"), create("ddd")
+
+	for _, req := range []struct {
+		method string
+		id     int64
+		path   string
+	}{
+		{http.MethodPost, c, "pin"},
+		{http.MethodPost, d, "archive"},
+		{http.MethodPost, d, "pin"},
+		{http.MethodPost, a, "pin"},
+		{http.MethodDelete, a, "pin"},
+	} {
+		rec := serve(r, token, req.method, fmt.Sprintf("/notes/%d/%s", req.id, req.path), "", "")
+		if rec.Code != http.StatusOK || rec.Header().Get("ETag") == "" {
+			t.Fatalf("%+v: got %d: %s", req, rec.Code, rec.Body)
+		}
+	}
+
+	list := func(query string) []int64 {
+		t.Helper()
+		rec := serve(r, token, http.MethodGet, "/notes/?sort=title"+query, "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("%s: got %d: %s", query, rec.Code, rec.Body)
+		}
+		var body struct {
+			Items []Note `json:"items"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+			t.Fatal(err)
+		}
+		var ids []int64
+		for _, n := range body.Items {
+			ids = append(ids, n.ID)
+		}
+		return ids
+	}
+	tests := []struct {
+		query string
+		want  []int64
+	}{
+		// pinned first, archived hidden
+		{"", []int64{c, a, b}},
+		{"&archived=true", []int64{c, d, a, b}},
+		{"&pinned=true", []int64{c}},
+		{"&pinned=false&archived=true", []int64{a, b}},
+	}
+	for _, tt := range tests {
+		if got := list(tt.query); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestPatchIsOneChange(t *testing.T) {
+	svc, sub := newBulkService(t)
+	if err := svc.db.Create(&users.User{ID: bob, Name: "Bob", Email: "bob@example.com", Password: "x"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	n, err := svc.Create(Note{UserID: alice, Title: "Note", Content: "x"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	drain(sub)
+
+	n, err = svc.Patch(alice, n.ID, Note{Title: "Note", Content: "y", Version: n.Version}, nil, State{Pinned: boolPtr(true), Archived: boolPtr(false)})
+	if err != nil || n.Content != "y" || !n.Pinned || n.Version != 2 {
+		t.Fatalf("got %+v, %v", n, err)
+	}
+	if got := drain(sub); !slices.Equal(got, []string{fmt.Sprintf("note.updated %d", n.ID)}) {
+		t.Fatalf("events %v", got)
+	}
+
+	// an editor may patch the content along with the current state, but
+	// not change the state
+	if _, err := svc.Share(alice, n.ID, bob, PermEdit); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Patch(bob, n.ID, Note{Title: "Note", Content: "z"}, nil, State{Pinned: boolPtr(false)}); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("editor unpinning: %v", err)
+	}
+	if after, _ := svc.GetByID(alice, n.ID); after.Content != "y" || after.Version != 2 {
+		t.Fatalf("forbidden patch changed %+v", after)
+	}
+	n, err = svc.Patch(bob, n.ID, Note{Title: "Note", Content: "z"}, nil, State{Pinned: boolPtr(true)})
+	if err != nil || n.Content != "z" || n.Version != 3 {
+		t.Fatalf("got %+v, %v", n, err)
+	}
+}
@@ -0,0 +1,232 @@
+package notes
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/events"
+)
+
+var (
+	// ErrTagNotFound is returned when a tag does not exist or belongs to another user.
+	ErrTagNotFound = errors.New("tag not found")
+	// ErrTagNameEmpty is returned for tag names that are blank once normalized.
+	ErrTagNameEmpty = errors.New("tag name must not be blank")
+)
+
+// Tag is a per-user label that can be attached to any number of notes.
+type Tag struct {
+	ID        int64     `gorm:"primaryKey" json:"id"`
+	UserID    uint      `gorm:"uniqueIndex:idx_tags_user_name;not null" json:"-"`
+	Name      string    `gorm:"uniqueIndex:idx_tags_user_name;not null" json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TagCount is a tag together with the number of notes carrying it.
+type TagCount struct {
+	Tag
+	Count int64 `json:"count"`
+}
+
+// NormalizeTag trims and lower-cases a tag name so "Work" and "work " match.
+func NormalizeTag(name string) string {
+	return strings.ToLower(strings.TrimSpace(name))
+}
+
+func normalizeTags(names []string) []string {
+	seen := make(map[string]bool, len(names))
+	out := make([]string, 0, len(names))
+	for _, name := range names {
+		name = NormalizeTag(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		out = append(out, name)
+	}
+	return out
+}
+
+// resolveTags returns the user's tags with the given names, creating any
+// that do not exist yet.
+func resolveTags(tx *gorm.DB, userID uint, names []string) ([]Tag, error) {
+	tags := make([]Tag, 0, len(names))
+	for _, name := range normalizeTags(names) {
+		t := Tag{UserID: userID, Name: name}
+		if err := tx.Where(Tag{UserID: userID, Name: name}).FirstOrCreate(&t).Error; err != nil {
+			return nil, err
+		}
+		tags = append(tags, t)
+	}
+	return tags, nil
+}
+
+// replaceTags makes names the complete tag set of n.
+func replaceTags(tx *gorm.DB, n *Note, names []string) error {
+	tags, err := resolveTags(tx, n.UserID, names)
+	if err != nil {
+		return err
+	}
+	if err := tx.Model(n).Association("Tags").Replace(tags); err != nil {
+		return err
+	}
+	n.Tags = tags
+	return nil
+}
+
+// tagged restricts a note query to notes carrying the given tags. With
+// matchAll the note needs every tag, otherwise any one of them.
+func tagged(userID uint, names []string, matchAll bool) func(*gorm.DB) *gorm.DB {
+	names = normalizeTags(names)
+	return func(db *gorm.DB) *gorm.DB {
+		if len(names) == 0 {
+			return db
+		}
+
+		need := 1
+		if matchAll {
+			need = len(names)
+		}
+
+		sub := db.Session(&gorm.Session{NewDB: true}).
+			Table("note_tags").
+			Select("note_tags.note_id").
+			Joins("JOIN tags ON tags.id = note_tags.tag_id").
+			Where("tags.user_id = ? AND tags.name IN ?", userID, names).
+			Group("note_tags.note_id").
+			Having("COUNT(DISTINCT tags.id) >= ?", need)
+
+		return db.Where("notes.id IN (?)", sub)
+	}
+}
+
+// Tags lists the user's tags with how many notes use each.
+func (s *Service) Tags(userID uint) ([]TagCount, error) {
+	out := []TagCount{}
+	err := s.db.Model(&Tag{}).
+		Select("tags.*, COUNT(notes.id) AS count").
+		Joins("LEFT JOIN note_tags ON note_tags.tag_id = tags.id").
+		Joins("LEFT JOIN notes ON notes.id = note_tags.note_id AND notes.deleted_at IS NULL").
+		Where("tags.user_id = ?", userID).
+		Group("tags.id").
+		Order("tags.name").
+		Scan(&out).Error
+	return out, err
+}
+
+func (s *Service) GetTag(userID uint, id int64) (Tag, error) {
+	var t Tag
+	err := s.db.Where("user_id = ?", userID).First(&t, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return t, ErrTagNotFound
+	}
+	return t, err
+}
+
+func (s *Service) CreateTag(userID uint, name string) (Tag, error) {
+	t := Tag{UserID: userID, Name: NormalizeTag(name)}
+	if t.Name == "" {
+		return Tag{}, ErrTagNameEmpty
+	}
+	if err := s.db.Create(&t).Error; err != nil {
+		return Tag{}, err
+	}
+	return t, nil
+}
+
+func (s *Service) RenameTag(userID uint, id int64, name string) (Tag, error) {
+	name = NormalizeTag(name)
+	if name == "" {
+		return Tag{}, ErrTagNameEmpty
+	}
+	t, err := s.GetTag(userID, id)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	t.Name = name
+	if err := s.db.Save(&t).Error; err != nil {
+		return Tag{}, err
+	}
+	return t, nil
+}
+
+// DeleteTag removes the tag from every note and then deletes it.
+func (s *Service) DeleteTag(userID uint, id int64) error {
+	t, err := s.GetTag(userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("DELETE FROM note_tags WHERE tag_id = ?", t.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&t).Error
+	})
+}
+
+// AttachTags adds tags to a note, creating them as needed.
+func (s *Service) AttachTags(userID uint, noteID int64, names []string) (Note, error) {
+	n, err := s.authorize(userID, noteID, PermEdit)
+	if err != nil {
+		return Note{}, err
+	}
+
+	// tags live in the owner's namespace, also when an editor adds them
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		tags, err := resolveTags(tx, n.UserID, names)
+		if err != nil {
+			return err
+		}
+		if err := tx.Model(&n).Association("Tags").Append(tags); err != nil {
+			return err
+		}
+		return bumpVersion(tx, n.ID)
+	})
+	if err != nil {
+		return Note{}, err
+	}
+
+	if n, err = s.GetByID(userID, noteID); err != nil {
+		return Note{}, err
+	}
+	s.publish(events.NoteUpdated, n)
+	return n, nil
+}
+
+// DetachTag removes a tag from a note. The tag itself is kept.
+func (s *Service) DetachTag(userID uint, noteID int64, name string) (Note, error) {
+	n, err := s.authorize(userID, noteID, PermEdit)
+	if err != nil {
+		return Note{}, err
+	}
+
+	var t Tag
+	err = s.db.Where("user_id = ? AND name = ?", n.UserID, NormalizeTag(name)).First(&t).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Note{}, ErrTagNotFound
+	}
+	if err != nil {
+		return Note{}, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&n).Association("Tags").Delete(&t); err != nil {
+			return err
+		}
+		return bumpVersion(tx, n.ID)
+	})
+	if err != nil {
+		return Note{}, err
+	}
+
+	if n, err = s.GetByID(userID, noteID); err != nil {
+		return Note{}, err
+	}
+	s.publish(events.NoteUpdated, n)
+	return n, nil
+}
@@ -0,0 +1,192 @@
+package notes
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+type tagReq struct {
+	Name string `json:"name" binding:"required,min=1,max=32"`
+}
+
+type tagsReq struct {
+	Tags []string `json:"tags" binding:"required,min=1,max=20,dive,min=1,max=32"`
+}
+
+// ListTags godoc
+// @Summary List tags
+// @Description Get the user's tags with note counts
+// @Tags tags
+// @Produce json
+// @Success 200 {object} response.SuccessResponse
+// @Security ApiKeyAuth
+// @Router /tags [get]
+func (h *Handler) listTags(c *gin.Context) {
+	tags, err := h.svc.Tags(c.GetUint("userID"))
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Tags retrieved successfully", tags)
+}
+
+// CreateTag godoc
+// @Summary Create tag
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param payload body tagReq true "Tag"
+// @Success 201 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /tags [post]
+func (h *Handler) createTag(c *gin.Context) {
+	var req tagReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	t, err := h.svc.CreateTag(c.GetUint("userID"), req.Name)
+	if err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	response.Created(c, "Tag created successfully", t)
+}
+
+// RenameTag godoc
+// @Summary Rename tag
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Tag ID"
+// @Param payload body tagReq true "Tag"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /tags/{id} [put]
+func (h *Handler) renameTag(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req tagReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	t, err := h.svc.RenameTag(c.GetUint("userID"), id, req.Name)
+	if errors.Is(err, ErrTagNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	response.Success(c, "Tag updated successfully", t)
+}
+
+// DeleteTag godoc
+// @Summary Delete tag
+// @Description Delete a tag and remove it from all notes
+// @Tags tags
+// @Param id path int true "Tag ID"
+// @Success 204
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /tags/{id} [delete]
+func (h *Handler) deleteTag(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	err := h.svc.DeleteTag(c.GetUint("userID"), id)
+	if errors.Is(err, ErrTagNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.NoContent(c)
+}
+
+// AttachTags godoc
+// @Summary Tag a note
+// @Description Attach tags to a note, creating missing tags
+// @Tags tags
+// @Accept json
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param payload body tagsReq true "Tag names"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/tags [post]
+func (h *Handler) attachTags(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req tagsReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	n, err := h.svc.AttachTags(c.GetUint("userID"), id, req.Tags)
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Tags attached successfully", n)
+}
+
+// DetachTag godoc
+// @Summary Untag a note
+// @Tags tags
+// @Produce json
+// @Param id path int true "Note ID"
+// @Param tag path string true "Tag name"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/tags/{tag} [delete]
+func (h *Handler) detachTag(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	n, err := h.svc.DetachTag(c.GetUint("userID"), id, c.Param("tag"))
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrTagNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if errors.Is(err, ErrForbidden) {
+		response.Forbidden(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Tag detached successfully", n)
+}
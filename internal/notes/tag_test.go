@@ -0,0 +1,176 @@
+package notes
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	tests := []struct {
+		in   []string
+		want []string
+	}{
+		{nil, []string{}},
+		{[]string{"Work", " work ", "WORK"}, []string{"work"}},
+		{[]string{"", "  ", "home"}, []string{"home"}},
+		{[]string{"b", "A", "b"}, []string{"b", "a"}},
+	}
+	for _, tt := range tests {
+		if got := normalizeTags(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func tagNames(n Note) []string {
+	var names []string
+	for _, t := range n.Tags {
+		names = append(names, t.Name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func TestTagFilter(t *testing.T) {
+	svc := newTestService(t)
+	create := func(tags ...string) int64 {
+		t.Helper()
+		n, err := svc.Create(Note{UserID: alice, Title: "Note", Content: "x"}, tags)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n.ID
+	}
+	both := create("Work", "urgent")
+	work := create("work")
+	urgent := create("urgent ")
+	create()
+
+	tests := []struct {
+		tags     []string
+		matchAll bool
+		want     []int64
+	}{
+		{[]string{"WORK"}, false, []int64{both, work}},
+		{[]string{"work", "urgent"}, false, []int64{both, work, urgent}},
+		{[]string{"work", "urgent"}, true, []int64{both}},
+		{[]string{"work", "missing"}, true, nil},
+		{[]string{"missing"}, false, nil},
+	}
+	for _, tt := range tests {
+		list, _, err := svc.Paginated(alice, Filter{Tags: tt.tags, MatchAllTags: tt.matchAll}, 1, 50)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []int64
+		for _, n := range list {
+			got = append(got, n.ID)
+		}
+		slices.Sort(got)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q all=%v: got %v, want %v", tt.tags, tt.matchAll, got, tt.want)
+		}
+	}
+}
+
+func TestTagLifecycle(t *testing.T) {
+	svc := newTestService(t)
+	n, err := svc.Create(Note{UserID: alice, Title: "Note", Content: "x"}, []string{"home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trashed, err := svc.Create(Note{UserID: alice, Title: "Old", Content: "x"}, []string{"home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.Delete(alice, trashed.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = svc.AttachTags(alice, n.ID, []string{"Garden", "home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tagNames(n); !slices.Equal(got, []string{"garden", "home"}) {
+		t.Fatalf("attached %v", got)
+	}
+
+	// counts leave out notes in the trash
+	tags, err := svc.Tags(alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tags) != 2 || tags[0].Name != "garden" || tags[0].Count != 1 || tags[1].Name != "home" || tags[1].Count != 1 {
+		t.Fatalf("tags %+v", tags)
+	}
+
+	renamed, err := svc.RenameTag(alice, tags[0].ID, " Yard ")
+	if err != nil || renamed.Name != "yard" {
+		t.Fatalf("renamed %+v, %v", renamed, err)
+	}
+	if _, err := svc.RenameTag(alice, renamed.ID, "HOME"); err == nil {
+		t.Fatal("renamed onto an existing tag")
+	}
+	if _, err := svc.CreateTag(alice, "home"); err == nil {
+		t.Fatal("created a duplicate tag")
+	}
+	if _, err := svc.CreateTag(alice, "   "); !errors.Is(err, ErrTagNameEmpty) {
+		t.Fatalf("created a blank tag: %v", err)
+	}
+	if _, err := svc.RenameTag(alice, renamed.ID, "\t"); !errors.Is(err, ErrTagNameEmpty) {
+		t.Fatalf("renamed to a blank tag: %v", err)
+	}
+	// names are per user
+	if _, err := svc.CreateTag(bob, "home"); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err = svc.DetachTag(alice, n.ID, "HOME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := tagNames(n); !slices.Equal(got, []string{"yard"}) {
+		t.Fatalf("after detach %v", got)
+	}
+	if _, err := svc.DetachTag(alice, n.ID, "missing"); !errors.Is(err, ErrTagNotFound) {
+		t.Fatalf("detach missing: %v", err)
+	}
+
+	if err := svc.DeleteTag(alice, renamed.ID); err != nil {
+		t.Fatal(err)
+	}
+	if n, err = svc.GetByID(alice, n.ID); err != nil || len(n.Tags) != 0 {
+		t.Fatalf("after delete %+v, %v", n.Tags, err)
+	}
+	if err := svc.DeleteTag(bob, tags[1].ID); !errors.Is(err, ErrTagNotFound) {
+		t.Fatalf("bob deleting alice's tag: %v", err)
+	}
+}
+
+func TestEditorTagsInOwnersNamespace(t *testing.T) {
+	svc := newTestService(t)
+	const editor uint = 3
+	if err := svc.db.Create(&users.User{ID: editor, Name: "Editor", Email: "editor@example.com", Password: "x"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	n, err := svc.Create(Note{UserID: alice, Title: "Shared", Content: "x"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Share(alice, n.ID, editor, PermEdit); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.AttachTags(editor, n.ID, []string{"review"}); err != nil {
+		t.Fatal(err)
+	}
+	if tags, _ := svc.Tags(alice); len(tags) != 1 || tags[0].Name != "review" {
+		t.Fatalf("alice has %+v", tags)
+	}
+	if tags, _ := svc.Tags(editor); len(tags) != 0 {
+		t.Fatalf("editor has %+v", tags)
+	}
+}
@@ -0,0 +1,144 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/events"
+)
+
+// trashed scopes a query to a user's notes that are in the trash.
+func trashed(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped().Where("user_id = ? AND deleted_at IS NOT NULL", userID)
+	}
+}
+
+// Trash lists the user's trashed notes, most recently deleted first.
+func (s *Service) Trash(userID uint, page, limit int) ([]Note, int64, error) {
+	notes := []Note{}
+	var total int64
+
+	if err := s.db.Model(&Note{}).Scopes(trashed(userID)).Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+
+	err := s.db.Scopes(trashed(userID)).
+		Preload("Tags").
+		Order("deleted_at DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&notes).Error
+
+	return notes, total, err
+}
+
+// Untrash restores a note from the trash.
+func (s *Service) Untrash(userID uint, id int64) (Note, error) {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&Note{}).Scopes(trashed(userID)).Where("id = ?", id).Update("deleted_at", nil)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return resolveTitles(tx, userID, 0)
+	})
+	if err != nil {
+		return Note{}, err
+	}
+
+	n, err := s.GetByID(userID, id)
+	if err != nil {
+		return Note{}, err
+	}
+
+	// to subscribers the note is back like a new one
+	s.publish(events.NoteCreated, n)
+	return n, nil
+}
+
+// DeletePermanently removes a trashed note for good.
+func (s *Service) DeletePermanently(userID uint, id int64) error {
+	var n Note
+	err := s.db.Scopes(trashed(userID)).Select("id").First(&n, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return purgeNotes(tx, []int64{n.ID})
+	})
+	if err != nil {
+		return err
+	}
+
+	s.publishPurged(userID, []int64{n.ID})
+	return nil
+}
+
+// EmptyTrash permanently removes all of the user's trashed notes.
+func (s *Service) EmptyTrash(userID uint) (int64, error) {
+	var ids []int64
+	if err := s.db.Model(&Note{}).Scopes(trashed(userID)).Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return purgeNotes(tx, ids)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	s.publishPurged(userID, ids)
+	return int64(len(ids)), nil
+}
+
+// PurgeTrash permanently removes notes of every user that were trashed before cutoff.
+func (s *Service) PurgeTrash(cutoff time.Time) (int64, error) {
+	var ids []int64
+	err := s.db.Unscoped().Model(&Note{}).
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", cutoff).
+		Pluck("id", &ids).Error
+	if err != nil {
+		return 0, err
+	}
+
+	err = s.db.Transaction(func(tx *gorm.DB) error {
+		return purgeNotes(tx, ids)
+	})
+	return int64(len(ids)), err
+}
+
+// RunPurger purges notes that have been in the trash longer than retention,
+// once per interval, until ctx is cancelled.
+func (s *Service) RunPurger(ctx context.Context, interval, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := s.PurgeTrash(time.Now().Add(-retention))
+		if err != nil {
+			log.Printf("[TRASH] purge failed: %v", err)
+		} else if n > 0 {
+			log.Printf("[TRASH] purged %d notes", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
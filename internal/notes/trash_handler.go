@@ -0,0 +1,106 @@
+package notes
+
+import (
+	"errors"
+
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/pagination"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+// ListTrash godoc
+// @Summary List trashed notes
+// @Description Get the user's deleted notes, most recently deleted first
+// @Tags trash
+// @Produce json
+// @Param page query int false "Page number"
+// @Param limit query int false "Limit"
+// @Success 200 {object} response.ListResponse
+// @Security ApiKeyAuth
+// @Router /notes/trash [get]
+func (h *Handler) listTrash(c *gin.Context) {
+	var page pagination.Pagination
+	if err := c.ShouldBindQuery(&page); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	page.Normalize()
+
+	items, total, err := h.svc.Trash(c.GetUint("userID"), page.Page, page.Limit)
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.List(c, items, page.Page, page.Limit, int(total))
+}
+
+// EmptyTrash godoc
+// @Summary Empty trash
+// @Description Permanently delete every trashed note
+// @Tags trash
+// @Produce json
+// @Success 200 {object} response.SuccessResponse
+// @Security ApiKeyAuth
+// @Router /notes/trash [delete]
+func (h *Handler) emptyTrash(c *gin.Context) {
+	n, err := h.svc.EmptyTrash(c.GetUint("userID"))
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Trash emptied successfully", gin.H{"deleted": n})
+}
+
+// RestoreNote godoc
+// @Summary Restore note from trash
+// @Tags trash
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/restore [post]
+func (h *Handler) untrash(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	n, err := h.svc.Untrash(c.GetUint("userID"), id)
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Note restored successfully", n)
+}
+
+// DeleteNotePermanently godoc
+// @Summary Permanently delete note
+// @Description Remove a trashed note for good
+// @Tags trash
+// @Param id path int true "Note ID"
+// @Success 204
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/permanent [delete]
+func (h *Handler) deletePermanently(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	err := h.svc.DeletePermanently(c.GetUint("userID"), id)
+	if errors.Is(err, ErrNotFound) {
+		response.NotFound(c, err)
+		return
+	}
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.NoContent(c)
+}
@@ -0,0 +1,161 @@
+package notes
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTrashLifecycle(t *testing.T) {
+	svc := newTestService(t)
+	n, err := svc.Create(Note{UserID: alice, Title: "Note", Content: "x"}, []string{"home"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeletePermanently(alice, n.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("purged a note outside the trash: %v", err)
+	}
+
+	if err := svc.Delete(alice, n.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.GetByID(alice, n.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("trashed note still readable: %v", err)
+	}
+	if trash, total, err := svc.Trash(alice, 1, 10); err != nil || total != 1 || trash[0].ID != n.ID {
+		t.Fatalf("trash %+v, %v", trash, err)
+	}
+	if _, total, _ := svc.Trash(bob, 1, 10); total != 0 {
+		t.Fatalf("bob sees %d trashed notes", total)
+	}
+	if _, err := svc.Untrash(bob, n.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("bob untrashing: %v", err)
+	}
+
+	restored, err := svc.Untrash(alice, n.ID)
+	if err != nil || len(restored.Tags) != 1 {
+		t.Fatalf("restored %+v, %v", restored, err)
+	}
+	if _, err := svc.Untrash(alice, n.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("untrashed twice: %v", err)
+	}
+
+	if err := svc.Delete(alice, n.ID, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.DeletePermanently(bob, n.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("bob purging: %v", err)
+	}
+	if err := svc.DeletePermanently(alice, n.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Untrash(alice, n.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("untrashed a purged note: %v", err)
+	}
+}
+
+func TestEmptyTrash(t *testing.T) {
+	svc := newTestService(t)
+	for _, user := range []uint{alice, alice, bob} {
+		n, err := svc.Create(Note{UserID: user, Title: "Note", Content: "x"}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := svc.Delete(user, n.ID, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := svc.Create(Note{UserID: alice, Title: "Live", Content: "x"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := svc.EmptyTrash(alice); err != nil || n != 2 {
+		t.Fatalf("emptied %d, %v", n, err)
+	}
+	if _, total, _ := svc.Trash(bob, 1, 10); total != 1 {
+		t.Fatalf("bob's trash has %d notes", total)
+	}
+	if _, total, _ := svc.Paginated(alice, Filter{}, 1, 10); total != 1 {
+		t.Fatalf("alice has %d live notes", total)
+	}
+}
+
+// trashAt moves a new note of user to the trash at the given time.
+func trashAt(t *testing.T, svc *Service, user uint, at time.Time) int64 {
+	t.Helper()
+	n, err := svc.Create(Note{UserID: user, Title: "Note", Content: "x"}, []string{"tag"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.db.Unscoped().Model(&Note{}).Where("id = ?", n.ID).Update("deleted_at", at).Error; err != nil {
+		t.Fatal(err)
+	}
+	return n.ID
+}
+
+func TestPurgeTrash(t *testing.T) {
+	svc := newTestService(t)
+	now := time.Now()
+	old := trashAt(t, svc, alice, now.Add(-48*time.Hour))
+	oldBob := trashAt(t, svc, bob, now.Add(-25*time.Hour))
+	recent := trashAt(t, svc, alice, now.Add(-time.Hour))
+	live, err := svc.Create(Note{UserID: alice, Title: "Live", Content: "x"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n, err := svc.PurgeTrash(now.Add(-24 * time.Hour)); err != nil || n != 2 {
+		t.Fatalf("purged %d, %v", n, err)
+	}
+
+	var left []int64
+	svc.db.Unscoped().Model(&Note{}).Order("id").Pluck("id", &left)
+	if len(left) != 2 || left[0] != recent || left[1] != live.ID {
+		t.Fatalf("left %v", left)
+	}
+	// their revisions and tag links went with them
+	var revs, links int64
+	svc.db.Model(&Revision{}).Where("note_id IN ?", []int64{old, oldBob}).Count(&revs)
+	svc.db.Table("note_tags").Where("note_id IN ?", []int64{old, oldBob}).Count(&links)
+	if revs != 0 || links != 0 {
+		t.Fatalf("%d revisions and %d tag links left", revs, links)
+	}
+
+	if n, err := svc.PurgeTrash(now.Add(-24 * time.Hour)); err != nil || n != 0 {
+		t.Fatalf("purged again %d, %v", n, err)
+	}
+}
+
+func TestRunPurger(t *testing.T) {
+	svc := newTestService(t)
+	old := trashAt(t, svc, alice, time.Now().Add(-2*time.Hour))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		svc.RunPurger(ctx, time.Hour, time.Hour)
+		close(done)
+	}()
+
+	// the first run happens right away, not after an interval
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		var count int64
+		svc.db.Unscoped().Model(&Note{}).Where("id = ?", old).Count(&count)
+		if count == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("note was not purged")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("purger did not stop")
+	}
+}
@@ -0,0 +1,217 @@
+package notes
+
+import (
+	"errors"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/events"
+	"github.com/tmsankram/gonotes/internal/markdown"
+)
+
+// LinkKind tells how a wiki link names its target.
+type LinkKind string
+
+const (
+	// LinkTitle is a [[Note Title]] link. It resolves to the owner's note
+	// with that title, compared case-insensitively; the oldest wins.
+	LinkTitle LinkKind = "title"
+	// LinkID is an [[id:123]] link to a note by id.
+	LinkID LinkKind = "id"
+)
+
+// WikiLink is a reference from one note's content to another note. Links
+// are derived from the content whenever a note is saved.
+type WikiLink struct {
+	ID       int64 `gorm:"primaryKey" json:"-"`
+	SourceID int64 `gorm:"not null;index" json:"source_id"`
+	// TargetID is nil while a title link names no note.
+	TargetID *int64   `gorm:"index" json:"target_id"`
+	Kind     LinkKind `gorm:"not null" json:"kind"`
+	// Target is the title or id as written in the content.
+	Target string `gorm:"not null" json:"target"`
+}
+
+// OutLink is a wiki link of a note as seen by the user listing them.
+type OutLink struct {
+	Kind   LinkKind `json:"kind"`
+	Target string   `json:"target"`
+	// NoteID and Title are only set when the user can read the target.
+	NoteID *int64 `json:"note_id"`
+	Title  string `json:"title,omitempty"`
+	// Dangling links point at no note, at one in the trash or at one the
+	// user cannot read; the last is not told apart from the others.
+	Dangling bool `json:"dangling"`
+
+	Readable bool `json:"-"`
+}
+
+// readable scopes a query to the notes the user owns or that were shared
+// with them.
+func readable(userID uint) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where("(notes.user_id = ? OR EXISTS (SELECT 1 FROM shares WHERE shares.note_id = notes.id AND shares.user_id = ?))", userID, userID)
+	}
+}
+
+// syncLinks replaces the stored links of n with the ones in its content.
+func syncLinks(tx *gorm.DB, n Note) error {
+	if err := tx.Where("source_id = ?", n.ID).Delete(&WikiLink{}).Error; err != nil {
+		return err
+	}
+
+	var links []WikiLink
+	for _, l := range markdown.FindWikiLinks(n.Content) {
+		if l.ID != 0 {
+			id := l.ID
+			links = append(links, WikiLink{SourceID: n.ID, TargetID: &id, Kind: LinkID, Target: "id:" + strconv.FormatInt(id, 10)})
+		} else {
+			links = append(links, WikiLink{SourceID: n.ID, Kind: LinkTitle, Target: l.Title})
+		}
+	}
+	if len(links) == 0 {
+		return nil
+	}
+	return tx.Create(&links).Error
+}
+
+// resolveTitles points the title links in the user's notes at the notes
+// they name. A non-zero sourceID limits it to the links of that note;
+// otherwise all of them are resolved again, as needed after a note was
+// renamed, created, trashed or restored.
+func resolveTitles(tx *gorm.DB, userID uint, sourceID int64) error {
+	q := `UPDATE wiki_links SET target_id = (
+		SELECT t.id FROM notes t
+		WHERE t.user_id = ? AND t.deleted_at IS NULL AND LOWER(t.title) = LOWER(wiki_links.target)
+		ORDER BY t.id LIMIT 1
+	) WHERE kind = ?`
+	args := []interface{}{userID, LinkTitle}
+	if sourceID != 0 {
+		q += " AND source_id = ?"
+		args = append(args, sourceID)
+	} else {
+		q += " AND source_id IN (SELECT id FROM notes WHERE user_id = ?)"
+		args = append(args, userID)
+	}
+	return tx.Exec(q, args...).Error
+}
+
+// rewriteLinks changes the [[from]] links pointing at n into [[to]] in the
+// notes that reference it and userID may edit. It runs before the title
+// links are resolved again, while they still point at n.
+func (s *Service) rewriteLinks(userID uint, n Note, from, to string) error {
+	var sources []Note
+	err := s.db.Preload("Tags").
+		Where("id IN (SELECT source_id FROM wiki_links WHERE kind = ? AND target_id = ?) AND id <> ?", LinkTitle, n.ID, n.ID).
+		Find(&sources).Error
+	if err != nil {
+		return err
+	}
+
+	for _, src := range sources {
+		if _, err := s.authorize(userID, src.ID, PermEdit); err != nil {
+			if errors.Is(err, ErrForbidden) || errors.Is(err, ErrNotFound) {
+				continue
+			}
+			return err
+		}
+
+		content, changed := markdown.ReplaceWikiTitle(src.Content, from, to)
+		if !changed {
+			continue
+		}
+		err := s.db.Model(&Note{}).Where("id = ?", src.ID).Updates(map[string]interface{}{
+			"content": content,
+			"version": gorm.Expr("version + 1"),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		src.Content = content
+		src.Version++
+		if err := syncLinks(s.db, src); err != nil {
+			return err
+		}
+		if err := s.recordRevision(s.db, userID, src); err != nil {
+			return err
+		}
+		s.publish(events.NoteUpdated, src)
+	}
+	return nil
+}
+
+// OutLinks lists the wiki links in a note the user can read, in the order
+// they appear. Targets the user cannot read are not revealed.
+func (s *Service) OutLinks(userID uint, id int64) ([]OutLink, error) {
+	if _, err := s.authorize(userID, id, PermRead); err != nil {
+		return nil, err
+	}
+
+	links := []OutLink{}
+	err := s.db.Table("wiki_links").
+		Select(`wiki_links.kind, wiki_links.target, t.id AS note_id, t.title,
+			t.id IS NULL AS dangling,
+			(COALESCE(t.user_id = ?, FALSE) OR EXISTS (SELECT 1 FROM shares WHERE shares.note_id = t.id AND shares.user_id = ?)) AS readable`,
+			userID, userID).
+		Joins("LEFT JOIN notes t ON t.id = wiki_links.target_id AND t.deleted_at IS NULL").
+		Where("wiki_links.source_id = ?", id).
+		Order("wiki_links.id").
+		Scan(&links).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range links {
+		if !links[i].Readable {
+			links[i].NoteID = nil
+			links[i].Title = ""
+			links[i].Dangling = true
+		}
+	}
+	return links, nil
+}
+
+// Backlinks lists the notes linking to a note that the user can read,
+// most recently updated first.
+func (s *Service) Backlinks(userID uint, id int64) ([]Note, error) {
+	if _, err := s.authorize(userID, id, PermRead); err != nil {
+		return nil, err
+	}
+
+	notes := []Note{}
+	err := s.db.Scopes(readable(userID)).
+		Preload("Tags").
+		Where("notes.id IN (SELECT source_id FROM wiki_links WHERE target_id = ?) AND notes.id <> ?", id, id).
+		Order("notes.updated_at DESC").
+		Find(&notes).Error
+	return notes, err
+}
+
+// ResolveLink finds the note a wiki link in note sourceID points at.
+// Title links are looked up among the notes of the source's owner. The
+// user needs to be able to read both notes.
+func (s *Service) ResolveLink(userID uint, sourceID int64, l markdown.WikiLink) (Note, error) {
+	src, err := s.authorize(userID, sourceID, PermRead)
+	if err != nil {
+		return Note{}, err
+	}
+	if l.ID != 0 {
+		return s.GetByID(userID, l.ID)
+	}
+
+	var n Note
+	err = s.db.Scopes(owned(src.UserID)).
+		Select("id").
+		Where("LOWER(title) = LOWER(?)", l.Title).
+		Order("id").
+		First(&n).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Note{}, ErrNotFound
+	}
+	if err != nil {
+		return Note{}, err
+	}
+	return s.GetByID(userID, n.ID)
+}
@@ -0,0 +1,54 @@
+package notes
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+// ListOutLinks godoc
+// @Summary List wiki links
+// @Description Get the [[Note Title]] and [[id:123]] links in a note, with the note each resolves to. Dangling links point at no note or a trashed one.
+// @Tags links
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/links [get]
+func (h *Handler) outLinks(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	links, err := h.svc.OutLinks(c.GetUint("userID"), id)
+	if err != nil {
+		shareError(c, err)
+		return
+	}
+	response.Success(c, "Links retrieved successfully", links)
+}
+
+// ListBacklinks godoc
+// @Summary List backlinks
+// @Description Get the notes whose wiki links point at a note, limited to the ones the caller can read
+// @Tags links
+// @Produce json
+// @Param id path int true "Note ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /notes/{id}/backlinks [get]
+func (h *Handler) backlinks(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	notes, err := h.svc.Backlinks(c.GetUint("userID"), id)
+	if err != nil {
+		shareError(c, err)
+		return
+	}
+	response.Success(c, "Backlinks retrieved successfully", notes)
+}
@@ -0,0 +1,56 @@
+package notes
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+func TestOutLinksHideUnreadableTargets(t *testing.T) {
+	svc := newTestService(t)
+	private, err := svc.Create(Note{UserID: alice, Title: "Diary", Content: "Private"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := svc.Create(Note{UserID: bob, Title: "Probe", Content: fmt.Sprintf("See [[id:%d]]", private.ID)}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	NewHandler(svc, users.NewService(svc.db)).RegisterRoutes(r)
+	token, err := auth.GenerateToken(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	links := func() string {
+		t.Helper()
+		rec := serve(r, token, http.MethodGet, fmt.Sprintf("/notes/%d/links", n.ID), "", "")
+		if rec.Code != http.StatusOK {
+			t.Fatalf("got %d: %s", rec.Code, rec.Body)
+		}
+		return rec.Body.String()
+	}
+
+	exists := links()
+	// once alice's note is gone for good the id points at nothing
+	if err := svc.db.Unscoped().Delete(&Note{}, private.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if missing := links(); exists != missing {
+		t.Fatalf("an existing note of alice's is told apart from a missing one:\n%s\n%s", exists, missing)
+	}
+
+	got, err := svc.OutLinks(bob, n.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].NoteID != nil || got[0].Title != "" || !got[0].Dangling {
+		t.Fatalf("got %+v", got)
+	}
+}
@@ -0,0 +1,98 @@
+package pagination
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"time"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a list ordered by (Group, Time, ID)
+// descending. Group lets a list float some items above the rest, such as
+// pinned notes. Clients only ever see it in its encoded, opaque form.
+type Cursor struct {
+	Group int       `json:"g,omitempty"`
+	Time  time.Time `json:"t"`
+	ID    string    `json:"id"`
+}
+
+func (c Cursor) Encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// String encodes c, or returns "" for a nil cursor.
+func (c *Cursor) String() string {
+	if c == nil {
+		return ""
+	}
+	return c.Encode()
+}
+
+// DecodeCursor parses an encoded cursor. Anything Encode could not have
+// produced, like unknown fields or a missing time, is rejected.
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&c); err != nil || dec.More() || c.ID == "" || c.Time.IsZero() {
+		return Cursor{}, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// Keyset holds the cursor query parameters of a list request.
+type Keyset struct {
+	After  string `form:"after"`
+	Before string `form:"before"`
+	Limit  int    `form:"limit" binding:"omitempty,min=1,max=100"`
+}
+
+// CursorRequested reports whether a request asked for cursor pagination.
+// An empty after= starts from the first page.
+func CursorRequested(q url.Values) bool {
+	return q.Has("after") || q.Has("before")
+}
+
+func (k *Keyset) Normalize() {
+	if k.Limit == 0 {
+		k.Limit = 10
+	}
+}
+
+// Decode parses the after/before cursors. At most one of them may be set.
+func (k *Keyset) Decode() (after, before *Cursor, err error) {
+	if k.After != "" && k.Before != "" {
+		return nil, nil, errors.New("after and before cannot be combined")
+	}
+	if k.After != "" {
+		c, err := DecodeCursor(k.After)
+		if err != nil {
+			return nil, nil, err
+		}
+		after = &c
+	}
+	if k.Before != "" {
+		c, err := DecodeCursor(k.Before)
+		if err != nil {
+			return nil, nil, err
+		}
+		before = &c
+	}
+	return after, before, nil
+}
+
+// Page is one window of a cursor-paginated list.
+type Page[T any] struct {
+	Items []T
+	Next  *Cursor
+	Prev  *Cursor
+}
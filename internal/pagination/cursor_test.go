@@ -0,0 +1,77 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	at := time.Date(2026, 3, 14, 15, 9, 26, 535897932, time.FixedZone("CET", 3600))
+	for _, c := range []Cursor{
+		{Time: at, ID: "42"},
+		{Group: 1, Time: at.UTC(), ID: "0b5e0c9e-1b8a-4c42-9d6e-0a4f1b2c3d4e"},
+	} {
+		got, err := DecodeCursor(c.Encode())
+		if err != nil {
+			t.Fatalf("%+v: %v", c, err)
+		}
+		if got.Group != c.Group || got.ID != c.ID || !got.Time.Equal(c.Time) {
+			t.Fatalf("got %+v, want %+v", got, c)
+		}
+	}
+
+	var none *Cursor
+	if none.String() != "" {
+		t.Fatalf("nil cursor encodes to %q", none.String())
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	valid := Cursor{Group: 1, Time: time.Now(), ID: "42"}.Encode()
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := map[string]string{
+		"empty":          "",
+		"not base64":     "not a cursor!",
+		"padded base64":  base64.URLEncoding.EncodeToString([]byte(`{"t":"2026-01-01T00:00:00Z","id":"1"}`)),
+		"truncated":      valid[:len(valid)-4],
+		"changed byte":   "A" + valid[1:],
+		"not json":       raw("42"),
+		"no id":          raw(`{"t":"2026-01-01T00:00:00Z"}`),
+		"no time":        raw(`{"g":1,"id":"42"}`),
+		"bad time":       raw(`{"t":"yesterday","id":"42"}`),
+		"unknown field":  raw(`{"t":"2026-01-01T00:00:00Z","id":"42","user":7}`),
+		"trailing value": raw(`{"t":"2026-01-01T00:00:00Z","id":"42"} {"id":"43"}`),
+	}
+	for name, s := range tests {
+		t.Run(name, func(t *testing.T) {
+			if c, err := DecodeCursor(s); !errors.Is(err, ErrInvalidCursor) {
+				t.Fatalf("got %+v, %v", c, err)
+			}
+		})
+	}
+}
+
+func TestKeysetDecode(t *testing.T) {
+	c := Cursor{Time: time.Now(), ID: "7"}.Encode()
+
+	after, before, err := (&Keyset{After: c}).Decode()
+	if err != nil || after == nil || after.ID != "7" || before != nil {
+		t.Fatalf("after: %v %v %v", after, before, err)
+	}
+	after, before, err = (&Keyset{Before: c}).Decode()
+	if err != nil || before == nil || after != nil {
+		t.Fatalf("before: %v %v %v", after, before, err)
+	}
+	if _, _, err := (&Keyset{After: c, Before: c}).Decode(); err == nil {
+		t.Fatal("after and before combined")
+	}
+	if _, _, err := (&Keyset{Before: "garbage"}).Decode(); !errors.Is(err, ErrInvalidCursor) {
+		t.Fatalf("garbage: %v", err)
+	}
+	if after, before, err := (&Keyset{}).Decode(); after != nil || before != nil || err != nil {
+		t.Fatalf("none: %v %v %v", after, before, err)
+	}
+}
@@ -1,8 +1,8 @@
 package pagination
 
 type Pagination struct {
-	Page  int `form:"page" binding:"min=1"`
-	Limit int `form:"limit" binding:"min=1,max=100"`
+	Page  int `form:"page" binding:"omitempty,min=1"`
+	Limit int `form:"limit" binding:"omitempty,min=1,max=100"`
 }
 
 func (p *Pagination) Normalize() {
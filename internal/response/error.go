@@ -47,3 +47,33 @@ func Forbidden(c *gin.Context, err error) {
 		Error: err.Error(),
 	})
 }
+
+func Conflict(c *gin.Context, err error) {
+	c.JSON(http.StatusConflict, ErrorResponse{
+		Error: err.Error(),
+	})
+}
+
+func PreconditionFailed(c *gin.Context, err error) {
+	c.JSON(http.StatusPreconditionFailed, ErrorResponse{
+		Error: err.Error(),
+	})
+}
+
+func RequestEntityTooLarge(c *gin.Context, err error) {
+	c.JSON(http.StatusRequestEntityTooLarge, ErrorResponse{
+		Error: err.Error(),
+	})
+}
+
+func UnsupportedMediaType(c *gin.Context, err error) {
+	c.JSON(http.StatusUnsupportedMediaType, ErrorResponse{
+		Error: err.Error(),
+	})
+}
+
+func NotImplemented(c *gin.Context, err error) {
+	c.JSON(http.StatusNotImplemented, ErrorResponse{
+		Error: err.Error(),
+	})
+}
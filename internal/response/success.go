@@ -12,9 +12,13 @@ type SuccessResponse struct {
 }
 type ListResponse struct {
 	Items interface{} `json:"items"`
-	Page  int         `json:"page"`
+	Page  int         `json:"page,omitempty"`
 	Limit int         `json:"limit"`
-	Total int         `json:"total"`
+	Total *int        `json:"total,omitempty"`
+
+	// set instead of Page/Total when the list is cursor paginated
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
 }
 
 func Success(c *gin.Context, message string, details interface{}) {
@@ -46,6 +50,17 @@ func List(c *gin.Context, items interface{}, page, limit, total int) {
 		Items: items,
 		Page:  page,
 		Limit: limit,
-		Total: total,
+		Total: &total,
+	})
+}
+
+// CursorList writes a cursor paginated list. Empty cursors mean there is
+// no further page in that direction.
+func CursorList(c *gin.Context, items interface{}, limit int, next, prev string) {
+	c.JSON(http.StatusOK, ListResponse{
+		Items:      items,
+		Limit:      limit,
+		NextCursor: next,
+		PrevCursor: prev,
 	})
 }
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"context"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -9,23 +11,35 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/collab"
 	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/events"
 	"github.com/tmsankram/gonotes/internal/files"
 	"github.com/tmsankram/gonotes/internal/middleware"
 	"github.com/tmsankram/gonotes/internal/notes"
+	"github.com/tmsankram/gonotes/internal/storage"
 	"github.com/tmsankram/gonotes/internal/ui"
 	"github.com/tmsankram/gonotes/internal/users"
 	myval "github.com/tmsankram/gonotes/internal/validator"
+	"github.com/tmsankram/gonotes/internal/webhooks"
 
 	swaggerFiles "github.com/swaggo/files"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	_ "github.com/tmsankram/gonotes/docs" // IMPORTANT: docs generated by swag init
 )
 
-func New(db *gorm.DB) *gin.Engine {
+// eventReplaySize is how many events /events keeps for clients that
+// reconnect.
+const eventReplaySize = 1000
+
+// New builds the HTTP router. Background work such as webhook delivery
+// runs until ctx is cancelled.
+func New(ctx context.Context, db *gorm.DB) *gin.Engine {
 	cfg := config.Load()
 	app := newApplication(db, cfg)
 
+	go webhooks.NewDispatcher(app.services.webhooks, app.events).Run(ctx)
+
 	app.registerCustomValidators()
 	app.registerGlobalMiddleware()
 	app.router.Static("/static", "./ui/static")
@@ -41,26 +55,36 @@ type application struct {
 	router   *gin.Engine
 	cfg      *config.Config
 	renderer *ui.Renderer
+	events   *events.Bus
 	services serviceContainer
 }
 
 type serviceContainer struct {
-	notes *notes.Service
-	users *users.Service
-	files *files.Service
+	notes    *notes.Service
+	users    *users.Service
+	files    *files.Service
+	webhooks *webhooks.Service
 }
 
 func newApplication(db *gorm.DB, cfg *config.Config) *application {
 	renderer := ui.NewRenderer(ui.LoadTemplates())
+	bus := events.NewBus(eventReplaySize)
+
+	blobs, err := storage.Open(context.Background(), cfg, cfg.BlobBackend)
+	if err != nil {
+		log.Fatalf("Opening blob store failed: %v", err)
+	}
 
 	return &application{
 		router:   gin.New(),
 		cfg:      cfg,
 		renderer: renderer,
+		events:   bus,
 		services: serviceContainer{
-			notes: notes.NewService(db),
-			users: users.NewService(db),
-			files: files.NewService(),
+			notes:    notes.NewService(db, cfg, bus),
+			users:    users.NewService(db),
+			files:    files.NewService(db, cfg, blobs, bus),
+			webhooks: webhooks.NewService(db, cfg),
 		},
 	}
 }
@@ -96,8 +120,15 @@ func (a *application) registerUtilityRoutes() {
 }
 
 func (a *application) registerAPIRoutes() {
-	notes.NewHandler(a.services.notes).RegisterRoutes(a.router)
-	files.NewHandler(a.services.files).RegisterRoutes(a.router)
+	notes.NewHandler(a.services.notes, a.services.users).RegisterRoutes(a.router)
+	files.NewHandler(a.services.files, a.cfg).RegisterRoutes(a.router)
+	webhooks.NewHandler(a.services.webhooks).RegisterRoutes(a.router)
+
+	// live editing, for API clients and the browser session alike
+	collabHandler := collab.NewHandler(collab.NewHub(a.services.notes, a.services.users))
+	a.router.GET("/notes/:id/ws", ui.RequireUser(), collabHandler.Connect)
+
+	a.router.GET("/events", ui.RequireUser(), events.NewHandler(a.events).Stream)
 
 	authHandler := auth.NewHandler(a.services.users)
 	authHandler.RegisterPublicRoutes(a.router)
@@ -114,7 +145,8 @@ func (a *application) registerAPIRoutes() {
 
 func (a *application) registerUIRoutes() {
 	authUI := ui.NewAuthUI(a.services.users, a.renderer)
-	notesUI := ui.NewNotesUI(a.services.notes, a.renderer)
+	notesUI := ui.NewNotesUI(a.services.notes, a.services.users, a.renderer)
+	publicUI := ui.NewPublicUI(a.services.notes, a.renderer)
 
 	a.router.GET("/login", authUI.LoginPage)
 	a.router.POST("/login", authUI.LoginPost)
@@ -123,13 +155,34 @@ func (a *application) registerUIRoutes() {
 
 	a.router.GET("/logout", a.logout)
 
+	// public read-only links, no login
+	a.router.GET("/p/:token", publicUI.View)
+	a.router.POST("/p/:token", publicUI.Unlock)
+
 	// notes UI
-	a.router.GET("/notes", notesUI.NotesPage)
-	a.router.GET("/notes/create-form", notesUI.CreateForm)
-	a.router.POST("/notes/create", notesUI.CreatePost)
-	a.router.GET("/notes/:id/edit", notesUI.EditForm)
-	a.router.POST("/notes/:id/edit", notesUI.EditPost)
-	a.router.DELETE("/notes/:id/delete", notesUI.Delete)
+	notesPages := a.router.Group("/notes")
+	notesPages.Use(ui.RequireLogin())
+	notesPages.GET("", notesUI.NotesPage)
+	notesPages.GET("/search", notesUI.Search)
+	notesPages.GET("/page", notesUI.NextPage)
+	notesPages.GET("/shared-with-me", notesUI.SharedWithMe)
+	notesPages.GET("/create-form", notesUI.CreateForm)
+	notesPages.POST("/create", notesUI.CreatePost)
+	notesPages.POST("/preview", notesUI.Preview)
+	notesPages.POST("/bulk-action", notesUI.BulkAction)
+	notesPages.GET("/:id/edit", notesUI.EditForm)
+	notesPages.POST("/:id/edit", notesUI.EditPost)
+	notesPages.POST("/:id/toggle-pin", notesUI.TogglePin)
+	notesPages.POST("/:id/toggle-archive", notesUI.ToggleArchive)
+	notesPages.GET("/:id/wiki", notesUI.FollowLink)
+	notesPages.GET("/:id/links-panel", notesUI.LinksPanel)
+	notesPages.GET("/:id/share-dialog", notesUI.ShareDialog)
+	notesPages.POST("/:id/share", notesUI.SharePost)
+	notesPages.POST("/:id/unshare/:user", notesUI.Unshare)
+	notesPages.GET("/:id/comments-panel", notesUI.CommentsPanel)
+	notesPages.POST("/:id/comment", notesUI.CommentPost)
+	notesPages.POST("/:id/uncomment/:comment", notesUI.Uncomment)
+	notesPages.DELETE("/:id/delete", notesUI.Delete)
 }
 
 func (a *application) logout(c *gin.Context) {
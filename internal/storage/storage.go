@@ -0,0 +1,168 @@
+// Package storage keeps the content of uploaded files in a blob store:
+// a local directory or an S3-compatible bucket.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"time"
+
+	"github.com/tmsankram/gonotes/internal/config"
+)
+
+// Backend names for config.Config.BlobBackend.
+const (
+	BackendLocal = "local"
+	BackendS3    = "s3"
+)
+
+var (
+	// ErrNotFound is returned for keys the store does not hold.
+	ErrNotFound = errors.New("blob not found")
+	// ErrPresignUnsupported is returned by stores that cannot hand out
+	// URLs to their blobs.
+	ErrPresignUnsupported = errors.New("blob store cannot presign URLs")
+)
+
+// Info describes a stored blob.
+type Info struct {
+	Size    int64
+	ModTime time.Time
+}
+
+// BlobStore stores blobs under keys. Keys are slash-separated paths
+// chosen by the caller.
+type BlobStore interface {
+	// Put streams r into the blob at key, replacing what was there, and
+	// returns the number of bytes stored. size may be -1 when unknown.
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) (int64, error)
+	// Get streams the whole blob.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	// GetRange streams length bytes of the blob starting at offset.
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Stat(ctx context.Context, key string) (Info, error)
+	// Move renames the blob at from to to, replacing what was there.
+	Move(ctx context.Context, from, to string) error
+	// Delete removes a blob; deleting a missing one is not an error.
+	Delete(ctx context.Context, key string) error
+	// List calls fn with every key in the store until fn returns an error.
+	List(ctx context.Context, fn func(key string) error) error
+	// PresignGet returns a URL that downloads the blob as downloadName
+	// without further authentication until expiry passes.
+	PresignGet(ctx context.Context, key string, expiry time.Duration, downloadName string) (*url.URL, error)
+}
+
+// Open connects to the backend named backend with the settings in cfg.
+func Open(ctx context.Context, cfg *config.Config, backend string) (BlobStore, error) {
+	switch backend {
+	case BackendLocal, "":
+		return NewLocal(cfg.UploadDir)
+	case BackendS3:
+		return NewS3(ctx, S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Bucket:    cfg.S3Bucket,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			Region:    cfg.S3Region,
+			UseSSL:    cfg.S3UseSSL,
+		})
+	default:
+		return nil, fmt.Errorf("unknown blob backend %q", backend)
+	}
+}
+
+// ReadSeeker reads a blob of a known size through ranged reads, so that
+// http.ServeContent can answer Range requests without fetching the whole
+// blob.
+type ReadSeeker struct {
+	ctx   context.Context
+	store BlobStore
+	key   string
+	size  int64
+
+	offset int64
+	body   io.ReadCloser
+}
+
+func NewReadSeeker(ctx context.Context, store BlobStore, key string, size int64) *ReadSeeker {
+	return &ReadSeeker{ctx: ctx, store: store, key: key, size: size}
+}
+
+func (r *ReadSeeker) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.store.GetRange(r.ctx, r.key, r.offset, r.size-r.offset)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *ReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	}
+	if offset < 0 {
+		return 0, errors.New("seek before start of blob")
+	}
+	if offset != r.offset {
+		r.Close()
+		r.offset = offset
+	}
+	return offset, nil
+}
+
+// Close releases the open range, if any.
+func (r *ReadSeeker) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
+
+// Copy copies every blob from src to dst. Blobs dst already holds with
+// the same size are skipped. It returns how many blobs were copied and
+// skipped.
+func Copy(ctx context.Context, dst, src BlobStore, log func(key string, err error)) (copied, skipped int, err error) {
+	err = src.List(ctx, func(key string) error {
+		info, err := src.Stat(ctx, key)
+		if err != nil {
+			log(key, err)
+			return nil
+		}
+		if have, err := dst.Stat(ctx, key); err == nil && have.Size == info.Size {
+			skipped++
+			return nil
+		}
+
+		body, err := src.Get(ctx, key)
+		if err != nil {
+			log(key, err)
+			return nil
+		}
+		defer body.Close()
+
+		if _, err := dst.Put(ctx, key, body, info.Size, ""); err != nil {
+			log(key, err)
+			return nil
+		}
+		copied++
+		log(key, nil)
+		return nil
+	})
+	return copied, skipped, err
+}
@@ -0,0 +1,274 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
+)
+
+func newLocal(t *testing.T) BlobStore {
+	t.Helper()
+	l, err := NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+// newFakeS3 connects to an in-process S3 fake with an empty bucket.
+func newFakeS3(t *testing.T) BlobStore {
+	t.Helper()
+	srv := httptest.NewServer(gofakes3.New(s3mem.New()).Server())
+	t.Cleanup(srv.Close)
+
+	s, err := NewS3(context.Background(), S3Options{
+		Endpoint:  strings.TrimPrefix(srv.URL, "http://"),
+		Bucket:    "gonotes",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Region:    "us-east-1",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+var backends = []struct {
+	name string
+	open func(t *testing.T) BlobStore
+}{
+	{BackendLocal, newLocal},
+	{BackendS3, newFakeS3},
+}
+
+func put(t *testing.T, s BlobStore, key, content string) {
+	t.Helper()
+	n, err := s.Put(context.Background(), key, strings.NewReader(content), int64(len(content)), "text/plain")
+	if err != nil {
+		t.Fatalf("put %s: %v", key, err)
+	}
+	if n != int64(len(content)) {
+		t.Fatalf("put %s: stored %d bytes, want %d", key, n, len(content))
+	}
+}
+
+func get(t *testing.T, s BlobStore, key string) string {
+	t.Helper()
+	body, err := s.Get(context.Background(), key)
+	if err != nil {
+		t.Fatalf("get %s: %v", key, err)
+	}
+	return read(t, body)
+}
+
+func read(t *testing.T, body io.ReadCloser) string {
+	t.Helper()
+	defer body.Close()
+	b, err := io.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func list(t *testing.T, s BlobStore) []string {
+	t.Helper()
+	var keys []string
+	err := s.List(context.Background(), func(key string) error {
+		keys = append(keys, key)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// TestBlobStore checks that every backend keeps the BlobStore contract.
+func TestBlobStore(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := b.open(t)
+
+			put(t, s, "sha256/ab/abc", "hello world")
+			if got := get(t, s, "sha256/ab/abc"); got != "hello world" {
+				t.Fatalf("get: %q", got)
+			}
+			body, err := s.GetRange(ctx, "sha256/ab/abc", 6, 3)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := read(t, body); got != "wor" {
+				t.Fatalf("range: %q", got)
+			}
+			info, err := s.Stat(ctx, "sha256/ab/abc")
+			if err != nil || info.Size != 11 || time.Since(info.ModTime) > time.Minute {
+				t.Fatalf("stat: %+v, %v", info, err)
+			}
+
+			// a size of -1 streams content of unknown length
+			n, err := s.Put(ctx, "incoming/1", strings.NewReader("unknown length"), -1, "")
+			if err != nil || n != 14 {
+				t.Fatalf("put unknown size: %d, %v", n, err)
+			}
+			put(t, s, "incoming/1", "replaced")
+			if got := get(t, s, "incoming/1"); got != "replaced" {
+				t.Fatalf("replaced: %q", got)
+			}
+
+			if err := s.Move(ctx, "incoming/1", "sha256/cd/cde"); err != nil {
+				t.Fatal(err)
+			}
+			if got := get(t, s, "sha256/cd/cde"); got != "replaced" {
+				t.Fatalf("moved: %q", got)
+			}
+			if err := s.Move(ctx, "incoming/1", "sha256/ef/efg"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("move missing: %v", err)
+			}
+
+			if got := list(t, s); !slices.Equal(got, []string{"sha256/ab/abc", "sha256/cd/cde"}) {
+				t.Fatalf("list: %v", got)
+			}
+			stop := errors.New("stop")
+			calls := 0
+			err = s.List(ctx, func(string) error { calls++; return stop })
+			if !errors.Is(err, stop) || calls != 1 {
+				t.Fatalf("list stops: %d calls, %v", calls, err)
+			}
+
+			if err := s.Delete(ctx, "sha256/ab/abc"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.Delete(ctx, "sha256/ab/abc"); err != nil {
+				t.Fatalf("delete missing: %v", err)
+			}
+			if _, err := s.Stat(ctx, "sha256/ab/abc"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("stat deleted: %v", err)
+			}
+			if _, err := s.Get(ctx, "sha256/ab/abc"); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("get deleted: %v", err)
+			}
+			if _, err := s.GetRange(ctx, "sha256/ab/abc", 0, 1); !errors.Is(err, ErrNotFound) {
+				t.Fatalf("range deleted: %v", err)
+			}
+			if got := list(t, s); !slices.Equal(got, []string{"sha256/cd/cde"}) {
+				t.Fatalf("list after delete: %v", got)
+			}
+		})
+	}
+}
+
+func TestReadSeeker(t *testing.T) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			s := b.open(t)
+			put(t, s, "blob", "0123456789")
+
+			r := NewReadSeeker(context.Background(), s, "blob", 10)
+			defer r.Close()
+			if _, err := r.Seek(-4, io.SeekEnd); err != nil {
+				t.Fatal(err)
+			}
+			b, err := io.ReadAll(r)
+			if err != nil || string(b) != "6789" {
+				t.Fatalf("got %q, %v", b, err)
+			}
+			if _, err := r.Seek(2, io.SeekStart); err != nil {
+				t.Fatal(err)
+			}
+			head := make([]byte, 3)
+			if _, err := io.ReadFull(r, head); err != nil || string(head) != "234" {
+				t.Fatalf("got %q, %v", head, err)
+			}
+		})
+	}
+}
+
+func TestLocalRefusesEscapingKeys(t *testing.T) {
+	s := newLocal(t)
+	for _, key := range []string{"", "../outside", "/etc/passwd", "a/../../outside"} {
+		if _, err := s.Put(context.Background(), key, strings.NewReader("x"), 1, ""); err == nil {
+			t.Errorf("put %q: expected an error", key)
+		}
+	}
+}
+
+func TestPresignGet(t *testing.T) {
+	ctx := context.Background()
+	if _, err := newLocal(t).PresignGet(ctx, "blob", time.Minute, "a.txt"); !errors.Is(err, ErrPresignUnsupported) {
+		t.Fatalf("local: %v", err)
+	}
+
+	s := newFakeS3(t)
+	put(t, s, "blob", "presigned")
+	u, err := s.PresignGet(ctx, "blob", time.Minute, "notes.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(u.Query().Get("response-content-disposition"), `filename=notes.txt`) {
+		t.Fatalf("url %s", u)
+	}
+	resp, err := http.Get(u.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := read(t, resp.Body); resp.StatusCode != http.StatusOK || got != "presigned" {
+		t.Fatalf("got %d: %q", resp.StatusCode, got)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	src, dst := newLocal(t), newFakeS3(t)
+	put(t, src, "sha256/aa/aaa", "first")
+	put(t, src, "sha256/bb/bbb", "second")
+	put(t, src, "legacy/0b5e_notes.txt", "from before deduplication")
+	// copied before, but cut short
+	put(t, dst, "sha256/bb/bbb", "sec")
+	// already there
+	put(t, dst, "sha256/aa/aaa", "first")
+
+	var logged []string
+	logf := func(key string, err error) {
+		if err != nil {
+			t.Errorf("%s: %v", key, err)
+		}
+		logged = append(logged, key)
+	}
+	copied, skipped, err := Copy(ctx, dst, src, logf)
+	if err != nil || copied != 2 || skipped != 1 {
+		t.Fatalf("copied %d, skipped %d, %v", copied, skipped, err)
+	}
+	slices.Sort(logged)
+	if !slices.Equal(logged, []string{"legacy/0b5e_notes.txt", "sha256/bb/bbb"}) {
+		t.Fatalf("logged %v", logged)
+	}
+	if !slices.Equal(list(t, dst), list(t, src)) {
+		t.Fatalf("dst has %v, src %v", list(t, dst), list(t, src))
+	}
+	for _, key := range list(t, src) {
+		want := get(t, src, key)
+		if got := get(t, dst, key); got != want {
+			t.Fatalf("%s: got %q, want %q", key, got, want)
+		}
+	}
+
+	// running again copies nothing
+	logged = nil
+	copied, skipped, err = Copy(ctx, dst, src, logf)
+	if err != nil || copied != 0 || skipped != 3 || len(logged) != 0 {
+		t.Fatalf("again: copied %d, skipped %d, logged %v, %v", copied, skipped, logged, err)
+	}
+}
@@ -0,0 +1,92 @@
+package ui
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/notes"
+)
+
+// GET /notes/:id/comments-panel
+func (h *NotesUI) CommentsPanel(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if c.Query("close") != "" {
+		h.Renderer.Page(c, "notes/comments-closed.html", gin.H{"NoteID": nid})
+		return
+	}
+	h.commentsPanel(c, nid, "")
+}
+
+// POST /notes/:id/comment
+func (h *NotesUI) CommentPost(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	body := strings.TrimSpace(c.PostForm("body"))
+	if body == "" {
+		h.commentsPanel(c, nid, "Write something first")
+		return
+	}
+
+	msg := ""
+	if _, err := h.Notes.AddComment(CurrentUserID(c), nid, body); err != nil {
+		msg = commentMessage(err)
+	}
+	h.commentsPanel(c, nid, msg)
+}
+
+// POST /notes/:id/uncomment/:comment
+func (h *NotesUI) Uncomment(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	cid, _ := strconv.ParseInt(c.Param("comment"), 10, 64)
+
+	msg := ""
+	if err := h.Notes.DeleteComment(CurrentUserID(c), nid, cid); err != nil {
+		msg = commentMessage(err)
+	}
+	h.commentsPanel(c, nid, msg)
+}
+
+func (h *NotesUI) commentsPanel(c *gin.Context, noteID int64, msg string) {
+	userID := CurrentUserID(c)
+
+	n, err := h.Notes.GetByID(userID, noteID)
+	if err != nil {
+		c.String(http.StatusNotFound, "Note not found")
+		return
+	}
+	comments, err := h.Notes.Comments(userID, noteID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	canComment, err := h.Notes.CanComment(userID, noteID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.Renderer.Page(c, "notes/comments.html", gin.H{
+		"NoteID":     noteID,
+		"UserID":     userID,
+		"Comments":   comments,
+		"CanComment": canComment,
+		"Owner":      n.UserID == userID,
+		"Error":      msg,
+	})
+}
+
+func commentMessage(err error) string {
+	switch {
+	case errors.Is(err, notes.ErrForbidden):
+		return "You may not do that on this note"
+	case errors.Is(err, notes.ErrCommentNotFound):
+		return "That comment is gone"
+	default:
+		return "Commenting failed"
+	}
+}
@@ -0,0 +1,77 @@
+package ui
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/markdown"
+	"github.com/tmsankram/gonotes/internal/notes"
+)
+
+// wikiHref is where a wiki link in note sourceID takes the reader.
+func wikiHref(sourceID int64, l markdown.WikiLink) string {
+	href := "/notes/" + strconv.FormatInt(sourceID, 10) + "/wiki?"
+	if l.ID != 0 {
+		return href + "id=" + strconv.FormatInt(l.ID, 10)
+	}
+	return href + "title=" + url.QueryEscape(l.Title)
+}
+
+// GET /notes/:id/wiki?title= or ?id=
+// Follows a wiki link in note :id to the note it names. Dangling links
+// lead back to the source note with a message.
+func (h *NotesUI) FollowLink(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	l := markdown.WikiLink{Title: c.Query("title")}
+	if id, err := strconv.ParseInt(c.Query("id"), 10, 64); err == nil {
+		l = markdown.WikiLink{ID: id}
+	}
+
+	n, err := h.Notes.ResolveLink(CurrentUserID(c), nid, l)
+	if errors.Is(err, notes.ErrNotFound) || errors.Is(err, notes.ErrForbidden) {
+		if l.ID != 0 {
+			Flash(c, "Note #"+strconv.FormatInt(l.ID, 10)+" does not exist or is not shared with you")
+		} else {
+			Flash(c, "There is no note titled \""+l.Title+"\" yet")
+		}
+		c.Redirect(http.StatusFound, "/notes?note="+strconv.FormatInt(nid, 10))
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Redirect(http.StatusFound, "/notes?note="+strconv.FormatInt(n.ID, 10))
+}
+
+// GET /notes/:id/links-panel
+func (h *NotesUI) LinksPanel(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if c.Query("close") != "" {
+		h.Renderer.Page(c, "notes/links-closed.html", gin.H{"NoteID": nid})
+		return
+	}
+
+	out, err := h.Notes.OutLinks(CurrentUserID(c), nid)
+	if err != nil {
+		c.String(http.StatusNotFound, "Note not found")
+		return
+	}
+	back, err := h.Notes.Backlinks(CurrentUserID(c), nid)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.Renderer.Page(c, "notes/links.html", gin.H{
+		"NoteID":    nid,
+		"Links":     out,
+		"Backlinks": back,
+	})
+}
@@ -1,40 +1,198 @@
 package ui
 
 import (
+	"errors"
+	"html/template"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 
 	"github.com/tmsankram/gonotes/internal/notes"
+	"github.com/tmsankram/gonotes/internal/pagination"
+	"github.com/tmsankram/gonotes/internal/users"
 )
 
 type NotesUI struct {
 	Notes    *notes.Service
+	Users    *users.Service
 	Renderer *Renderer
 }
 
-func NewNotesUI(n *notes.Service, r *Renderer) *NotesUI {
+func NewNotesUI(n *notes.Service, u *users.Service, r *Renderer) *NotesUI {
 	return &NotesUI{
 		Notes:    n,
+		Users:    u,
 		Renderer: r,
 	}
 }
 
-// GET /notes
+// pageSize is how many notes the list loads per scroll step.
+const pageSize = 20
+
+// GET /notes?note=
+// With note set the list only shows that note, which is where wiki links
+// lead.
 func (h *NotesUI) NotesPage(c *gin.Context) {
-	notes, _, err := h.Notes.Paginated(1, 9999) // load all for UI
+	var data gin.H
+	var err error
+	if id, perr := strconv.ParseInt(c.Query("note"), 10, 64); perr == nil {
+		var n notes.Note
+		n, err = h.Notes.GetByID(CurrentUserID(c), id)
+		if errors.Is(err, notes.ErrNotFound) {
+			c.String(http.StatusNotFound, "Note not found")
+			return
+		}
+		data = gin.H{"Notes": []notes.Note{n}, "Focus": n}
+	} else {
+		data, err = h.listPage(c, nil)
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tree, err := h.Notes.NotebookTree(CurrentUserID(c), nil)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	data["Title"] = "Notes"
+	data["Notebooks"] = tree
+	h.Renderer.Page(c, "notes/list.html", data)
+}
+
+// GET /notes/page?after=&tag=&notebook=&archived=
+func (h *NotesUI) NextPage(c *gin.Context) {
+	after, err := pagination.DecodeCursor(c.Query("after"))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := h.listPage(c, &after)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.Renderer.Page(c, "notes/page.html", data)
+}
+
+// listPage loads the notes after the cursor, filtered by the request's
+// tag and notebook parameters, together with the URL of the next page.
+func (h *NotesUI) listPage(c *gin.Context, after *pagination.Cursor) (gin.H, error) {
+	page, err := h.Notes.Keyset(CurrentUserID(c), listFilter(c), after, nil, pageSize)
+	if err != nil {
+		return nil, err
+	}
+
+	more := ""
+	if page.Next != nil {
+		q := url.Values{}
+		q["tag"] = c.QueryArray("tag")
+		if nb := c.Query("notebook"); nb != "" {
+			q.Set("notebook", nb)
+		}
+		if c.Query("archived") == "true" {
+			q.Set("archived", "true")
+		}
+		q.Set("after", page.Next.Encode())
+		more = "/notes/page?" + q.Encode()
+	}
+
+	return gin.H{"Notes": page.Items, "More": more}, nil
+}
+
+// listFilter reads the tag, notebook and archived filters of the notes
+// list. Notebooks always include their nested notebooks.
+func listFilter(c *gin.Context) notes.Filter {
+	filter := notes.Filter{
+		Tags:            c.QueryArray("tag"),
+		MatchAllTags:    true,
+		IncludeArchived: c.Query("archived") == "true",
+	}
+	if nb, err := strconv.ParseInt(c.Query("notebook"), 10, 64); err == nil {
+		filter.NotebookID = &nb
+		filter.Recursive = true
+	}
+	return filter
+}
+
+// searchRow is a note with its highlighted search snippet.
+type searchRow struct {
+	notes.Note
+	Snippet template.HTML
+}
+
+// GET /notes/search?q=&tag=&notebook=&archived=
+func (h *NotesUI) Search(c *gin.Context) {
+	q := c.Query("q")
+
+	if q == "" {
+		data, err := h.listPage(c, nil)
+		if err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+		h.Renderer.Page(c, "notes/page.html", data)
+		return
+	}
+
+	results, _, err := h.Notes.Search(CurrentUserID(c), q, listFilter(c), 1, 100)
 	if err != nil {
 		c.String(http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	h.Renderer.Page(c, "notes/list.html", gin.H{
-		"Title": "Notes",
-		"Notes": notes,
+	rows := []searchRow{}
+	for _, r := range results {
+		// Snippet is escaped by notes.Search; only <mark> tags are raw.
+		rows = append(rows, searchRow{Note: r.Note, Snippet: template.HTML(r.Snippet)})
+	}
+
+	h.Renderer.Page(c, "notes/results.html", gin.H{
+		"Results": rows,
 	})
 }
 
+// POST /notes/bulk-action
+func (h *NotesUI) BulkAction(c *gin.Context) {
+	userID := CurrentUserID(c)
+
+	var ids []int64
+	for _, raw := range c.PostFormArray("ids") {
+		if id, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	req := notes.BulkRequest{
+		IDs:  ids,
+		Op:   notes.BulkOp(c.PostForm("op")),
+		Tags: splitTags(c.PostForm("tags")),
+	}
+	if nb, err := strconv.ParseInt(c.PostForm("notebook_id"), 10, 64); err == nil {
+		req.NotebookID = &nb
+	}
+
+	if len(ids) > 0 {
+		if _, err := h.Notes.Bulk(userID, req); err != nil {
+			c.String(http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	data, err := h.listPage(c, nil)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.Renderer.Page(c, "notes/page.html", data)
+}
+
 // GET /notes/create-form
 func (h *NotesUI) CreateForm(c *gin.Context) {
 	h.Renderer.Page(c, "notes/create.html", gin.H{})
@@ -46,9 +204,10 @@ func (h *NotesUI) CreatePost(c *gin.Context) {
 	content := c.PostForm("content")
 
 	n, err := h.Notes.Create(notes.Note{
+		UserID:  CurrentUserID(c),
 		Title:   title,
 		Content: content,
-	})
+	}, splitTags(c.PostForm("tags")))
 	if err != nil {
 		h.Renderer.Page(c, "notes/create.html", gin.H{
 			"Flash": "Error creating note",
@@ -56,18 +215,25 @@ func (h *NotesUI) CreatePost(c *gin.Context) {
 		return
 	}
 
-	// return new item partial for HTMX prepend
-	h.Renderer.Page(c, "notes/item.html", gin.H{
+	// return new row partial for HTMX prepend
+	h.Renderer.Page(c, "notes/saved.html", gin.H{
 		"Note": n,
 	})
 }
 
+// POST /notes/preview
+func (h *NotesUI) Preview(c *gin.Context) {
+	h.Renderer.Page(c, "notes/preview.html", gin.H{
+		"Content": c.PostForm("content"),
+	})
+}
+
 // GET /notes/:id/edit
 func (h *NotesUI) EditForm(c *gin.Context) {
 	id := c.Param("id")
 	nid, _ := strconv.Atoi(id)
 
-	n, err := h.Notes.GetByID(int64(nid))
+	n, err := h.Notes.GetByID(CurrentUserID(c), int64(nid))
 	if err != nil {
 		c.String(404, "Note not found")
 		return
@@ -82,34 +248,84 @@ func (h *NotesUI) EditForm(c *gin.Context) {
 func (h *NotesUI) EditPost(c *gin.Context) {
 	id := c.Param("id")
 	nid, _ := strconv.Atoi(id)
+	version, _ := strconv.ParseInt(c.PostForm("version"), 10, 64)
 
-	title := c.PostForm("title")
-	content := c.PostForm("content")
+	tags := splitTags(c.PostForm("tags"))
+	mine := notes.Note{
+		ID:      int64(nid),
+		Title:   c.PostForm("title"),
+		Content: c.PostForm("content"),
+		Version: version,
+	}
 
-	n, err := h.Notes.Update(int64(nid), notes.Note{
-		Title:   title,
-		Content: content,
-	})
+	update := h.Notes.Update
+	if c.PostForm("rewrite_links") != "" {
+		update = h.Notes.UpdateRewritingLinks
+	}
+	n, err := update(CurrentUserID(c), int64(nid), mine, tags)
+	if errors.Is(err, notes.ErrNotFound) {
+		c.String(http.StatusNotFound, "Note not found")
+		return
+	}
+	if errors.Is(err, notes.ErrForbidden) {
+		c.String(http.StatusForbidden, "You cannot edit this note")
+		return
+	}
+	if errors.Is(err, notes.ErrVersionConflict) {
+		h.conflict(c, mine, tags)
+		return
+	}
 	if err != nil {
 		h.Renderer.Page(c, "notes/edit.html", gin.H{
 			"Flash": "Update failed",
-			"Note":  n,
+			"Note":  withTags(mine, tags),
 		})
 		return
 	}
 
-	// return updated list item partial
-	h.Renderer.Page(c, "notes/item.html", gin.H{
+	// return updated list row, replacing the edit form
+	h.Renderer.Page(c, "notes/saved.html", gin.H{
 		"Note": n,
 	})
 }
 
+// conflict re-renders the edit form after a rejected save. The form keeps
+// the user's text but carries the latest version, so saving again
+// overwrites the other change on purpose.
+func (h *NotesUI) conflict(c *gin.Context, mine notes.Note, tags []string) {
+	current, err := h.Notes.GetByID(CurrentUserID(c), mine.ID)
+	if err != nil {
+		c.String(http.StatusNotFound, "Note not found")
+		return
+	}
+
+	mine.Version = current.Version
+	h.Renderer.Page(c, "notes/edit.html", gin.H{
+		"Note":    withTags(mine, tags),
+		"Current": current,
+		"Diff":    notes.WordDiff(current.Content, mine.Content),
+	})
+}
+
+// withTags attaches tag names typed into a form to an unsaved note.
+func withTags(n notes.Note, names []string) notes.Note {
+	n.Tags = make([]notes.Tag, len(names))
+	for i, name := range names {
+		n.Tags[i] = notes.Tag{Name: name}
+	}
+	return n
+}
+
 // DELETE /notes/:id
 func (h *NotesUI) Delete(c *gin.Context) {
 	id := c.Param("id")
 	nid, _ := strconv.Atoi(id)
 
-	err := h.Notes.Delete(int64(nid))
+	err := h.Notes.Delete(CurrentUserID(c), int64(nid), 0)
+	if errors.Is(err, notes.ErrNotFound) {
+		c.String(http.StatusNotFound, "Note not found")
+		return
+	}
 	if err != nil {
 		c.String(400, "Delete failed")
 		return
@@ -117,3 +333,66 @@ func (h *NotesUI) Delete(c *gin.Context) {
 
 	c.Status(http.StatusOK)
 }
+
+// POST /notes/:id/toggle-pin
+// Pinning moves the note, so the first page of the list is rendered again.
+func (h *NotesUI) TogglePin(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	userID := CurrentUserID(c)
+
+	n, err := h.Notes.GetByID(userID, nid)
+	if err != nil {
+		c.String(http.StatusNotFound, "Note not found")
+		return
+	}
+
+	pinned := !n.Pinned
+	if _, err := h.Notes.SetState(userID, nid, notes.State{Pinned: &pinned}); err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	data, err := h.listPage(c, nil)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.Renderer.Page(c, "notes/page.html", data)
+}
+
+// POST /notes/:id/toggle-archive
+// Archived notes drop out of the list; unarchived ones are rendered again.
+func (h *NotesUI) ToggleArchive(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	userID := CurrentUserID(c)
+
+	n, err := h.Notes.GetByID(userID, nid)
+	if err != nil {
+		c.String(http.StatusNotFound, "Note not found")
+		return
+	}
+
+	archived := !n.Archived
+	n, err = h.Notes.SetState(userID, nid, notes.State{Archived: &archived})
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if n.Archived {
+		c.Status(http.StatusOK)
+		return
+	}
+	h.Renderer.Page(c, "notes/saved.html", gin.H{"Note": n})
+}
+
+// splitTags parses the comma separated tag field of the note forms.
+func splitTags(field string) []string {
+	tags := []string{}
+	for _, t := range strings.Split(field, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
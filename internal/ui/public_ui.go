@@ -0,0 +1,81 @@
+package ui
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/notes"
+)
+
+type PublicUI struct {
+	Notes    *notes.Service
+	Renderer *Renderer
+}
+
+func NewPublicUI(n *notes.Service, r *Renderer) *PublicUI {
+	return &PublicUI{
+		Notes:    n,
+		Renderer: r,
+	}
+}
+
+// GET /p/:token
+func (h *PublicUI) View(c *gin.Context) {
+	token := c.Param("token")
+
+	locked, err := h.Notes.LinkRequiresPassword(token)
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	if locked {
+		h.render(c, http.StatusOK, gin.H{"NeedPassword": true})
+		return
+	}
+	h.open(c, token, "")
+}
+
+// POST /p/:token
+func (h *PublicUI) Unlock(c *gin.Context) {
+	h.open(c, c.Param("token"), c.PostForm("password"))
+}
+
+func (h *PublicUI) open(c *gin.Context, token, password string) {
+	n, err := h.Notes.OpenLink(token, password)
+	if errors.Is(err, notes.ErrLinkPassword) {
+		msg := ""
+		if password != "" {
+			msg = "Wrong password"
+		}
+		h.render(c, http.StatusUnauthorized, gin.H{"NeedPassword": true, "Error": msg})
+		return
+	}
+	if err != nil {
+		h.fail(c, err)
+		return
+	}
+	h.render(c, http.StatusOK, gin.H{"Note": n})
+}
+
+func (h *PublicUI) fail(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, notes.ErrLinkNotFound):
+		h.render(c, http.StatusNotFound, gin.H{"Error": "This link does not exist or was revoked."})
+	case errors.Is(err, notes.ErrLinkExpired):
+		h.render(c, http.StatusGone, gin.H{"Error": "This link has expired."})
+	default:
+		c.String(http.StatusInternalServerError, "Something went wrong")
+	}
+}
+
+// render keeps public pages out of caches, search engines and referrers,
+// since the token in the URL is the only thing protecting them.
+func (h *PublicUI) render(c *gin.Context, status int, data gin.H) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	c.Header("X-Robots-Tag", "noindex")
+	c.Status(status)
+	h.Renderer.Page(c, "public/note.html", data)
+}
@@ -0,0 +1,170 @@
+package ui
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/notes"
+	"github.com/tmsankram/gonotes/internal/testdb"
+	"github.com/tmsankram/gonotes/internal/users"
+)
+
+// owner is someone whose details must never show on a public page.
+var owner = users.User{ID: 7319, Name: "Olivia Quill", Email: "olivia.quill@example.com", Password: "x"}
+
+func newPublicServer(t *testing.T) (*gin.Engine, *notes.Service, notes.Note) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	db := testdb.Open(t, &users.User{}, &notes.Note{}, &notes.Revision{}, &notes.Tag{}, &notes.Notebook{},
+		&notes.Share{}, &notes.Comment{}, &notes.PublicLink{}, &notes.WikiLink{})
+	if testdb.IsPostgres(db) {
+		if err := notes.Migrate(db); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := db.Create(&owner).Error; err != nil {
+		t.Fatal(err)
+	}
+	svc := notes.NewService(db, &config.Config{}, nil)
+	n, err := svc.Create(notes.Note{UserID: owner.ID, Title: "Trip itinerary", Content: "Day one: **museum**"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// templates are loaded relative to the repository root
+	t.Chdir("../..")
+	r := gin.New()
+	h := NewPublicUI(svc, NewRenderer(LoadTemplates()))
+	r.GET("/p/:token", h.View)
+	r.POST("/p/:token", h.Unlock)
+	return r, svc, n
+}
+
+func get(r http.Handler, path string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+	return rec
+}
+
+func unlock(r http.Handler, path, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(url.Values{"password": {password}}.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+// checkPrivate fails when a public page could leak the owner or end up in
+// a cache or search index.
+func checkPrivate(t *testing.T, rec *httptest.ResponseRecorder) {
+	t.Helper()
+	h := rec.Header()
+	if h.Get("Cache-Control") != "no-store" || h.Get("X-Robots-Tag") != "noindex" || h.Get("Referrer-Policy") != "no-referrer" {
+		t.Errorf("headers %v", h)
+	}
+	var all strings.Builder
+	all.WriteString(rec.Body.String())
+	for k, v := range h {
+		all.WriteString(k + ": " + strings.Join(v, ",") + "\n")
+	}
+	for _, secret := range []string{owner.Name, "Olivia", owner.Email, "7319"} {
+		if strings.Contains(all.String(), secret) {
+			t.Errorf("response shows %q", secret)
+		}
+	}
+}
+
+func TestPublicLinkView(t *testing.T) {
+	r, svc, n := newPublicServer(t)
+	l, err := svc.CreateLink(owner.ID, n.ID, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := get(r, "/p/"+l.Token)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got %d", rec.Code)
+	}
+	checkPrivate(t, rec)
+	body := rec.Body.String()
+	if !strings.Contains(body, "Trip itinerary") || !strings.Contains(body, "<strong>museum</strong>") || !strings.Contains(body, `content="noindex"`) {
+		t.Fatalf("body %s", body)
+	}
+
+	links, err := svc.Links(owner.ID, n.ID)
+	if err != nil || len(links) != 1 || links[0].Views != 1 {
+		t.Fatalf("links %+v, %v", links, err)
+	}
+
+	// revoking takes effect at once
+	if err := svc.RevokeLink(owner.ID, n.ID, l.ID); err != nil {
+		t.Fatal(err)
+	}
+	rec = get(r, "/p/"+l.Token)
+	if rec.Code != http.StatusNotFound || strings.Contains(rec.Body.String(), "Trip itinerary") {
+		t.Fatalf("revoked: got %d: %s", rec.Code, rec.Body)
+	}
+	checkPrivate(t, rec)
+
+	if rec := get(r, "/p/no-such-token"); rec.Code != http.StatusNotFound {
+		t.Fatalf("unknown: got %d", rec.Code)
+	}
+}
+
+func TestPublicLinkExpired(t *testing.T) {
+	r, svc, n := newPublicServer(t)
+	past := time.Now().Add(-time.Minute)
+	l, err := svc.CreateLink(owner.ID, n.ID, &past, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, rec := range []*httptest.ResponseRecorder{get(r, "/p/"+l.Token), unlock(r, "/p/"+l.Token, "")} {
+		if rec.Code != http.StatusGone || strings.Contains(rec.Body.String(), "Trip itinerary") {
+			t.Fatalf("got %d: %s", rec.Code, rec.Body)
+		}
+		checkPrivate(t, rec)
+	}
+}
+
+func TestPublicLinkPassword(t *testing.T) {
+	r, svc, n := newPublicServer(t)
+	l, err := svc.CreateLink(owner.ID, n.ID, nil, "open sesame")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := "/p/" + l.Token
+
+	// the page asks for the password without showing the note
+	rec := get(r, path)
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `type="password"`) || strings.Contains(rec.Body.String(), "Trip itinerary") {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+	checkPrivate(t, rec)
+
+	rec = unlock(r, path, "open says me")
+	if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), "Wrong password") || strings.Contains(rec.Body.String(), "Trip itinerary") {
+		t.Fatalf("wrong password: got %d: %s", rec.Code, rec.Body)
+	}
+	checkPrivate(t, rec)
+
+	rec = unlock(r, path, "open sesame")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Trip itinerary") {
+		t.Fatalf("right password: got %d: %s", rec.Code, rec.Body)
+	}
+	checkPrivate(t, rec)
+
+	// only the successful open counts as a view
+	links, err := svc.Links(owner.ID, n.ID)
+	if err != nil || len(links) != 1 || links[0].Views != 1 || !links[0].HasPassword {
+		t.Fatalf("links %+v, %v", links, err)
+	}
+}
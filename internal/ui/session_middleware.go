@@ -1,6 +1,8 @@
 package ui
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
 
 	"github.com/tmsankram/gonotes/internal/auth"
@@ -30,3 +32,47 @@ func SessionMiddleware(usersSvc *users.Service) gin.HandlerFunc {
 		c.Next()
 	}
 }
+
+// RequireLogin redirects anonymous visitors to the login page.
+// It must run after SessionMiddleware.
+func RequireLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, ok := c.Get("user"); !ok {
+			if c.GetHeader("HX-Request") == "true" {
+				c.Header("HX-Redirect", "/login")
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			c.Redirect(http.StatusFound, "/login")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireUser authenticates endpoints that serve both API clients and the
+// browser UI. A logged in session is used when there is one, otherwise the
+// request needs a bearer token as for auth.AuthRequired. Either way the
+// user ID ends up in "userID". It must run after SessionMiddleware.
+func RequireUser() gin.HandlerFunc {
+	bearer := auth.AuthRequired()
+	return func(c *gin.Context) {
+		if id := CurrentUserID(c); id != 0 {
+			c.Set("userID", id)
+			c.Next()
+			return
+		}
+		bearer(c)
+	}
+}
+
+// CurrentUserID returns the ID of the user attached by SessionMiddleware, or 0.
+func CurrentUserID(c *gin.Context) uint {
+	if u, ok := c.Get("user"); ok {
+		if user, ok := u.(users.User); ok {
+			return user.ID
+		}
+	}
+	return 0
+}
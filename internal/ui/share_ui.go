@@ -0,0 +1,103 @@
+package ui
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/notes"
+)
+
+// GET /notes/:id/share-dialog
+func (h *NotesUI) ShareDialog(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	if c.Query("close") != "" {
+		h.Renderer.Page(c, "notes/share-closed.html", gin.H{"NoteID": nid})
+		return
+	}
+	h.shareDialog(c, nid, "")
+}
+
+// POST /notes/:id/share
+func (h *NotesUI) SharePost(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+
+	u, err := h.Users.GetByEmail(strings.TrimSpace(c.PostForm("email")))
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	if u.ID == 0 {
+		h.shareDialog(c, nid, "No user with that email")
+		return
+	}
+
+	perm := notes.Permission(c.PostForm("permission"))
+	switch perm {
+	case notes.PermRead, notes.PermComment, notes.PermEdit:
+	default:
+		h.shareDialog(c, nid, "Unknown permission")
+		return
+	}
+
+	if _, err := h.Notes.Share(CurrentUserID(c), nid, u.ID, perm); err != nil {
+		h.shareDialog(c, nid, shareMessage(err))
+		return
+	}
+	h.shareDialog(c, nid, "")
+}
+
+// POST /notes/:id/unshare/:user
+func (h *NotesUI) Unshare(c *gin.Context) {
+	nid, _ := strconv.ParseInt(c.Param("id"), 10, 64)
+	grantee, _ := strconv.ParseUint(c.Param("user"), 10, 64)
+
+	msg := ""
+	if err := h.Notes.Revoke(CurrentUserID(c), nid, uint(grantee)); err != nil {
+		msg = shareMessage(err)
+	}
+	h.shareDialog(c, nid, msg)
+}
+
+// GET /notes/shared-with-me
+func (h *NotesUI) SharedWithMe(c *gin.Context) {
+	list, _, err := h.Notes.SharedWithMe(CurrentUserID(c), 1, 100)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	h.Renderer.Page(c, "notes/shared.html", gin.H{"Notes": list})
+}
+
+func (h *NotesUI) shareDialog(c *gin.Context, noteID int64, msg string) {
+	shares, err := h.Notes.Shares(CurrentUserID(c), noteID)
+	if errors.Is(err, notes.ErrNotFound) || errors.Is(err, notes.ErrForbidden) {
+		c.String(http.StatusNotFound, "Note not found")
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	h.Renderer.Page(c, "notes/share.html", gin.H{
+		"NoteID": noteID,
+		"Shares": shares,
+		"Error":  msg,
+	})
+}
+
+func shareMessage(err error) string {
+	switch {
+	case errors.Is(err, notes.ErrShareWithOwner):
+		return "You already own this note"
+	case errors.Is(err, notes.ErrShareNotFound):
+		return "That user no longer has access"
+	default:
+		return "Sharing failed"
+	}
+}
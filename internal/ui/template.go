@@ -3,10 +3,35 @@ package ui
 import (
 	"html/template"
 	"path/filepath"
+
+	"github.com/tmsankram/gonotes/internal/markdown"
 )
 
+// funcs are the helpers available to every template.
+var funcs = template.FuncMap{
+	// markdown renders note content to sanitised HTML.
+	"markdown": func(src string) template.HTML {
+		out, err := markdown.HTML(src)
+		if err != nil {
+			return template.HTML(template.HTMLEscapeString(src))
+		}
+		return template.HTML(out)
+	},
+	// wiki renders the content of note id like markdown, with its
+	// [[wiki links]] made clickable.
+	"wiki": func(id int64, src string) template.HTML {
+		out, err := markdown.HTML(markdown.LinkWikiLinks(src, func(l markdown.WikiLink) string {
+			return wikiHref(id, l)
+		}))
+		if err != nil {
+			return template.HTML(template.HTMLEscapeString(src))
+		}
+		return template.HTML(out)
+	},
+}
+
 func LoadTemplates() *template.Template {
-	t := template.New("")
+	t := template.New("").Funcs(funcs)
 
 	// load layout
 	t = template.Must(t.ParseFiles("ui/templates/layout.html"))
@@ -0,0 +1,305 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/events"
+)
+
+// responseLimit is how much of a receiver's response body is logged.
+const responseLimit = 1024
+
+// Dispatcher turns events from the bus into deliveries and sends them.
+// Deliveries are queued in the database, so retries survive a restart.
+// It assumes a single server instance sends deliveries.
+type Dispatcher struct {
+	svc *Service
+	bus *events.Bus
+
+	// Client sends the deliveries. The default one refuses to connect to
+	// addresses on our own network.
+	Client *http.Client
+	// MaxAttempts is how often a delivery is tried before it fails.
+	MaxAttempts int
+	// Backoff is the wait before the first retry; it doubles with each one.
+	Backoff time.Duration
+	// DisableAfter is how many failed attempts in a row disable a webhook.
+	DisableAfter int
+	// PollInterval is how often due retries are looked for.
+	PollInterval time.Duration
+	// Workers bounds how many deliveries are sent at once.
+	Workers int
+}
+
+func NewDispatcher(svc *Service, bus *events.Bus) *Dispatcher {
+	return &Dispatcher{
+		svc:          svc,
+		bus:          bus,
+		Client:       guardedClient(svc.allowPrivate),
+		MaxAttempts:  6,
+		Backoff:      30 * time.Second,
+		DisableAfter: 20,
+		PollInterval: 5 * time.Second,
+		Workers:      4,
+	}
+}
+
+// Run queues and sends deliveries until ctx is cancelled.
+func (d *Dispatcher) Run(ctx context.Context) {
+	go d.consume(ctx)
+
+	ticker := time.NewTicker(d.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.deliverDue(ctx); err != nil {
+			log.Printf("[WEBHOOKS] delivering: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.svc.wake:
+		}
+	}
+}
+
+// consume queues a delivery for every webhook that wants an event. When
+// it falls behind the bus it picks up again from the bus's buffer.
+func (d *Dispatcher) consume(ctx context.Context) {
+	var last uint64
+	resume := false
+
+	for {
+		sub := d.bus.SubscribeAll(last, resume)
+		if sub.Missed {
+			log.Printf("[WEBHOOKS] events after %d were lost", last)
+		}
+
+		for _, e := range sub.Replay {
+			d.enqueue(e)
+			last = e.ID
+		}
+
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				d.bus.Unsubscribe(sub)
+				return
+			case e, ok := <-sub.C:
+				if !ok {
+					break loop
+				}
+				d.enqueue(e)
+				last = e.ID
+			}
+		}
+		resume = true
+	}
+}
+
+func (d *Dispatcher) enqueue(e events.Event) {
+	var hooks []Webhook
+	q := d.svc.db.Where("active = ?", true)
+	if e.Users != nil {
+		q = q.Where("user_id IN ?", e.Users)
+	}
+	if err := q.Find(&hooks).Error; err != nil {
+		log.Printf("[WEBHOOKS] loading webhooks for event %d: %v", e.ID, err)
+		return
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		log.Printf("[WEBHOOKS] encoding event %d: %v", e.ID, err)
+		return
+	}
+
+	now := time.Now()
+	var deliveries []Delivery
+	for _, w := range hooks {
+		if w.wants(e.Type) {
+			deliveries = append(deliveries, Delivery{
+				WebhookID:     w.ID,
+				EventID:       e.ID,
+				Event:         e.Type,
+				Payload:       string(payload),
+				Status:        StatusPending,
+				NextAttemptAt: &now,
+			})
+		}
+	}
+	if len(deliveries) == 0 {
+		return
+	}
+
+	if err := d.svc.db.Create(&deliveries).Error; err != nil {
+		log.Printf("[WEBHOOKS] queueing event %d: %v", e.ID, err)
+		return
+	}
+	d.svc.notify()
+}
+
+// deliverDue sends the deliveries whose next attempt is due.
+func (d *Dispatcher) deliverDue(ctx context.Context) error {
+	var due []Delivery
+	err := d.svc.db.
+		Where("status = ? AND next_attempt_at <= ?", StatusPending, time.Now()).
+		Order("next_attempt_at, id").
+		Limit(100).
+		Find(&due).Error
+	if err != nil || len(due) == 0 {
+		return err
+	}
+
+	sem := make(chan struct{}, max(d.Workers, 1))
+	var wg sync.WaitGroup
+	for _, del := range due {
+		if ctx.Err() != nil {
+			break
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(del Delivery) {
+			defer func() { <-sem; wg.Done() }()
+			if err := d.attempt(ctx, del); err != nil {
+				log.Printf("[WEBHOOKS] delivery %d: %v", del.ID, err)
+			}
+		}(del)
+	}
+	wg.Wait()
+	return nil
+}
+
+// attempt sends a delivery once and records the outcome.
+func (d *Dispatcher) attempt(ctx context.Context, del Delivery) error {
+	var w Webhook
+	if err := d.svc.db.First(&w, del.WebhookID).Error; err != nil {
+		return err
+	}
+	if !w.Active {
+		return d.svc.db.Model(&del).Updates(map[string]interface{}{
+			"status":          StatusFailed,
+			"next_attempt_at": nil,
+			"error":           ErrDisabled.Error(),
+		}).Error
+	}
+
+	start := time.Now()
+	code, body, sendErr := d.send(ctx, w, del)
+	if ctx.Err() != nil {
+		// shutting down; leave the delivery due for the next start
+		return nil
+	}
+
+	del.Attempts++
+	changes := map[string]interface{}{
+		"attempts":    del.Attempts,
+		"status_code": code,
+		"response":    body,
+		"error":       "",
+		"duration_ms": time.Since(start).Milliseconds(),
+	}
+
+	ok := sendErr == nil && code >= 200 && code < 300
+	switch {
+	case ok:
+		changes["status"] = StatusDelivered
+		changes["next_attempt_at"] = nil
+	case del.Attempts >= d.MaxAttempts:
+		changes["status"] = StatusFailed
+		changes["next_attempt_at"] = nil
+	default:
+		next := time.Now().Add(d.Backoff << (del.Attempts - 1))
+		changes["next_attempt_at"] = next
+	}
+	if sendErr != nil {
+		changes["error"] = sendErr.Error()
+	} else if !ok {
+		changes["error"] = "unexpected status " + strconv.Itoa(code)
+	}
+
+	return d.svc.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&del).Updates(changes).Error; err != nil {
+			return err
+		}
+		if ok {
+			return tx.Model(&w).UpdateColumn("failures", 0).Error
+		}
+		return d.failed(tx, w)
+	})
+}
+
+// failed counts a failed attempt against a webhook and disables it once
+// there were too many in a row. Its pending deliveries fail with it.
+func (d *Dispatcher) failed(tx *gorm.DB, w Webhook) error {
+	err := tx.Model(&w).UpdateColumn("failures", gorm.Expr("failures + 1")).Error
+	if err != nil {
+		return err
+	}
+	if err := tx.Select("failures").First(&w, w.ID).Error; err != nil {
+		return err
+	}
+	if w.Failures < d.DisableAfter {
+		return nil
+	}
+
+	// attempts running side by side may both get here
+	res := tx.Model(&w).Where("active = ?", true).Updates(map[string]interface{}{
+		"active":      false,
+		"disabled_at": time.Now(),
+	})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return res.Error
+	}
+	log.Printf("[WEBHOOKS] disabled webhook %d after %d failures", w.ID, w.Failures)
+
+	return tx.Model(&Delivery{}).
+		Where("webhook_id = ? AND status = ?", w.ID, StatusPending).
+		Updates(map[string]interface{}{
+			"status":          StatusFailed,
+			"next_attempt_at": nil,
+			"error":           ErrDisabled.Error(),
+		}).Error
+}
+
+func (d *Dispatcher) send(ctx context.Context, w Webhook, del Delivery) (int, string, error) {
+	body := []byte(del.Payload)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GoNotes-Webhook")
+	req.Header.Set("X-GoNotes-Event", del.Event)
+	req.Header.Set("X-GoNotes-Delivery", strconv.FormatInt(del.ID, 10))
+	req.Header.Set("X-GoNotes-Signature-256", Sign(w.Secret, body))
+
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, "", err
+	}
+	defer resp.Body.Close()
+
+	snippet, err := io.ReadAll(io.LimitReader(resp.Body, responseLimit))
+	if err != nil {
+		return resp.StatusCode, "", fmt.Errorf("reading response: %w", err)
+	}
+	// the log is stored as text, which cannot hold arbitrary bytes
+	text := strings.ToValidUTF8(strings.ReplaceAll(string(snippet), "\x00", ""), "\uFFFD")
+	return resp.StatusCode, text, nil
+}
@@ -0,0 +1,345 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/events"
+	"github.com/tmsankram/gonotes/internal/testdb"
+)
+
+const secret = "0123456789abcdef-receiver"
+
+// receiver records the deliveries it gets and answers with the next of
+// its statuses, repeating the last one.
+type receiver struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func newReceiver(t *testing.T, statuses ...int) *receiver {
+	t.Helper()
+	rc := &receiver{statuses: statuses}
+	rc.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		rc.mu.Lock()
+		status := rc.statuses[min(len(rc.requests), len(rc.statuses)-1)]
+		rc.requests = append(rc.requests, r)
+		rc.bodies = append(rc.bodies, body)
+		rc.mu.Unlock()
+
+		w.WriteHeader(status)
+		w.Write([]byte("status " + strconv.Itoa(status)))
+	}))
+	t.Cleanup(rc.Close)
+	return rc
+}
+
+func (rc *receiver) hits() int {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	return len(rc.requests)
+}
+
+// newTestDispatcher returns a dispatcher that may deliver to httptest
+// servers, retries quickly and sends one delivery at a time.
+func newTestDispatcher(t *testing.T) (*Dispatcher, *Service, *gorm.DB) {
+	t.Helper()
+	db := testdb.Open(t, &Webhook{}, &Delivery{})
+	svc := NewService(db, &config.Config{WebhookAllowPrivate: true})
+	d := NewDispatcher(svc, events.NewBus(100))
+	d.Backoff = time.Minute
+	d.Workers = 1
+	return d, svc, db
+}
+
+func createHook(t *testing.T, svc *Service, url string) Webhook {
+	t.Helper()
+	w, err := svc.Create(Webhook{UserID: 1, URL: url, Events: []string{events.NoteCreated}, Secret: secret, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func noteCreated(id int64) events.Event {
+	return events.Event{ID: uint64(id), Type: events.NoteCreated, Time: time.Now(), Data: map[string]int64{"id": id}, Users: []uint{1}}
+}
+
+// deliveries returns the delivery log of w, oldest first.
+func deliveries(t *testing.T, db *gorm.DB, w Webhook) []Delivery {
+	t.Helper()
+	var dels []Delivery
+	if err := db.Where("webhook_id = ?", w.ID).Order("id").Find(&dels).Error; err != nil {
+		t.Fatal(err)
+	}
+	return dels
+}
+
+// makeDue moves the retries of w up to now.
+func makeDue(t *testing.T, db *gorm.DB, w Webhook) {
+	t.Helper()
+	err := db.Model(&Delivery{}).
+		Where("webhook_id = ? AND status = ?", w.ID, StatusPending).
+		Update("next_attempt_at", time.Now()).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliverySigned(t *testing.T) {
+	d, svc, db := newTestDispatcher(t)
+	rc := newReceiver(t, http.StatusOK)
+	w := createHook(t, svc, rc.URL)
+
+	d.enqueue(noteCreated(1))
+	// neither subscribed to nor for this user
+	d.enqueue(events.Event{ID: 2, Type: events.NoteDeleted, Users: []uint{1}})
+	d.enqueue(events.Event{ID: 3, Type: events.NoteCreated, Users: []uint{2}})
+	if err := d.deliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rc.hits() != 1 {
+		t.Fatalf("got %d requests", rc.hits())
+	}
+	req, body := rc.requests[0], rc.bodies[0]
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if got, want := req.Header.Get("X-GoNotes-Signature-256"), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+		t.Fatalf("signature %q, want %q", got, want)
+	}
+	dels := deliveries(t, db, w)
+	if len(dels) != 1 {
+		t.Fatalf("got %d deliveries", len(dels))
+	}
+	if req.Header.Get("X-GoNotes-Event") != events.NoteCreated ||
+		req.Header.Get("X-GoNotes-Delivery") != strconv.FormatInt(dels[0].ID, 10) ||
+		req.Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("headers %v", req.Header)
+	}
+	if string(body) != dels[0].Payload {
+		t.Fatalf("body %s, payload %s", body, dels[0].Payload)
+	}
+
+	del := dels[0]
+	if del.Status != StatusDelivered || del.Attempts != 1 || del.StatusCode != http.StatusOK ||
+		del.Response != "status 200" || del.Error != "" || del.NextAttemptAt != nil {
+		t.Fatalf("got %+v", del)
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	d, svc, db := newTestDispatcher(t)
+	rc := newReceiver(t, http.StatusServiceUnavailable, http.StatusInternalServerError, http.StatusNoContent)
+	w := createHook(t, svc, rc.URL)
+	d.enqueue(noteCreated(1))
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		before := time.Now()
+		if err := d.deliverDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		del := deliveries(t, db, w)[0]
+		if del.Status != StatusPending || del.Attempts != attempt || del.StatusCode < 500 ||
+			del.Error != "unexpected status "+strconv.Itoa(del.StatusCode) {
+			t.Fatalf("attempt %d: got %+v", attempt, del)
+		}
+
+		// the wait doubles with every attempt
+		wait := d.Backoff << (attempt - 1)
+		if del.NextAttemptAt == nil || del.NextAttemptAt.Before(before.Add(wait)) || del.NextAttemptAt.After(time.Now().Add(wait)) {
+			t.Fatalf("attempt %d: next attempt at %v, want %v after %v", attempt, del.NextAttemptAt, wait, before)
+		}
+		// nothing is sent before then
+		if err := d.deliverDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		if rc.hits() != attempt {
+			t.Fatalf("attempt %d: got %d requests", attempt, rc.hits())
+		}
+		makeDue(t, db, w)
+	}
+
+	if err := d.deliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	del := deliveries(t, db, w)[0]
+	if del.Status != StatusDelivered || del.Attempts != 3 || del.StatusCode != http.StatusNoContent {
+		t.Fatalf("got %+v", del)
+	}
+	// a success ends the run of failures
+	if w, _ = svc.Get(1, w.ID); w.Failures != 0 || !w.Active {
+		t.Fatalf("got %+v", w)
+	}
+}
+
+func TestRetriesRunOut(t *testing.T) {
+	d, svc, db := newTestDispatcher(t)
+	d.MaxAttempts = 2
+	rc := newReceiver(t, http.StatusBadGateway)
+	w := createHook(t, svc, rc.URL)
+	d.enqueue(noteCreated(1))
+
+	for range d.MaxAttempts + 1 {
+		if err := d.deliverDue(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		makeDue(t, db, w)
+	}
+	if rc.hits() != 2 {
+		t.Fatalf("got %d requests", rc.hits())
+	}
+	del := deliveries(t, db, w)[0]
+	if del.Status != StatusFailed || del.Attempts != 2 || del.NextAttemptAt != nil || del.StatusCode != http.StatusBadGateway {
+		t.Fatalf("got %+v", del)
+	}
+	if w, _ = svc.Get(1, w.ID); w.Failures != 2 || !w.Active {
+		t.Fatalf("got %+v", w)
+	}
+}
+
+func TestAutoDisable(t *testing.T) {
+	d, svc, db := newTestDispatcher(t)
+	d.MaxAttempts = 1
+	d.DisableAfter = 3
+	rc := newReceiver(t, http.StatusInternalServerError)
+	w := createHook(t, svc, rc.URL)
+
+	for i := range 4 {
+		d.enqueue(noteCreated(int64(i + 1)))
+	}
+	if err := d.deliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rc.hits() != 3 {
+		t.Fatalf("got %d requests", rc.hits())
+	}
+	w, err := svc.Get(1, w.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Active || w.DisabledAt == nil || w.Failures != 3 {
+		t.Fatalf("got %+v", w)
+	}
+	dels := deliveries(t, db, w)
+	for _, del := range dels[:3] {
+		if del.Status != StatusFailed || del.Attempts != 1 {
+			t.Fatalf("got %+v", del)
+		}
+	}
+	if last := dels[3]; last.Status != StatusFailed || last.Attempts != 0 || last.Error != ErrDisabled.Error() {
+		t.Fatalf("got %+v", last)
+	}
+
+	// a disabled webhook gets no new deliveries
+	d.enqueue(noteCreated(5))
+	if n := len(deliveries(t, db, w)); n != 4 {
+		t.Fatalf("got %d deliveries", n)
+	}
+	if _, err := svc.Redeliver(1, w.ID, dels[0].ID); !errors.Is(err, ErrDisabled) {
+		t.Fatalf("redeliver: got %v", err)
+	}
+
+	// turning it back on starts counting afresh
+	w, err = svc.Update(1, w.ID, Webhook{URL: w.URL, Events: w.Events, Active: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !w.Active || w.Failures != 0 || w.DisabledAt != nil {
+		t.Fatalf("got %+v", w)
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	d, svc, db := newTestDispatcher(t)
+	rc := newReceiver(t, http.StatusOK)
+	w := createHook(t, svc, rc.URL)
+	d.enqueue(noteCreated(1))
+	if err := d.deliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	orig := deliveries(t, db, w)[0]
+
+	if _, err := svc.Redeliver(2, w.ID, orig.ID); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("other user: got %v", err)
+	}
+	if _, err := svc.Redeliver(1, w.ID, orig.ID+100); !errors.Is(err, ErrDeliveryNotFound) {
+		t.Fatalf("unknown delivery: got %v", err)
+	}
+
+	again, err := svc.Redeliver(1, w.ID, orig.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID == orig.ID || again.RedeliveryOf == nil || *again.RedeliveryOf != orig.ID || again.Status != StatusPending {
+		t.Fatalf("got %+v", again)
+	}
+	if err := d.deliverDue(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if rc.hits() != 2 {
+		t.Fatalf("got %d requests", rc.hits())
+	}
+	if string(rc.bodies[1]) != string(rc.bodies[0]) ||
+		rc.requests[1].Header.Get("X-GoNotes-Delivery") != strconv.FormatInt(again.ID, 10) {
+		t.Fatalf("redelivered %s with %v", rc.bodies[1], rc.requests[1].Header)
+	}
+	if err := db.First(&again, again.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if again.Status != StatusDelivered || again.EventID != orig.EventID {
+		t.Fatalf("got %+v", again)
+	}
+
+	log, total, err := svc.Deliveries(1, w.ID, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || log[0].ID != again.ID || log[1].ID != orig.ID {
+		t.Fatalf("got %d: %+v", total, log)
+	}
+}
+
+func TestRun(t *testing.T) {
+	d, svc, _ := newTestDispatcher(t)
+	d.PollInterval = 10 * time.Millisecond
+	rc := newReceiver(t, http.StatusOK)
+	createHook(t, svc, rc.URL)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go d.Run(ctx)
+
+	// events published before the dispatcher subscribed are not sent,
+	// so keep publishing until one arrives
+	deadline := time.Now().Add(5 * time.Second)
+	for rc.hits() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		d.bus.Publish(events.Event{Type: events.NoteCreated, Users: []uint{1}})
+		time.Sleep(20 * time.Millisecond)
+	}
+}
@@ -0,0 +1,80 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// allowedAddr reports whether deliveries may connect to ip. Loopback,
+// link-local, private and unspecified addresses are refused so that a
+// webhook cannot be used to reach services on our own network.
+func allowedAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return !ip.IsLoopback() &&
+		!ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() &&
+		!ip.IsInterfaceLocalMulticast() &&
+		!ip.IsPrivate() &&
+		!ip.IsUnspecified()
+}
+
+// guardedClient returns the client deliveries are sent with. Every
+// connection it opens, including those for redirects, is checked after
+// DNS resolution, so neither a redirect nor a rebinding DNS server can
+// lead it to a refused address. allowPrivate turns the check off.
+func guardedClient(allowPrivate bool) *http.Client {
+	dialer := &net.Dialer{
+		Timeout:   5 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			if allowPrivate {
+				return nil
+			}
+			addr, err := netip.ParseAddrPort(address)
+			if err != nil {
+				return err
+			}
+			if !allowedAddr(addr.Addr()) {
+				return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr.Addr())
+			}
+			return nil
+		},
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// a proxy would make the checked connection the one to the proxy
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{Transport: transport, Timeout: 10 * time.Second}
+}
+
+// checkURL resolves the host of a webhook URL and refuses it when any of
+// its addresses may not be delivered to. Deliveries are checked again
+// when they connect, as the host may resolve differently by then.
+func (s *Service) checkURL(ctx context.Context, raw string) error {
+	if s.allowPrivate {
+		return nil
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", u.Hostname())
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidURL, err)
+	}
+	for _, addr := range addrs {
+		if !allowedAddr(addr) {
+			return fmt.Errorf("%w: %s resolves to %s", ErrForbiddenAddress, u.Hostname(), addr.Unmap())
+		}
+	}
+	return nil
+}
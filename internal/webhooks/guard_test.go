@@ -0,0 +1,98 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/tmsankram/gonotes/internal/config"
+	"github.com/tmsankram/gonotes/internal/events"
+	"github.com/tmsankram/gonotes/internal/testdb"
+)
+
+func TestAllowedAddr(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"127.8.8.8", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := allowedAddr(netip.MustParseAddr(tt.addr)); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestCreateRefusesPrivateAddresses(t *testing.T) {
+	svc := NewService(testdb.Open(t, &Webhook{}, &Delivery{}), &config.Config{})
+
+	for _, u := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://[::1]/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hook",
+	} {
+		_, err := svc.Create(Webhook{UserID: 1, URL: u, Events: []string{"note.created"}, Active: true})
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("%s: got %v", u, err)
+		}
+	}
+}
+
+func TestDeliveryRefusesPrivateAddresses(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.Write([]byte("internal secrets"))
+	}))
+	defer srv.Close()
+
+	// the webhook was saved while its host still resolved elsewhere
+	db := testdb.Open(t, &Webhook{}, &Delivery{})
+	w, err := NewService(db, &config.Config{WebhookAllowPrivate: true}).Create(Webhook{
+		UserID: 1, URL: srv.URL, Events: []string{"note.created"}, Active: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := NewDispatcher(NewService(db, &config.Config{}), events.NewBus(10))
+	del := Delivery{WebhookID: w.ID, EventID: 1, Event: "note.created", Payload: `{}`, Status: StatusPending}
+	if err := db.Create(&del).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := d.attempt(context.Background(), del); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := db.First(&del, del.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if hits.Load() != 0 {
+		t.Fatalf("receiver was called %d times", hits.Load())
+	}
+	if !strings.Contains(del.Error, ErrForbiddenAddress.Error()) || del.Response != "" || del.StatusCode != 0 {
+		t.Fatalf("got %+v", del)
+	}
+}
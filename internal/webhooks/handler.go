@@ -0,0 +1,267 @@
+package webhooks
+
+import (
+	"errors"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+	"github.com/tmsankram/gonotes/internal/pagination"
+	"github.com/tmsankram/gonotes/internal/response"
+)
+
+type Handler struct {
+	svc *Service
+}
+
+func NewHandler(svc *Service) *Handler {
+	return &Handler{svc: svc}
+}
+
+func (h *Handler) RegisterRoutes(r *gin.Engine) {
+	g := r.Group("/webhooks")
+	g.Use(auth.AuthRequired())
+	{
+		g.GET("/", h.list)
+		g.POST("/", h.create)
+		g.GET("/:id", h.get)
+		g.PUT("/:id", h.update)
+		g.DELETE("/:id", h.delete)
+
+		g.GET("/:id/deliveries", h.deliveries)
+		g.POST("/:id/deliveries/:delivery/redeliver", h.redeliver)
+	}
+}
+
+type webhookReq struct {
+	URL    string   `json:"url" binding:"required,url,startswith=http"`
+	Events []string `json:"events" binding:"required,min=1,dive,oneof=note.created note.updated note.deleted file.created file.deleted"`
+	Secret string   `json:"secret" binding:"omitempty,min=16,max=256"`
+	// Active defaults to true when left out.
+	Active *bool `json:"active"`
+}
+
+// createdWebhook is the only response that includes the secret.
+type createdWebhook struct {
+	Webhook
+	Secret string `json:"secret"`
+}
+
+// webhookError maps webhook service errors to responses.
+func webhookError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrDeliveryNotFound):
+		response.NotFound(c, err)
+	case errors.Is(err, ErrDisabled):
+		response.Conflict(c, err)
+	case errors.Is(err, ErrInvalidURL), errors.Is(err, ErrForbiddenAddress):
+		response.ValidationError(c, err.Error())
+	default:
+		response.Internal(c, err)
+	}
+}
+
+func paramID(c *gin.Context, name string) (int64, bool) {
+	id, err := strconv.ParseInt(c.Param(name), 10, 64)
+	if err != nil {
+		response.ValidationError(c, "invalid "+name)
+		return 0, false
+	}
+	return id, true
+}
+
+// ListWebhooks godoc
+// @Summary List webhooks
+// @Description Get the caller's webhook subscriptions
+// @Tags webhooks
+// @Produce json
+// @Success 200 {object} response.SuccessResponse
+// @Security ApiKeyAuth
+// @Router /webhooks [get]
+func (h *Handler) list(c *gin.Context) {
+	hooks, err := h.svc.List(c.GetUint("userID"))
+	if err != nil {
+		response.Internal(c, err)
+		return
+	}
+	response.Success(c, "Webhooks retrieved successfully", hooks)
+}
+
+// CreateWebhook godoc
+// @Summary Create webhook
+// @Description Subscribe a URL to note and file events, created disabled when "active" is false. The secret signing the deliveries is generated when left out and only returned here.
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param payload body webhookReq true "URL, event types and optional secret"
+// @Success 201 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhooks [post]
+func (h *Handler) create(c *gin.Context) {
+	var req webhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	w, err := h.svc.Create(Webhook{
+		UserID: c.GetUint("userID"),
+		URL:    req.URL,
+		Events: req.Events,
+		Secret: req.Secret,
+		Active: req.Active == nil || *req.Active,
+	})
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Created(c, "Webhook created successfully", createdWebhook{Webhook: w, Secret: w.Secret})
+}
+
+// GetWebhook godoc
+// @Summary Get webhook
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhooks/{id} [get]
+func (h *Handler) get(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	w, err := h.svc.Get(c.GetUint("userID"), id)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, "Webhook retrieved successfully", w)
+}
+
+// UpdateWebhook godoc
+// @Summary Update webhook
+// @Description Change the URL, events or secret of a webhook, or disable and re-enable it
+// @Tags webhooks
+// @Accept json
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param payload body webhookReq true "Webhook"
+// @Success 200 {object} response.SuccessResponse
+// @Failure 400 {object} response.ErrorResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhooks/{id} [put]
+func (h *Handler) update(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var req webhookReq
+	if err := c.ShouldBindJSON(&req); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+
+	w, err := h.svc.Update(c.GetUint("userID"), id, Webhook{
+		URL:    req.URL,
+		Events: req.Events,
+		Secret: req.Secret,
+		Active: req.Active == nil || *req.Active,
+	})
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Success(c, "Webhook updated successfully", w)
+}
+
+// DeleteWebhook godoc
+// @Summary Delete webhook
+// @Description Delete a webhook together with its delivery log
+// @Tags webhooks
+// @Param id path int true "Webhook ID"
+// @Success 204
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhooks/{id} [delete]
+func (h *Handler) delete(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.svc.Delete(c.GetUint("userID"), id); err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.NoContent(c)
+}
+
+// ListDeliveries godoc
+// @Summary List webhook deliveries
+// @Description Get the delivery log of a webhook with the outcome of each, newest first
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param page query int false "Page number"
+// @Param limit query int false "Limit"
+// @Success 200 {object} response.ListResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhooks/{id}/deliveries [get]
+func (h *Handler) deliveries(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+
+	var page pagination.Pagination
+	if err := c.ShouldBindQuery(&page); err != nil {
+		response.ValidationError(c, err.Error())
+		return
+	}
+	page.Normalize()
+
+	items, total, err := h.svc.Deliveries(c.GetUint("userID"), id, page.Page, page.Limit)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.List(c, items, page.Page, page.Limit, int(total))
+}
+
+// Redeliver godoc
+// @Summary Redeliver
+// @Description Send the payload of an earlier delivery again as a new delivery
+// @Tags webhooks
+// @Produce json
+// @Param id path int true "Webhook ID"
+// @Param delivery path int true "Delivery ID"
+// @Success 202 {object} response.SuccessResponse
+// @Failure 404 {object} response.ErrorResponse
+// @Failure 409 {object} response.ErrorResponse
+// @Security ApiKeyAuth
+// @Router /webhooks/{id}/deliveries/{delivery}/redeliver [post]
+func (h *Handler) redeliver(c *gin.Context) {
+	id, ok := paramID(c, "id")
+	if !ok {
+		return
+	}
+	deliveryID, ok := paramID(c, "delivery")
+	if !ok {
+		return
+	}
+
+	d, err := h.svc.Redeliver(c.GetUint("userID"), id, deliveryID)
+	if err != nil {
+		webhookError(c, err)
+		return
+	}
+	response.Accepted(c, "Redelivery queued", d)
+}
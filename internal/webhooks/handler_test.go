@@ -0,0 +1,105 @@
+package webhooks
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tmsankram/gonotes/internal/auth"
+)
+
+func serve(t *testing.T, r http.Handler, userID uint, method, path, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	token, err := auth.GenerateToken(userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d, svc, _ := newTestDispatcher(t)
+	rc := newReceiver(t, http.StatusOK)
+	r := gin.New()
+	NewHandler(svc).RegisterRoutes(r)
+
+	var created struct {
+		Details struct {
+			ID     int64  `json:"id"`
+			Active bool   `json:"active"`
+			Secret string `json:"secret"`
+		} `json:"details"`
+	}
+	body := fmt.Sprintf(`{"url": %q, "events": ["note.created"], "active": false}`, rc.URL)
+	rec := serve(t, r, 1, http.MethodPost, "/webhooks/", body)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("create: got %d: %s", rec.Code, rec.Body)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+	if created.Details.Active || len(created.Details.Secret) != 64 {
+		t.Fatalf("create: got %s", rec.Body)
+	}
+	hook := fmt.Sprintf("/webhooks/%d", created.Details.ID)
+
+	// disabled webhooks get nothing
+	d.enqueue(noteCreated(1))
+	if rec := serve(t, r, 1, http.MethodGet, hook+"/deliveries", ""); rec.Code != http.StatusOK || bytes.Contains(rec.Body.Bytes(), []byte(`"event"`)) {
+		t.Fatalf("deliveries: got %d: %s", rec.Code, rec.Body)
+	}
+
+	body = fmt.Sprintf(`{"url": %q, "events": ["note.created"]}`, rc.URL)
+	if rec := serve(t, r, 1, http.MethodPut, hook, body); rec.Code != http.StatusOK || !bytes.Contains(rec.Body.Bytes(), []byte(`"active":true`)) {
+		t.Fatalf("update: got %d: %s", rec.Code, rec.Body)
+	}
+	d.enqueue(noteCreated(2))
+
+	var log struct {
+		Items []Delivery `json:"items"`
+	}
+	rec = serve(t, r, 1, http.MethodGet, hook+"/deliveries", "")
+	if err := json.Unmarshal(rec.Body.Bytes(), &log); err != nil || len(log.Items) != 1 {
+		t.Fatalf("deliveries: got %d: %s", rec.Code, rec.Body)
+	}
+	redeliver := fmt.Sprintf("%s/deliveries/%d/redeliver", hook, log.Items[0].ID)
+	if rec := serve(t, r, 1, http.MethodPost, redeliver, ""); rec.Code != http.StatusAccepted {
+		t.Fatalf("redeliver: got %d: %s", rec.Code, rec.Body)
+	}
+
+	// other users cannot see or use the webhook
+	for _, req := range []struct{ method, path string }{
+		{http.MethodGet, hook},
+		{http.MethodGet, hook + "/deliveries"},
+		{http.MethodPost, redeliver},
+		{http.MethodDelete, hook},
+	} {
+		if rec := serve(t, r, 2, req.method, req.path, ""); rec.Code != http.StatusNotFound {
+			t.Fatalf("%s %s: got %d: %s", req.method, req.path, rec.Code, rec.Body)
+		}
+	}
+}
+
+func TestHandlerRefusesPrivateAddresses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	d, _, _ := newTestDispatcher(t)
+	d.svc.allowPrivate = false
+	r := gin.New()
+	NewHandler(d.svc).RegisterRoutes(r)
+
+	rec := serve(t, r, 1, http.MethodPost, "/webhooks/", `{"url": "http://169.254.169.254/latest", "events": ["note.created"]}`)
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got %d: %s", rec.Code, rec.Body)
+	}
+}
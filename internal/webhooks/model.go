@@ -0,0 +1,62 @@
+package webhooks
+
+import "time"
+
+// Webhook posts the events a user subscribed to to a URL of theirs.
+type Webhook struct {
+	ID     int64    `gorm:"primaryKey" json:"id"`
+	UserID uint     `gorm:"not null;index" json:"user_id"`
+	URL    string   `gorm:"not null" json:"url"`
+	Events []string `gorm:"type:text;serializer:json;not null" json:"events"`
+	// Secret keys the signature of every delivery. It is only shown once,
+	// when the webhook is created.
+	Secret string `gorm:"not null" json:"-"`
+
+	Active bool `gorm:"not null;default:true" json:"active"`
+	// Failures counts failed attempts in a row; too many disable the hook.
+	Failures   int        `gorm:"not null;default:0" json:"failures"`
+	DisabledAt *time.Time `json:"disabled_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// wants reports whether the webhook subscribed to events of type typ.
+func (w Webhook) wants(typ string) bool {
+	for _, e := range w.Events {
+		if e == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Delivery states.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+)
+
+// Delivery is one event sent, or to be sent, to a webhook, with the
+// outcome of the latest attempt.
+type Delivery struct {
+	ID        int64  `gorm:"primaryKey" json:"id"`
+	WebhookID int64  `gorm:"not null;index" json:"webhook_id"`
+	EventID   uint64 `gorm:"not null" json:"event_id"`
+	Event     string `gorm:"not null" json:"event"`
+	Payload   string `gorm:"type:text;not null" json:"payload"`
+	// RedeliveryOf points at the delivery this one repeats.
+	RedeliveryOf *int64 `json:"redelivery_of,omitempty"`
+
+	Status        string     `gorm:"not null;index:idx_deliveries_due,priority:1" json:"status"`
+	NextAttemptAt *time.Time `gorm:"index:idx_deliveries_due,priority:2" json:"next_attempt_at,omitempty"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	StatusCode    int        `json:"status_code,omitempty"`
+	Response      string     `gorm:"type:text" json:"response,omitempty"`
+	Error         string     `json:"error,omitempty"`
+	DurationMS    int64      `json:"duration_ms"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,212 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/tmsankram/gonotes/internal/config"
+)
+
+var (
+	// ErrNotFound is returned when a webhook does not exist or belongs to another user.
+	ErrNotFound = errors.New("webhook not found")
+	// ErrDeliveryNotFound is returned for unknown deliveries of a webhook.
+	ErrDeliveryNotFound = errors.New("delivery not found")
+	// ErrDisabled is returned when redelivering through a disabled webhook.
+	ErrDisabled = errors.New("webhook is disabled")
+	// ErrInvalidURL is returned when a webhook URL cannot be parsed or resolved.
+	ErrInvalidURL = errors.New("invalid webhook URL")
+	// ErrForbiddenAddress is returned when a webhook URL points at a
+	// loopback, link-local, private or unspecified address.
+	ErrForbiddenAddress = errors.New("webhook address is not allowed")
+)
+
+type Service struct {
+	db *gorm.DB
+	// allowPrivate lets webhooks point at addresses on our own network
+	allowPrivate bool
+	// wake tells the dispatcher there are deliveries due
+	wake chan struct{}
+}
+
+func NewService(db *gorm.DB, cfg *config.Config) *Service {
+	return &Service{db: db, allowPrivate: cfg.WebhookAllowPrivate, wake: make(chan struct{}, 1)}
+}
+
+// Sign returns the value of the X-GoNotes-Signature-256 header for body:
+// the hex HMAC-SHA256 of the body keyed with the webhook secret, prefixed
+// with "sha256=".
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Create registers a webhook, disabled unless w.Active is set. An empty
+// secret is replaced by a random one; either way the returned webhook
+// carries it so it can be shown once.
+func (s *Service) Create(w Webhook) (Webhook, error) {
+	if err := s.checkURL(context.Background(), w.URL); err != nil {
+		return Webhook{}, err
+	}
+	if w.Secret == "" {
+		secret, err := newSecret()
+		if err != nil {
+			return Webhook{}, err
+		}
+		w.Secret = secret
+	}
+
+	// active has a column default, so false is left out of the insert
+	active := w.Active
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&w).Error; err != nil {
+			return err
+		}
+		w.Active = active
+		if active {
+			return nil
+		}
+		return tx.Model(&w).UpdateColumn("active", false).Error
+	})
+	return w, err
+}
+
+// List returns the user's webhooks.
+func (s *Service) List(userID uint) ([]Webhook, error) {
+	hooks := []Webhook{}
+	err := s.db.Where("user_id = ?", userID).Order("id").Find(&hooks).Error
+	return hooks, err
+}
+
+// Get fetches one of the user's webhooks.
+func (s *Service) Get(userID uint, id int64) (Webhook, error) {
+	var w Webhook
+	err := s.db.Where("user_id = ?", userID).First(&w, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return w, ErrNotFound
+	}
+	return w, err
+}
+
+// Update changes the URL, events and active flag of a webhook, and the
+// secret when one is given. Activating a disabled webhook clears its
+// failure count.
+func (s *Service) Update(userID uint, id int64, data Webhook) (Webhook, error) {
+	w, err := s.Get(userID, id)
+	if err != nil {
+		return Webhook{}, err
+	}
+	if err := s.checkURL(context.Background(), data.URL); err != nil {
+		return Webhook{}, err
+	}
+
+	w.URL = data.URL
+	w.Events = data.Events
+	if data.Secret != "" {
+		w.Secret = data.Secret
+	}
+	if data.Active && !w.Active {
+		w.Failures = 0
+		w.DisabledAt = nil
+	}
+	w.Active = data.Active
+
+	if err := s.db.Save(&w).Error; err != nil {
+		return Webhook{}, err
+	}
+	return w, nil
+}
+
+// Delete removes a webhook and its delivery log.
+func (s *Service) Delete(userID uint, id int64) error {
+	w, err := s.Get(userID, id)
+	if err != nil {
+		return err
+	}
+
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("webhook_id = ?", w.ID).Delete(&Delivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&w).Error
+	})
+}
+
+// Deliveries lists the delivery log of a webhook, newest first.
+func (s *Service) Deliveries(userID uint, id int64, page, limit int) ([]Delivery, int64, error) {
+	if _, err := s.Get(userID, id); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	q := s.db.Model(&Delivery{}).Where("webhook_id = ?", id)
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	deliveries := []Delivery{}
+	err := q.Order("id DESC").Limit(limit).Offset((page - 1) * limit).Find(&deliveries).Error
+	return deliveries, total, err
+}
+
+// Redeliver queues the payload of an earlier delivery again as a new
+// delivery.
+func (s *Service) Redeliver(userID uint, id, deliveryID int64) (Delivery, error) {
+	w, err := s.Get(userID, id)
+	if err != nil {
+		return Delivery{}, err
+	}
+	if !w.Active {
+		return Delivery{}, ErrDisabled
+	}
+
+	var orig Delivery
+	err = s.db.Where("webhook_id = ?", w.ID).First(&orig, deliveryID).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return Delivery{}, ErrDeliveryNotFound
+	}
+	if err != nil {
+		return Delivery{}, err
+	}
+
+	now := time.Now()
+	d := Delivery{
+		WebhookID:     w.ID,
+		EventID:       orig.EventID,
+		Event:         orig.Event,
+		Payload:       orig.Payload,
+		RedeliveryOf:  &orig.ID,
+		Status:        StatusPending,
+		NextAttemptAt: &now,
+	}
+	if err := s.db.Create(&d).Error; err != nil {
+		return Delivery{}, err
+	}
+
+	s.notify()
+	return d, nil
+}
+
+// notify wakes the dispatcher without blocking.
+func (s *Service) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
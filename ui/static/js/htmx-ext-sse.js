@@ -0,0 +1,141 @@
+/*
+ * Server-Sent Events for htmx 2.
+ *
+ * Implements the attributes of the official htmx SSE extension
+ * (https://htmx.org/extensions/sse/) that GoNotes uses, so the upstream
+ * file can replace this one as is:
+ *
+ *   hx-ext="sse" sse-connect="/events"   open an EventSource for the subtree
+ *   sse-swap="name"                      swap the event data into the element
+ *   hx-trigger="sse:name"                trigger the element's request
+ *   sse-close="name"                     close the connection on that event
+ *
+ * The browser reconnects on its own and sends Last-Event-ID, so the server
+ * can replay what was missed.
+ */
+(function () {
+	var api;
+
+	function connect(elt) {
+		var url = api.getAttributeValue(elt, "sse-connect");
+		if (!url || api.getInternalData(elt).sseEventSource) {
+			return;
+		}
+
+		var source = new EventSource(url, { withCredentials: true });
+		api.getInternalData(elt).sseEventSource = source;
+
+		source.onopen = function () {
+			api.triggerEvent(elt, "htmx:sseOpen", { source: source });
+		};
+		source.onerror = function (err) {
+			api.triggerEvent(elt, "htmx:sseError", { error: err, source: source });
+			if (!document.body.contains(elt)) {
+				source.close();
+			}
+		};
+
+		var closeOn = api.getAttributeValue(elt, "sse-close");
+		if (closeOn) {
+			source.addEventListener(closeOn, function () {
+				source.close();
+				api.triggerEvent(elt, "htmx:sseClose", { source: source, type: "message" });
+			});
+		}
+	}
+
+	function sourceFor(elt) {
+		var owner = api.getClosestMatch(elt, function (e) {
+			return api.getInternalData(e).sseEventSource != null;
+		});
+		return owner && api.getInternalData(owner).sseEventSource;
+	}
+
+	// listen adds handler for an event of the connection above elt, and
+	// removes it again once elt left the page.
+	function listen(elt, name, handler) {
+		var source = sourceFor(elt);
+		if (!source) {
+			return;
+		}
+		var listener = function (event) {
+			if (!document.body.contains(elt)) {
+				source.removeEventListener(name, listener);
+				return;
+			}
+			handler(event);
+		};
+		source.addEventListener(name, listener);
+	}
+
+	function swaps(elt) {
+		var names = api.getAttributeValue(elt, "sse-swap");
+		if (!names) {
+			return;
+		}
+		names.split(",").forEach(function (name) {
+			name = name.trim();
+			listen(elt, name, function (event) {
+				if (!api.triggerEvent(elt, "htmx:sseBeforeMessage", event)) {
+					return;
+				}
+				var target = api.getTarget(elt);
+				var swapSpec = api.getSwapSpecification(elt);
+				api.swap(target, event.data, swapSpec);
+				api.triggerEvent(elt, "htmx:sseMessage", event);
+			});
+		});
+	}
+
+	function triggers(elt) {
+		var spec = api.getAttributeValue(elt, "hx-trigger");
+		if (!spec) {
+			return;
+		}
+		spec.split(",").forEach(function (part) {
+			var trigger = part.trim().split(/[\s\[]/)[0];
+			if (trigger.indexOf("sse:") !== 0) {
+				return;
+			}
+			// re-dispatch as a DOM event, which htmx handles like any other
+			// trigger including filters and modifiers
+			listen(elt, trigger.slice(4), function (event) {
+				htmx.trigger(elt, trigger, { data: event.data, lastEventId: event.lastEventId });
+			});
+		});
+	}
+
+	htmx.defineExtension("sse", {
+		init: function (apiRef) {
+			api = apiRef;
+		},
+
+		getSelectors: function () {
+			return ["[sse-connect]", "[data-sse-connect]", "[sse-swap]", "[data-sse-swap]"];
+		},
+
+		onEvent: function (name, evt) {
+			var elt = evt.target || evt.detail.elt;
+
+			switch (name) {
+				case "htmx:beforeCleanupElement":
+					var data = api.getInternalData(elt);
+					if (data.sseEventSource) {
+						data.sseEventSource.close();
+					}
+					return;
+
+				case "htmx:afterProcessNode":
+					// htmx processes an element before its descendants, so
+					// the connection exists by the time they get here
+					if (api.getAttributeValue(elt, "sse-connect")) {
+						connect(elt);
+					}
+					if (sourceFor(elt)) {
+						swaps(elt);
+						triggers(elt);
+					}
+			}
+		}
+	});
+})();